@@ -0,0 +1,162 @@
+// sdb/db/aggregate.go
+//
+// Aggregate functions, like `count(*)` or `sum(price)`, which compute a single
+// value from a group of rows rather than from one row.
+
+package db
+
+import "fmt"
+
+// Call of an aggregate function, one of `count`, `sum`, `avg`, `min` or `max`.
+// `Arg` is nil for `count(*)`. Aggregates can't be evaluated against a single
+// row, so queries replace them with their value for each group of rows, see
+// `Aggregate`.
+type AggregateCall struct {
+	Name string
+	Arg  Expression
+}
+
+func IsAggregateFunction(name string) bool {
+	switch name {
+	case "count", "sum", "avg", "min", "max":
+		return true
+	}
+	return false
+}
+
+// Determines if an expression contains a call to an aggregate function.
+func HasAggregate(expression Expression) bool {
+	found := false
+	MapExpression(expression, func(e Expression) (Expression, error) {
+		if _, ok := e.(AggregateCall); ok {
+			found = true
+		}
+		return e, nil
+	})
+	return found
+}
+
+func (call AggregateCall) Evaluate(_ map[string]int, _ []Value) (*Value, error) {
+	return nil, fmt.Errorf(
+		"!Aggregate function %v can only be used in the columns of a SELECT.",
+		call.Name,
+	)
+}
+
+func (call AggregateCall) TypeOf(columns []Column) Type {
+	if call.Name == "count" {
+		return Int{Size: 8}
+	}
+
+	argType := call.Arg.TypeOf(columns)
+	switch call.Name {
+	case "sum":
+		switch argType.(type) {
+		case Int:
+			return Int{Size: 8}
+		case Decimal:
+			// the sum can have more digits than the values summed
+			return Decimal{}
+		}
+	case "avg":
+		if _, isFloat := argType.(Float); !isFloat {
+			return Decimal{}
+		}
+	}
+	return argType
+}
+
+func (call AggregateCall) ToString() string {
+	if call.Arg == nil {
+		return call.Name + "(*)"
+	}
+	return fmt.Sprintf("%v(%v)", call.Name, call.Arg.ToString())
+}
+
+// Computes the aggregate over a group of rows. NULLs are skipped, and every
+// aggregate but `count` is NULL if there are no other values. Sums of ints are
+// bigints, sums of decimals are decimals of any precision, and averages of ints
+// and decimals are exact decimals.
+func (call AggregateCall) Aggregate(colMap map[string]int, rows [][]Value) (*Value, error) {
+	if call.Arg == nil {
+		return &Value{Value: int64(len(rows)), Type: Int{Size: 8}}, nil
+	}
+
+	var values []*Value
+	for _, row := range rows {
+		value, err := call.Arg.Evaluate(colMap, row)
+		if err != nil {
+			return nil, err
+		}
+		if value.Value == nil {
+			continue
+		}
+		if call.Name == "sum" || call.Name == "avg" {
+			_, isNumber := ToDecimal(value.Value)
+			_, isInterval := value.Value.(IntervalValue)
+			if !isNumber && !(isInterval && call.Name == "sum") {
+				return nil, fmt.Errorf("!Function %v requires numeric values.", call.Name)
+			}
+		}
+		values = append(values, value)
+	}
+
+	if call.Name == "count" {
+		return &Value{Value: int64(len(values)), Type: Int{Size: 8}}, nil
+	}
+	if len(values) == 0 {
+		return &Value{Value: nil, Type: Null{}}, nil
+	}
+
+	result := values[0]
+	if call.Name == "sum" || call.Name == "avg" {
+		switch result.Value.(type) {
+		case int64:
+			result = &Value{Value: result.Value, Type: Int{Size: 8}}
+		case DecimalValue:
+			result = &Value{Value: result.Value, Type: Decimal{}}
+		}
+	}
+	for _, value := range values[1:] {
+		switch call.Name {
+		case "sum", "avg":
+			sum := BinaryExpression{
+				Operator: "+",
+				Left:     Literal{Value: *result},
+				Right:    Literal{Value: *value},
+			}
+			next, err := sum.Evaluate(colMap, nil)
+			if err != nil {
+				return nil, err
+			}
+			result = next
+		case "min", "max":
+			order, err := CompareValues(value, result)
+			if err != nil {
+				return nil, err
+			}
+			if (call.Name == "min" && order < 0) || (call.Name == "max" && order > 0) {
+				result = value
+			}
+		}
+	}
+
+	if call.Name == "avg" {
+		var sum, count Value
+		if float, isFloat := result.Value.(float64); isFloat {
+			sum = Value{Value: float, Type: Float{}}
+			count = Value{Value: float64(len(values)), Type: Float{}}
+		} else {
+			decimal, _ := ToDecimal(result.Value)
+			sum = Value{Value: decimal, Type: Decimal{}}
+			count = Value{Value: DecimalFromInt(int64(len(values))), Type: Decimal{}}
+		}
+		quotient := BinaryExpression{
+			Operator: "/",
+			Left:     Literal{Value: sum},
+			Right:    Literal{Value: count},
+		}
+		return quotient.Evaluate(colMap, nil)
+	}
+	return result, nil
+}
@@ -0,0 +1,65 @@
+// sdb/db/blob.go
+//
+// Binary values, stored in `blob` (or `bytea`) columns. Blobs are written as
+// hex literals like `x'deadbeef'`, and strings stored in blob columns are read
+// like PostgreSQL reads `bytea` input, either as hex like '\xdeadbeef' or with
+// backslash escapes like 'a\000b'.
+
+package db
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Bytes of a blob. Blobs are kept in a string so values stay comparable.
+type BlobValue string
+
+func (blob BlobValue) String() string {
+	return "x'" + hex.EncodeToString([]byte(blob)) + "'"
+}
+
+// Parses the hex digits of a blob literal, like the `deadbeef` of
+// `x'deadbeef'`.
+func ParseHexBlob(digits string) (BlobValue, error) {
+	bytes, err := hex.DecodeString(digits)
+	if err != nil {
+		return "", fmt.Errorf("!Invalid hexadecimal blob x'%v'.", digits)
+	}
+	return BlobValue(bytes), nil
+}
+
+// Parses a string stored in a blob column. Strings starting with `\x` are hex
+// digits, and otherwise `\\` is a backslash and `\` followed by 3 octal digits
+// is the byte they encode.
+func ParseBlob(text string) (BlobValue, error) {
+	if strings.HasPrefix(text, `\x`) {
+		return ParseHexBlob(text[2:])
+	}
+
+	var builder strings.Builder
+	for idx := 0; idx < len(text); idx++ {
+		if text[idx] != '\\' {
+			builder.WriteByte(text[idx])
+			continue
+		}
+
+		if strings.HasPrefix(text[idx:], `\\`) {
+			builder.WriteByte('\\')
+			idx++
+			continue
+		}
+		if idx+4 > len(text) {
+			return "", fmt.Errorf("!Invalid escape in blob '%v'.", text)
+		}
+		octal, err := strconv.ParseUint(text[idx+1:idx+4], 8, 8)
+		if err != nil {
+			return "", fmt.Errorf("!Invalid escape in blob '%v'.", text)
+		}
+		builder.WriteByte(byte(octal))
+		idx += 3
+	}
+	return BlobValue(builder.String()), nil
+}
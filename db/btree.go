@@ -0,0 +1,385 @@
+// sdb/db/btree.go
+//
+// On-disk B+tree used to store secondary indexes. The tree maps byte string
+// keys to integer values, and is stored as fixed size pages in a single file.
+// Page 0 holds metadata, every other page is a leaf or internal node. Leaves
+// are linked left to right so ranges of keys can be scanned in order.
+//
+// Keys are unique within a tree, inserting an existing key replaces its value.
+// Entries are never removed, a tree is instead rebuilt from scratch whenever
+// its table is rewritten.
+
+package db
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"sort"
+)
+
+const (
+	btreePageSize = 4096
+	btreeMagic    = "SDBIDX01"
+
+	// keys longer than this can't be indexed, so that any node split in half
+	// by size is guaranteed to fit in a page
+	MaxIndexKeyLength = 1024
+
+	btreeLeafPage     = 1
+	btreeInternalPage = 2
+)
+
+type BTree struct {
+	file      *os.File
+	root      uint32
+	pageCount uint32
+}
+
+// In-memory form of a single page. Leaves use `values` and `next`, internal
+// nodes use `children`, which has one more element than `keys`.
+type btreeNode struct {
+	leaf     bool
+	keys     [][]byte
+	values   []uint64
+	children []uint32
+	next     uint32
+}
+
+// Creates a new, empty tree at `path`, overwriting any existing file.
+func CreateBTree(path string) (*BTree, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0777)
+	if err != nil {
+		return nil, err
+	}
+
+	tree := &BTree{file: file, root: 1, pageCount: 2}
+	err = tree.writeNode(1, &btreeNode{leaf: true})
+	if err == nil {
+		err = tree.writeMeta()
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return tree, nil
+}
+
+// Opens an existing tree at `path`.
+func OpenBTree(path string) (*BTree, error) {
+	file, err := os.OpenFile(path, os.O_RDWR, 0777)
+	if err != nil {
+		return nil, err
+	}
+
+	meta := make([]byte, 16)
+	_, err = file.ReadAt(meta, 0)
+	if err != nil || string(meta[:8]) != btreeMagic {
+		file.Close()
+		return nil, fmt.Errorf("!Index file %v is corrupt.", path)
+	}
+
+	tree := &BTree{
+		file:      file,
+		root:      binary.BigEndian.Uint32(meta[8:12]),
+		pageCount: binary.BigEndian.Uint32(meta[12:16]),
+	}
+	return tree, nil
+}
+
+func (tree *BTree) Close() error {
+	return tree.file.Close()
+}
+
+// Flushes the tree to disk.
+func (tree *BTree) Sync() error {
+	return tree.file.Sync()
+}
+
+// Inserts `key` into the tree, or replaces its value if it already exists.
+func (tree *BTree) Insert(key []byte, value uint64) error {
+	if len(key) > MaxIndexKeyLength {
+		return fmt.Errorf("!Index key is longer than %v bytes.", MaxIndexKeyLength)
+	}
+
+	splitKey, newPage, split, err := tree.insert(tree.root, key, value)
+	if err != nil || !split {
+		return err
+	}
+
+	// root was split, so the tree grows a level
+	newRoot := &btreeNode{
+		keys:     [][]byte{splitKey},
+		children: []uint32{tree.root, newPage},
+	}
+	rootPage := tree.allocatePage()
+	err = tree.writeNode(rootPage, newRoot)
+	if err != nil {
+		return err
+	}
+	tree.root = rootPage
+
+	return tree.writeMeta()
+}
+
+// Calls `fn` for every entry with `lo <= key < hi`, in key order, until `fn`
+// returns false. A nil `lo` or `hi` leaves that end of the range unbounded.
+func (tree *BTree) Scan(lo []byte, hi []byte, fn func(key []byte, value uint64) bool) error {
+	page := tree.root
+	for {
+		node, err := tree.readNode(page)
+		if err != nil {
+			return err
+		}
+		if node.leaf {
+			break
+		}
+		page = node.children[childIndex(node, lo)]
+	}
+
+	for page != 0 {
+		node, err := tree.readNode(page)
+		if err != nil {
+			return err
+		}
+
+		for idx, key := range node.keys {
+			if lo != nil && bytes.Compare(key, lo) < 0 {
+				continue
+			}
+			if hi != nil && bytes.Compare(key, hi) >= 0 {
+				return nil
+			}
+			if !fn(key, node.values[idx]) {
+				return nil
+			}
+		}
+		page = node.next
+	}
+
+	return nil
+}
+
+// Finds which child of an internal node could contain `key`. A nil key is
+// less than every key.
+func childIndex(node *btreeNode, key []byte) int {
+	if key == nil {
+		return 0
+	}
+	return sort.Search(len(node.keys), func(idx int) bool {
+		return bytes.Compare(node.keys[idx], key) > 0
+	})
+}
+
+// Recursively inserts into the subtree rooted at `page`. If the node had to be
+// split, returns the first key of the new right sibling and its page.
+func (tree *BTree) insert(page uint32, key []byte, value uint64) ([]byte, uint32, bool, error) {
+	node, err := tree.readNode(page)
+	if err != nil {
+		return nil, 0, false, err
+	}
+
+	if node.leaf {
+		idx := sort.Search(len(node.keys), func(idx int) bool {
+			return bytes.Compare(node.keys[idx], key) >= 0
+		})
+		if idx < len(node.keys) && bytes.Equal(node.keys[idx], key) {
+			node.values[idx] = value
+			return nil, 0, false, tree.writeNode(page, node)
+		}
+
+		node.keys = append(node.keys, nil)
+		copy(node.keys[idx+1:], node.keys[idx:])
+		node.keys[idx] = append([]byte{}, key...)
+		node.values = append(node.values, 0)
+		copy(node.values[idx+1:], node.values[idx:])
+		node.values[idx] = value
+	} else {
+		idx := childIndex(node, key)
+		splitKey, newPage, split, err := tree.insert(node.children[idx], key, value)
+		if err != nil || !split {
+			return nil, 0, false, err
+		}
+
+		node.keys = append(node.keys, nil)
+		copy(node.keys[idx+1:], node.keys[idx:])
+		node.keys[idx] = splitKey
+		node.children = append(node.children, 0)
+		copy(node.children[idx+2:], node.children[idx+1:])
+		node.children[idx+1] = newPage
+	}
+
+	if node.size() <= btreePageSize {
+		return nil, 0, false, tree.writeNode(page, node)
+	}
+
+	left, right, splitKey := node.split()
+	rightPage := tree.allocatePage()
+	if node.leaf {
+		right.next = node.next
+		left.next = rightPage
+	}
+
+	err = tree.writeNode(rightPage, right)
+	if err == nil {
+		err = tree.writeNode(page, left)
+	}
+	if err == nil {
+		err = tree.writeMeta()
+	}
+	if err != nil {
+		return nil, 0, false, err
+	}
+
+	return splitKey, rightPage, true, nil
+}
+
+// Splits a node in two at the point that divides its size most evenly. For
+// leaves, the split key is the first key of the right node. For internal
+// nodes, the split key moves up to the parent and is in neither half.
+func (node *btreeNode) split() (*btreeNode, *btreeNode, []byte) {
+	half := node.size() / 2
+	size := 7
+	mid := 0
+	for mid < len(node.keys)-1 {
+		size += node.entrySize(mid)
+		if size >= half {
+			break
+		}
+		mid += 1
+	}
+	if mid == 0 {
+		mid = 1
+	}
+
+	if node.leaf {
+		left := &btreeNode{
+			leaf:   true,
+			keys:   append([][]byte{}, node.keys[:mid]...),
+			values: append([]uint64{}, node.values[:mid]...),
+		}
+		right := &btreeNode{
+			leaf:   true,
+			keys:   append([][]byte{}, node.keys[mid:]...),
+			values: append([]uint64{}, node.values[mid:]...),
+		}
+		return left, right, right.keys[0]
+	}
+
+	left := &btreeNode{
+		keys:     append([][]byte{}, node.keys[:mid]...),
+		children: append([]uint32{}, node.children[:mid+1]...),
+	}
+	right := &btreeNode{
+		keys:     append([][]byte{}, node.keys[mid+1:]...),
+		children: append([]uint32{}, node.children[mid+1:]...),
+	}
+	return left, right, node.keys[mid]
+}
+
+// Size in bytes of the entry at `idx` when written to a page.
+func (node *btreeNode) entrySize(idx int) int {
+	if node.leaf {
+		return 2 + len(node.keys[idx]) + 8
+	}
+	return 2 + len(node.keys[idx]) + 4
+}
+
+// Size in bytes of the node when written to a page.
+func (node *btreeNode) size() int {
+	// page type, key count, and next page or first child
+	size := 7
+	for idx := range node.keys {
+		size += node.entrySize(idx)
+	}
+	return size
+}
+
+func (tree *BTree) allocatePage() uint32 {
+	page := tree.pageCount
+	tree.pageCount += 1
+	return page
+}
+
+func (tree *BTree) writeMeta() error {
+	meta := make([]byte, btreePageSize)
+	copy(meta, btreeMagic)
+	binary.BigEndian.PutUint32(meta[8:12], tree.root)
+	binary.BigEndian.PutUint32(meta[12:16], tree.pageCount)
+
+	_, err := tree.file.WriteAt(meta, 0)
+	return err
+}
+
+// Page layout is a page type byte, a 2 byte key count, then for leaves the
+// next leaf's page followed by (key length, key, value) entries, and for
+// internal nodes the first child's page followed by (key length, key, child)
+// entries.
+func (tree *BTree) writeNode(page uint32, node *btreeNode) error {
+	buffer := make([]byte, btreePageSize)
+	if node.leaf {
+		buffer[0] = btreeLeafPage
+		binary.BigEndian.PutUint32(buffer[3:7], node.next)
+	} else {
+		buffer[0] = btreeInternalPage
+		binary.BigEndian.PutUint32(buffer[3:7], node.children[0])
+	}
+	binary.BigEndian.PutUint16(buffer[1:3], uint16(len(node.keys)))
+
+	offset := 7
+	for idx, key := range node.keys {
+		binary.BigEndian.PutUint16(buffer[offset:], uint16(len(key)))
+		offset += 2
+		offset += copy(buffer[offset:], key)
+		if node.leaf {
+			binary.BigEndian.PutUint64(buffer[offset:], node.values[idx])
+			offset += 8
+		} else {
+			binary.BigEndian.PutUint32(buffer[offset:], node.children[idx+1])
+			offset += 4
+		}
+	}
+
+	_, err := tree.file.WriteAt(buffer, int64(page)*btreePageSize)
+	return err
+}
+
+func (tree *BTree) readNode(page uint32) (*btreeNode, error) {
+	buffer := make([]byte, btreePageSize)
+	_, err := tree.file.ReadAt(buffer, int64(page)*btreePageSize)
+	if err != nil {
+		return nil, fmt.Errorf("!Failed to read index page %v: %v", page, err)
+	}
+
+	node := &btreeNode{leaf: buffer[0] == btreeLeafPage}
+	if buffer[0] != btreeLeafPage && buffer[0] != btreeInternalPage {
+		return nil, fmt.Errorf("!Index page %v is corrupt.", page)
+	}
+
+	count := int(binary.BigEndian.Uint16(buffer[1:3]))
+	first := binary.BigEndian.Uint32(buffer[3:7])
+	if node.leaf {
+		node.next = first
+	} else {
+		node.children = append(node.children, first)
+	}
+
+	offset := 7
+	for idx := 0; idx < count; idx++ {
+		keyLength := int(binary.BigEndian.Uint16(buffer[offset:]))
+		offset += 2
+		node.keys = append(node.keys, append([]byte{}, buffer[offset:offset+keyLength]...))
+		offset += keyLength
+		if node.leaf {
+			node.values = append(node.values, binary.BigEndian.Uint64(buffer[offset:]))
+			offset += 8
+		} else {
+			node.children = append(node.children, binary.BigEndian.Uint32(buffer[offset:]))
+			offset += 4
+		}
+	}
+
+	return node, nil
+}
@@ -0,0 +1,277 @@
+// sdb/db/cast.go
+//
+// Conversions between types, made by `CAST(<expression> AS <type>)`,
+// `<expression>::<type>` and `ALTER COLUMN ... TYPE`.
+
+package db
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Converts a value to type `newType`, the strict conversions `Cast` is built
+// on. Numbers convert between ints, floats and decimals, as long as a number
+// has no fractional part when converted to an int and fits in the new type,
+// and strings convert between chars and varchars as long as they fit in the
+// new size. Decimals are rounded to the new type's scale. Booleans convert to
+// the ints 1 and 0, and ints to booleans, with every nonzero int true. Strings
+// are parsed as dates, times, timestamps, intervals, JSON documents, enums and
+// UUIDs, which convert back to their text, see `ParseAs`.
+func convertValue(value Value, newType Type) (*Value, error) {
+	if value.Value == nil {
+		return &value, nil
+	}
+
+	outOfRange := fmt.Errorf(
+		"value %v is out of range for type %v",
+		value.ToString(),
+		newType.ToString(),
+	)
+	decimal, isNumber := ToDecimal(value.Value)
+	flag, isBoolean := value.Value.(bool)
+	switch newType := newType.(type) {
+	case Boolean:
+		if integer, isInt := value.Value.(int64); isInt {
+			return &Value{Value: integer != 0, Type: newType}, nil
+		}
+		if !isBoolean {
+			return nil, fmt.Errorf("value %v is not a boolean", value.ToString())
+		}
+		return &value, nil
+	case Int:
+		if isBoolean {
+			integer := int64(0)
+			if flag {
+				integer = 1
+			}
+			return &Value{Value: integer, Type: newType}, nil
+		}
+		if !isNumber {
+			return nil, fmt.Errorf("value %v is not numeric", value.ToString())
+		}
+		if decimal.Cmp(decimal.Round(0)) != 0 {
+			return nil, fmt.Errorf(
+				"value %v has a fractional part", value.ToString(),
+			)
+		}
+		integer := decimal.Round(0).Unscaled
+		if !integer.IsInt64() || !newType.Contains(integer.Int64()) {
+			return nil, outOfRange
+		}
+		return &Value{Value: integer.Int64(), Type: newType}, nil
+	case Float:
+		if !isNumber {
+			return nil, fmt.Errorf("value %v is not numeric", value.ToString())
+		}
+		if number, isFloat := value.Value.(float64); isFloat {
+			return &Value{Value: number, Type: Float{}}, nil
+		}
+		float, ok := decimal.Float64()
+		if !ok {
+			return nil, outOfRange
+		}
+		return &Value{Value: float, Type: Float{}}, nil
+	case Decimal:
+		if !isNumber {
+			return nil, fmt.Errorf("value %v is not numeric", value.ToString())
+		}
+		rounded, fits := newType.Round(decimal)
+		if !fits {
+			return nil, outOfRange
+		}
+		return &Value{Value: rounded, Type: newType}, nil
+	case Date, Time, Timestamp, Interval:
+		converted, err := ToTemporal(value, newType)
+		if err != nil {
+			return nil, fmt.Errorf(
+				"value %v is not a valid %v", value.ToString(), newType.ToString(),
+			)
+		}
+		return &converted, nil
+	case Blob:
+		if _, isBlob := value.Value.(BlobValue); isBlob {
+			return &value, nil
+		}
+		text, isString := value.Value.(string)
+		if !isString {
+			return nil, fmt.Errorf("value %v is not a blob", value.ToString())
+		}
+		blob, err := ParseBlob(text)
+		if err != nil {
+			return nil, fmt.Errorf("value %v is not a valid blob", value.ToString())
+		}
+		return &Value{Value: blob, Type: newType}, nil
+	case JSON, Enum, UUID:
+		if value.TypeMatches(&newType) {
+			return &value, nil
+		}
+		text, isString := value.Value.(string)
+		converted, _, err := ParseAs(text, newType)
+		if !isString || err != nil {
+			return nil, fmt.Errorf(
+				"value %v is not a valid %v", value.ToString(), newType.ToString(),
+			)
+		}
+		return &converted, nil
+	}
+
+	// dates, times, timestamps, intervals, JSON documents, enums and UUIDs
+	// convert to their text
+	switch value.Type.(type) {
+	case Date, Time, Timestamp, Interval:
+		text := strings.Trim(value.ToString(), "'")
+		value = Value{Value: text, Type: VarChar{Size: len(text)}}
+	case JSON:
+		text := string(value.Value.(JSONValue))
+		value = Value{Value: text, Type: VarChar{Size: len(text)}}
+	case Enum:
+		text := value.Value.(EnumValue).Label
+		value = Value{Value: text, Type: VarChar{Size: len(text)}}
+	case UUID:
+		text := value.Value.(UUIDValue).String()
+		value = Value{Value: text, Type: VarChar{Size: len(text)}}
+	}
+
+	_, isBlob := value.Value.(BlobValue)
+	if isNumber || isBoolean || isBlob {
+		return nil, fmt.Errorf("value %v is not a string", value.ToString())
+	}
+	if _, isText := newType.(Text); isText {
+		return &Value{Value: value.Value, Type: newType}, nil
+	}
+	if !value.TypeMatches(&newType) {
+		return nil, fmt.Errorf(
+			"value %v does not fit in %v",
+			value.ToString(),
+			newType.ToString(),
+		)
+	}
+
+	return &value, nil
+}
+
+// `CAST(<expression> AS <type>)`, also written `<expression>::<type>`.
+type CastExpression struct {
+	Operand Expression
+	Type    Type
+}
+
+func (cast CastExpression) Evaluate(colMap map[string]int, row []Value) (*Value, error) {
+	// enum types are only known by name until looked up in the catalog,
+	// which expressions can't do
+	if enum, isEnum := cast.Type.(Enum); isEnum && enum.Labels == nil {
+		return nil, fmt.Errorf("!Cannot cast to type %v.", enum.Name)
+	}
+
+	value, err := cast.Operand.Evaluate(colMap, row)
+	if err != nil {
+		return nil, err
+	}
+	converted, err := Cast(*value, cast.Type)
+	if err != nil {
+		return nil, fmt.Errorf("!Failed to cast to type %v: %v", cast.Type.ToString(), err)
+	}
+	return converted, nil
+}
+
+func (cast CastExpression) TypeOf(_ []Column) Type {
+	return cast.Type
+}
+
+func (cast CastExpression) ToString() string {
+	return parenthesize(cast.Operand, precedence(cast)) + "::" + cast.Type.ToString()
+}
+
+// Converts a value to type `t`. Casts are looser than the conversions of
+// `convertValue`: numbers are rounded to the nearest int, strings are parsed
+// as ints, numbers and booleans, and any value but a blob can be cast to a
+// string type, cut off at the type's size if it's too long. NULL casts to
+// NULL.
+func Cast(value Value, t Type) (*Value, error) {
+	if value.Value == nil {
+		return &Value{Value: nil, Type: Null{}}, nil
+	}
+
+	invalid := fmt.Errorf("value %v is not a valid %v", value.ToString(), t.ToString())
+
+	text, isString := value.Value.(string)
+	text = strings.TrimSpace(text)
+	switch target := t.(type) {
+	case Char, VarChar, Text:
+		cast, ok := castText(value)
+		if !ok {
+			return nil, invalid
+		}
+		size := len(cast)
+		switch target := target.(type) {
+		case Char:
+			size = target.Size
+		case VarChar:
+			size = target.Size
+		}
+		if len(cast) > size {
+			// don't cut a character in half
+			for size > 0 && !utf8.RuneStart(cast[size]) {
+				size--
+			}
+			cast = cast[:size]
+		}
+		return &Value{Value: cast, Type: target}, nil
+	case Boolean:
+		if !isString {
+			break
+		}
+		switch strings.ToLower(strings.TrimSpace(text)) {
+		case "t", "true", "y", "yes", "on", "1":
+			return &Value{Value: true, Type: target}, nil
+		case "f", "false", "n", "no", "off", "0":
+			return &Value{Value: false, Type: target}, nil
+		}
+		return nil, invalid
+	case Int:
+		if isString {
+			integer, err := strconv.ParseInt(text, 10, 64)
+			if err != nil {
+				return nil, invalid
+			}
+			value = Value{Value: integer, Type: Int{Size: 8}}
+		} else if number, isNumber := ToDecimal(value.Value); isNumber {
+			value = Value{Value: number.Round(0), Type: Decimal{}}
+		}
+	case Float, Decimal:
+		if !isString {
+			break
+		}
+		number, err := ParseDecimal(text)
+		if err != nil {
+			return nil, invalid
+		}
+		value = Value{Value: number, Type: Decimal{}}
+	}
+
+	return convertValue(value, t)
+}
+
+// Gets the text of a value cast to a string type. Returns false for blobs,
+// which have no text.
+func castText(value Value) (string, bool) {
+	switch v := value.Value.(type) {
+	case string:
+		return v, true
+	case BlobValue:
+		return "", false
+	case JSONValue:
+		return string(v), true
+	case EnumValue:
+		return v.Label, true
+	case UUIDValue:
+		return v.String(), true
+	}
+	if isTemporal(value.Type) {
+		return temporalString(value), true
+	}
+	return value.ToString(), true
+}
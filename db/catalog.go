@@ -0,0 +1,182 @@
+// sdb/db/catalog.go
+//
+// The catalog of a database records the schema of each of its tables, and the
+// definitions of its views, sequences and enum types. It is stored in a single file in the
+// database directory, see `sdb/utils/catalog.go`, and cached in `DBState` for
+// as long as the file doesn't change.
+
+package db
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// Version of the catalog file format, written to the first line of the file.
+const CatalogFormatVersion = 1
+
+// How long to wait for another process to release a lock file.
+const lockTimeout = 5 * time.Second
+
+// Definition of a view created by `CREATE [MATERIALIZED] VIEW`. The rows of a
+// materialized view are stored in a table of the same name.
+type ViewDefinition struct {
+	Query        string
+	Materialized bool
+}
+
+// Definition of a sequence. The next value a sequence will hand out is stored
+// separately, see `sdb/db/sequence.go`.
+type SequenceDefinition struct {
+	Start     int64
+	Increment int64
+}
+
+// `Version` counts the changes made to the catalog. `ModTime` and `Size` are
+// those of the catalog file when it was read, so changes made by other
+// processes can be noticed, as with `KeyIndex`.
+type Catalog struct {
+	Database  string
+	Version   int64
+	Tables    map[string]*TableSchema
+	Views     map[string]ViewDefinition
+	Sequences map[string]SequenceDefinition
+	Types     map[string]Enum
+	ModTime   time.Time
+	Size      int64
+}
+
+func NewCatalog(database string) *Catalog {
+	return &Catalog{
+		Database:  database,
+		Tables:    make(map[string]*TableSchema),
+		Views:     make(map[string]ViewDefinition),
+		Sequences: make(map[string]SequenceDefinition),
+		Types:     make(map[string]Enum),
+	}
+}
+
+// Records the state of the catalog file the catalog was read from.
+func (catalog *Catalog) Stamp(info os.FileInfo) {
+	catalog.ModTime = info.ModTime()
+	catalog.Size = info.Size()
+}
+
+// Checks if the catalog is up to date with the catalog file.
+func (catalog *Catalog) Matches(info os.FileInfo) bool {
+	return catalog.ModTime.Equal(info.ModTime()) && catalog.Size == info.Size()
+}
+
+// Copies the schema, so that changing the copy doesn't change the catalog.
+func (schema *TableSchema) Copy() *TableSchema {
+	copied := &TableSchema{
+		Columns: append([]Column{}, schema.Columns...),
+	}
+	for _, key := range schema.Keys {
+		key.Columns = append([]string{}, key.Columns...)
+		copied.Keys = append(copied.Keys, key)
+	}
+	for _, foreignKey := range schema.ForeignKeys {
+		foreignKey.Columns = append([]string{}, foreignKey.Columns...)
+		foreignKey.RefColumns = append([]string{}, foreignKey.RefColumns...)
+		copied.ForeignKeys = append(copied.ForeignKeys, foreignKey)
+	}
+	for _, index := range schema.Indexes {
+		index.Columns = append([]string{}, index.Columns...)
+		copied.Indexes = append(copied.Indexes, index)
+	}
+	return copied
+}
+
+// The catalog of the current database, if it has been loaded.
+func (state *DBState) CachedCatalog() *Catalog {
+	if state.Catalog == nil || state.Catalog.Database != state.CurrentDB {
+		return nil
+	}
+	return state.Catalog
+}
+
+// Returned by `LockFile` when another process holds the lock for too long.
+var ErrLocked = errors.New("locked")
+
+// Takes a lock by creating the file at `lockPath`, waiting for any other
+// process holding it. The file holds the PID of the process holding the lock,
+// so a lock left behind by a process that died is taken over, see
+// `takeOverLock`. A lock left behind on another machine sharing the database
+// can be cleared by deleting its file. Returns a function that releases the
+// lock.
+func LockFile(lockPath string) (func(), error) {
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		file, err := os.OpenFile(lockPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0777)
+		if err == nil {
+			fmt.Fprintf(file, "%v", os.Getpid())
+			file.Close()
+			return func() { os.Remove(lockPath) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		if pid, abandoned := lockAbandoned(lockPath); abandoned {
+			if err = takeOverLock(lockPath, pid); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, ErrLocked
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// Determines if the process whose PID is in a lock file is no longer running,
+// returning the PID. A lock file without a PID, like one whose holder hasn't
+// written it yet, is never abandoned, and neither are locks on Windows, where
+// processes can't be checked this way.
+func lockAbandoned(lockPath string) (int, bool) {
+	if runtime.GOOS == "windows" {
+		return 0, false
+	}
+	contents, err := ioutil.ReadFile(lockPath)
+	if err != nil {
+		return 0, false
+	}
+	pid, err := strconv.Atoi(string(contents))
+	if err != nil || pid <= 0 || pid == os.Getpid() {
+		return 0, false
+	}
+
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return pid, true
+	}
+	// signal 0 only checks that the process exists, and a process owned by
+	// another user can't be signalled but is still running
+	err = process.Signal(syscall.Signal(0))
+	return pid, err != nil && err != syscall.EPERM
+}
+
+// Removes a lock file left behind by the dead process `pid`. Processes taking
+// over the same lock take turns, so one of them can't remove the lock another
+// just took.
+func takeOverLock(lockPath string, pid int) error {
+	unlock, err := LockFile(lockPath + "_takeover")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if current, abandoned := lockAbandoned(lockPath); abandoned && current == pid {
+		if err = os.Remove(lockPath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,890 @@
+// sdb/db/datetime.go
+//
+// Dates, times of day, timestamps and intervals: parsing their ISO 8601
+// literals, writing them out, and the arithmetic and functions on them. Dates
+// and timestamps are `time.Time`s in UTC, times of day are `TimeOfDay`s and
+// intervals are `IntervalValue`s, all to the microsecond. There are no session
+// time zones, so timestamps with a time zone are converted to and shown in UTC.
+
+package db
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const microsPerDay = 24 * 60 * 60 * 1000000
+
+// Layouts of timestamp literals, like `2021-05-01`, `2021-05-01 10:30` and
+// `2021-05-01T10:30:00.5+02:00`. Fractional seconds are always accepted after
+// the seconds, see `time.Parse`.
+var timestampLayouts = func() []string {
+	layouts := []string{"2006-01-02"}
+	for _, separator := range []string{" ", "T"} {
+		for _, clock := range []string{"15:04:05", "15:04"} {
+			for _, zone := range []string{"", "Z07:00", "Z0700", "Z07"} {
+				layouts = append(layouts, "2006-01-02"+separator+clock+zone)
+			}
+		}
+	}
+	return layouts
+}()
+
+// Time of day as microseconds since midnight, the value of `time` columns.
+type TimeOfDay int64
+
+func (timeOfDay TimeOfDay) String() string {
+	micros := int64(timeOfDay)
+	return formatClock(micros/3600000000, micros/60000000%60, micros%60000000)
+}
+
+// Writes out `hh:mm:ss`, followed by the fraction of a second if there is one.
+func formatClock(hours int64, minutes int64, micros int64) string {
+	clock := fmt.Sprintf("%02d:%02d:%02d", hours, minutes, micros/1000000)
+	if fraction := micros % 1000000; fraction != 0 {
+		clock += strings.TrimRight(fmt.Sprintf(".%06d", fraction), "0")
+	}
+	return clock
+}
+
+// Length of time, the value of `interval` columns. Like in PostgreSQL, months
+// and days are kept apart from the rest, since months differ in days and days
+// in hours across daylight saving changes.
+type IntervalValue struct {
+	Months int64
+	Days   int64
+	Micros int64
+}
+
+// Writes out the interval like PostgreSQL, e.g. `1 year 2 mons 3 days
+// 04:05:06`.
+func (interval IntervalValue) String() string {
+	var parts []string
+	addPart := func(count int64, unit string) {
+		if count == 1 {
+			parts = append(parts, fmt.Sprintf("%v %v", count, unit))
+		} else if count != 0 {
+			parts = append(parts, fmt.Sprintf("%v %vs", count, unit))
+		}
+	}
+	addPart(interval.Months/12, "year")
+	addPart(interval.Months%12, "mon")
+	addPart(interval.Days, "day")
+
+	if interval.Micros != 0 || len(parts) == 0 {
+		micros := interval.Micros
+		sign := ""
+		if micros < 0 {
+			sign = "-"
+			micros = -micros
+		} else if micros > 0 && (interval.Months < 0 || interval.Days < 0) {
+			sign = "+"
+		}
+		clock := formatClock(micros/3600000000, micros/60000000%60, micros%60000000)
+		parts = append(parts, sign+clock)
+	}
+	return strings.Join(parts, " ")
+}
+
+func (interval IntervalValue) neg() IntervalValue {
+	return IntervalValue{Months: -interval.Months, Days: -interval.Days, Micros: -interval.Micros}
+}
+
+// Length of the interval in microseconds, counting months as 30 days, which is
+// how intervals are compared.
+func (interval IntervalValue) span() *big.Int {
+	span := big.NewInt(interval.Months * 30)
+	span.Add(span, big.NewInt(interval.Days))
+	span.Mul(span, big.NewInt(microsPerDay))
+	return span.Add(span, big.NewInt(interval.Micros))
+}
+
+// Adds months, days and microseconds to the interval, carrying fractions of a
+// month into days as 30 days per month, and fractions of a day into
+// microseconds. Returns false if the interval grows out of range.
+func (interval *IntervalValue) add(months float64, days float64, micros float64) bool {
+	wholeMonths := math.Trunc(months)
+	days += (months - wholeMonths) * 30
+	wholeDays := math.Trunc(days)
+	micros += (days - wholeDays) * microsPerDay
+
+	for _, part := range []float64{wholeMonths, wholeDays, micros} {
+		if math.IsNaN(part) || math.Abs(part) > 1<<62 {
+			return false
+		}
+	}
+	interval.Months += int64(wholeMonths)
+	interval.Days += int64(wholeDays)
+	interval.Micros += int64(math.Round(micros))
+	return true
+}
+
+// Microseconds in each unit an interval can be written in, with months and days
+// handled separately.
+var intervalUnitMicros = map[string]float64{
+	"microsecond": 1,
+	"millisecond": 1000,
+	"second":      1000000,
+	"sec":         1000000,
+	"minute":      60000000,
+	"min":         60000000,
+	"hour":        3600000000,
+}
+
+// Adds `count` of `unit`, like `2 hours` or `1.5 days`, to the interval.
+func (interval *IntervalValue) addUnit(count float64, unit string) bool {
+	unit = strings.TrimSuffix(unit, "s")
+	switch unit {
+	case "year":
+		return interval.add(count*12, 0, 0)
+	case "month", "mon":
+		return interval.add(count, 0, 0)
+	case "week":
+		return interval.add(0, count*7, 0)
+	case "day":
+		return interval.add(0, count, 0)
+	}
+	micros, ok := intervalUnitMicros[unit]
+	return ok && interval.add(0, 0, count*micros)
+}
+
+// Parses the text of a date, time, timestamp or interval literal as a value of
+// type `t`.
+func ParseTemporal(text string, t Type) (Value, error) {
+	var value interface{}
+	var ok bool
+	switch t := t.(type) {
+	case Date:
+		var timestamp time.Time
+		timestamp, ok = parseTimestamp(text, false)
+		value = startOfDay(timestamp)
+	case Timestamp:
+		value, ok = parseTimestamp(text, t.WithTimeZone)
+	case Time:
+		value, ok = parseTimeOfDay(text)
+	case Interval:
+		value, ok = parseInterval(text)
+	}
+	if !ok {
+		return Value{}, fmt.Errorf("!Invalid input for type %v: '%v'.", t.ToString(), text)
+	}
+	return Value{Value: value, Type: t}, nil
+}
+
+// Parses an ISO 8601 timestamp, see `timestampLayouts`. The time zone of a
+// timestamp without one is ignored.
+func parseTimestamp(text string, withTimeZone bool) (time.Time, bool) {
+	text = strings.ToUpper(strings.TrimSpace(text))
+	for _, layout := range timestampLayouts {
+		timestamp, err := time.Parse(layout, text)
+		if err != nil {
+			continue
+		}
+		if withTimeZone {
+			timestamp = timestamp.UTC()
+		} else {
+			year, month, day := timestamp.Date()
+			hour, minute, second := timestamp.Clock()
+			timestamp = time.Date(
+				year, month, day, hour, minute, second, timestamp.Nanosecond(), time.UTC,
+			)
+		}
+		timestamp = timestamp.Truncate(time.Microsecond)
+		return timestamp, inTimestampRange(timestamp)
+	}
+	return time.Time{}, false
+}
+
+// Checks that a timestamp's year can be written with 4 digits.
+func inTimestampRange(timestamp time.Time) bool {
+	return timestamp.Year() >= 1 && timestamp.Year() <= 9999
+}
+
+// Parses a time of day, like `10:30` or `10:30:00.5`.
+func parseTimeOfDay(text string) (TimeOfDay, bool) {
+	micros, ok := parseClock(strings.TrimSpace(text))
+	return TimeOfDay(micros), ok && micros >= 0 && micros < microsPerDay
+}
+
+// Parses `[+-]h:mm[:ss[.ffffff]]` as a number of microseconds.
+func parseClock(text string) (int64, bool) {
+	sign := int64(1)
+	if strings.HasPrefix(text, "-") {
+		sign = -1
+	}
+	fields := strings.Split(strings.TrimLeft(text, "+-"), ":")
+	if len(fields) < 2 || len(fields) > 3 {
+		return 0, false
+	}
+
+	hours, err := strconv.ParseUint(fields[0], 10, 32)
+	if err != nil {
+		return 0, false
+	}
+	minutes, err := strconv.ParseUint(fields[1], 10, 8)
+	if err != nil || len(fields[1]) != 2 || minutes >= 60 {
+		return 0, false
+	}
+	seconds := 0.0
+	if len(fields) == 3 {
+		seconds, err = strconv.ParseFloat(fields[2], 64)
+		if err != nil || fields[2][0] < '0' || fields[2][0] > '9' || seconds >= 60 {
+			return 0, false
+		}
+	}
+
+	micros := int64(hours)*3600000000 + int64(minutes)*60000000 +
+		int64(math.Round(seconds*1000000))
+	return sign * micros, true
+}
+
+// Parses an interval written like PostgreSQL writes them, as amounts of units
+// followed by an optional time, e.g. `1 year 2 mons 3 days 04:05:06` or
+// `-1.5 hours`, or in the ISO 8601 format, e.g. `P1Y2M3DT4H5M6S`. A trailing
+// `ago` negates the interval.
+func parseInterval(text string) (IntervalValue, bool) {
+	fields := strings.Fields(strings.ToLower(text))
+	if len(fields) == 1 && strings.HasPrefix(fields[0], "p") {
+		return parseISOInterval(fields[0])
+	}
+
+	var interval IntervalValue
+	ago := len(fields) > 1 && fields[len(fields)-1] == "ago"
+	if ago {
+		fields = fields[:len(fields)-1]
+	}
+	if len(fields) == 0 {
+		return interval, false
+	}
+
+	for idx := 0; idx < len(fields); idx++ {
+		if strings.Contains(fields[idx], ":") {
+			micros, ok := parseClock(fields[idx])
+			if !ok || !interval.add(0, 0, float64(micros)) {
+				return interval, false
+			}
+			continue
+		}
+
+		count, err := strconv.ParseFloat(fields[idx], 64)
+		if err != nil {
+			return interval, false
+		}
+		// a number without a unit counts seconds
+		unit := "second"
+		if idx+1 < len(fields) {
+			idx++
+			unit = fields[idx]
+		}
+		if !interval.addUnit(count, unit) {
+			return interval, false
+		}
+	}
+
+	if ago {
+		interval = interval.neg()
+	}
+	return interval, true
+}
+
+// Parses an ISO 8601 duration like `p1y2m3dt4h5m6.5s`.
+func parseISOInterval(text string) (IntervalValue, bool) {
+	var interval IntervalValue
+	units := map[byte]string{'y': "year", 'm': "month", 'w': "week", 'd': "day"}
+	rest := text[1:]
+	if rest == "" {
+		return interval, false
+	}
+	for rest != "" {
+		if rest[0] == 't' {
+			units = map[byte]string{'h': "hour", 'm': "minute", 's': "second"}
+			rest = rest[1:]
+			continue
+		}
+
+		end := strings.IndexFunc(rest, func(char rune) bool {
+			return (char < '0' || char > '9') && char != '.' && char != '-'
+		})
+		if end <= 0 {
+			return interval, false
+		}
+		count, err := strconv.ParseFloat(rest[:end], 64)
+		unit, ok := units[rest[end]]
+		if err != nil || !ok || !interval.addUnit(count, unit) {
+			return interval, false
+		}
+		rest = rest[end+1:]
+	}
+	return interval, true
+}
+
+func isTemporal(t Type) bool {
+	switch t.(type) {
+	case Date, Time, Timestamp, Interval:
+		return true
+	}
+	return false
+}
+
+// Writes out a date, time, timestamp or interval in the format its literals
+// are parsed from, without quotes.
+func temporalString(value Value) string {
+	switch v := value.Value.(type) {
+	case time.Time:
+		if _, isDate := value.Type.(Date); isDate {
+			return v.Format("2006-01-02")
+		}
+		formatted := v.Format("2006-01-02 15:04:05.999999")
+		if timestamp, _ := value.Type.(Timestamp); timestamp.WithTimeZone {
+			formatted += "+00"
+		}
+		return formatted
+	case TimeOfDay:
+		return v.String()
+	case IntervalValue:
+		return v.String()
+	}
+	return fmt.Sprintf("%v", value.Value)
+}
+
+// Converts a value to be stored as type `t`, one of the date, time, timestamp
+// or interval types. Strings are parsed as literals of the type, dates and
+// timestamps convert to each other, and timestamps to their time of day.
+func ToTemporal(value Value, t Type) (Value, error) {
+	if text, isString := value.Value.(string); isString {
+		return ParseTemporal(text, t)
+	}
+
+	switch v := value.Value.(type) {
+	case time.Time:
+		switch t.(type) {
+		case Date:
+			return Value{Value: startOfDay(v), Type: t}, nil
+		case Timestamp:
+			return Value{Value: v, Type: t}, nil
+		case Time:
+			return Value{Value: TimeOfDay(clockMicros(v)), Type: t}, nil
+		}
+	case TimeOfDay:
+		if _, isTime := t.(Time); isTime {
+			return Value{Value: v, Type: t}, nil
+		}
+	case IntervalValue:
+		if _, isInterval := t.(Interval); isInterval {
+			return Value{Value: v, Type: t}, nil
+		}
+	}
+	return Value{}, fmt.Errorf("!Value %v is not of type %v", value.ToString(), t.ToString())
+}
+
+// Microseconds since the start of 1970.
+func timestampMicros(timestamp time.Time) int64 {
+	return timestamp.Unix()*1000000 + int64(timestamp.Nanosecond()/1000)
+}
+
+// Microseconds since the start of the timestamp's day.
+func clockMicros(timestamp time.Time) int64 {
+	hour, minute, second := timestamp.Clock()
+	return int64(hour)*3600000000 + int64(minute)*60000000 +
+		int64(second)*1000000 + int64(timestamp.Nanosecond()/1000)
+}
+
+func startOfDay(timestamp time.Time) time.Time {
+	year, month, day := timestamp.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+// Adds an interval to a timestamp. Months are added first, keeping the day of
+// the month unless the new month is too short, so a month after January 31 is
+// the last day of February.
+func addInterval(timestamp time.Time, interval IntervalValue) (time.Time, bool) {
+	days := interval.Days + interval.Micros/microsPerDay
+	if math.Abs(float64(interval.Months)) > 12*10000 || math.Abs(float64(days)) > 366*10000 {
+		return timestamp, false
+	}
+
+	year, month, day := timestamp.Date()
+	months := int64(year)*12 + int64(month) - 1 + interval.Months
+	year, month = int(months/12), time.Month(months%12+1)
+	if lastDay := daysIn(year, month); day > lastDay {
+		day = lastDay
+	}
+	hour, minute, second := timestamp.Clock()
+	timestamp = time.Date(year, month, day, hour, minute, second, timestamp.Nanosecond(), time.UTC)
+
+	timestamp = timestamp.AddDate(0, 0, int(days))
+	timestamp = timestamp.Add(time.Duration(interval.Micros%microsPerDay) * time.Microsecond)
+	return timestamp, inTimestampRange(timestamp)
+}
+
+func daysIn(year int, month time.Month) int {
+	return time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
+
+// Result type of arithmetic on dates, times, timestamps and intervals, or nil
+// if neither operand is one. Dates and integers add as days, dates and times
+// add up to timestamps, and subtracting two dates gives the days between them
+// while subtracting two times or timestamps gives an interval. Intervals can be
+// added to dates, times and timestamps, and multiplied and divided by numbers.
+// Gives Null for any other arithmetic.
+func temporalResultType(operator string, left Type, right Type) Type {
+	if !isTemporal(left) && !isTemporal(right) {
+		return nil
+	}
+	if (operator == "+" || operator == "*") && temporalRank(left) > temporalRank(right) {
+		left, right = right, left
+	}
+	additive := operator == "+" || operator == "-"
+
+	switch left := left.(type) {
+	case Date:
+		switch right.(type) {
+		case Int:
+			if additive {
+				return Date{}
+			}
+		case Date:
+			if operator == "-" {
+				return Int{}
+			}
+		case Interval:
+			if additive {
+				return Timestamp{}
+			}
+		case Time:
+			if operator == "+" {
+				return Timestamp{}
+			}
+		}
+	case Timestamp:
+		switch right.(type) {
+		case Interval:
+			if additive {
+				return left
+			}
+		case Timestamp, Date:
+			if operator == "-" {
+				return Interval{}
+			}
+		}
+	case Time:
+		switch right.(type) {
+		case Interval:
+			if additive {
+				return Time{}
+			}
+		case Time:
+			if operator == "-" {
+				return Interval{}
+			}
+		}
+	case Interval:
+		switch right.(type) {
+		case Interval:
+			if additive {
+				return Interval{}
+			}
+		case Int, Float, Decimal:
+			if operator == "*" || operator == "/" {
+				return Interval{}
+			}
+		}
+	}
+	return Null{}
+}
+
+// Order of the operands of `+` and `*`, which commute, so that dates and
+// timestamps come before times, times before intervals, and intervals before
+// numbers.
+func temporalRank(t Type) int {
+	switch t.(type) {
+	case Date, Timestamp:
+		return 0
+	case Time:
+		return 1
+	case Interval:
+		return 2
+	}
+	return 3
+}
+
+// Evaluates arithmetic on dates, times, timestamps and intervals, see
+// `temporalResultType`.
+func temporalArithmetic(operator string, left *Value, right *Value) (*Value, error) {
+	resultType := temporalResultType(operator, left.Type, right.Type)
+	if _, isNull := resultType.(Null); isNull {
+		return nil, fmt.Errorf(
+			"!Operator %v is not defined for types %v and %v.",
+			operator,
+			left.Type.ToString(),
+			right.Type.ToString(),
+		)
+	}
+	if (operator == "+" || operator == "*") && temporalRank(left.Type) > temporalRank(right.Type) {
+		left, right = right, left
+	}
+
+	var result interface{}
+	ok := true
+	switch l := left.Value.(type) {
+	case time.Time:
+		switch r := right.Value.(type) {
+		case int64:
+			if operator == "-" {
+				r = -r
+			}
+			result, ok = addInterval(l, IntervalValue{Days: r})
+		case IntervalValue:
+			if operator == "-" {
+				r = r.neg()
+			}
+			result, ok = addInterval(l, r)
+		case TimeOfDay:
+			result = l.Add(time.Duration(r) * time.Microsecond)
+		case time.Time:
+			micros := timestampMicros(l) - timestampMicros(r)
+			if _, isInt := resultType.(Int); isInt {
+				result = micros / microsPerDay
+			} else {
+				result = IntervalValue{Days: micros / microsPerDay, Micros: micros % microsPerDay}
+			}
+		}
+	case TimeOfDay:
+		switch r := right.Value.(type) {
+		case IntervalValue:
+			micros := r.Micros % microsPerDay
+			if operator == "-" {
+				micros = -micros
+			}
+			result = TimeOfDay((int64(l) + micros + microsPerDay) % microsPerDay)
+		case TimeOfDay:
+			result = IntervalValue{Micros: int64(l - r)}
+		}
+	case IntervalValue:
+		if r, isInterval := right.Value.(IntervalValue); isInterval {
+			if operator == "-" {
+				r = r.neg()
+			}
+			interval := IntervalValue{}
+			ok = interval.add(
+				float64(l.Months+r.Months),
+				float64(l.Days+r.Days),
+				float64(l.Micros)+float64(r.Micros),
+			)
+			result = interval
+			break
+		}
+
+		factor, _ := toFloat(right.Value)
+		if operator == "/" {
+			if factor == 0 {
+				return nil, fmt.Errorf("!Division by zero.")
+			}
+			factor = 1 / factor
+		}
+		interval := IntervalValue{}
+		ok = interval.add(
+			float64(l.Months)*factor,
+			float64(l.Days)*factor,
+			float64(l.Micros)*factor,
+		)
+		result = interval
+	}
+
+	if !ok {
+		return nil, fmt.Errorf("!Value out of range for type %v.", resultType.ToString())
+	}
+	return &Value{Value: result, Type: resultType}, nil
+}
+
+// Orders two dates, times, timestamps or intervals. Returns false if they
+// aren't of the same kind, where dates and timestamps are the same kind.
+func compareTemporal(left interface{}, right interface{}) (int, bool) {
+	switch l := left.(type) {
+	case time.Time:
+		if r, ok := right.(time.Time); ok {
+			if l.Before(r) {
+				return -1, true
+			} else if l.After(r) {
+				return 1, true
+			}
+			return 0, true
+		}
+	case TimeOfDay:
+		if r, ok := right.(TimeOfDay); ok {
+			if l < r {
+				return -1, true
+			} else if l > r {
+				return 1, true
+			}
+			return 0, true
+		}
+	case IntervalValue:
+		if r, ok := right.(IntervalValue); ok {
+			return l.span().Cmp(r.span()), true
+		}
+	}
+	return 0, false
+}
+
+// `EXTRACT(<field> FROM <expression>)`, which gets a field like the year or
+// hour of a date, time, timestamp or interval as a decimal.
+type ExtractExpression struct {
+	Field   string
+	Operand Expression
+}
+
+func (extract ExtractExpression) Evaluate(colMap map[string]int, row []Value) (*Value, error) {
+	value, err := extract.Operand.Evaluate(colMap, row)
+	if err != nil {
+		return nil, err
+	}
+	if value.Value == nil {
+		return value, nil
+	}
+
+	var field *big.Int
+	scale := 0
+	switch v := value.Value.(type) {
+	case time.Time:
+		field, scale = extractTimestampField(extract.Field, v)
+		if _, isDate := value.Type.(Date); isDate && extract.Field == "epoch" {
+			field, scale = big.NewInt(v.Unix()), 0
+		}
+	case TimeOfDay:
+		field, scale = extractClockField(extract.Field, int64(v))
+		if extract.Field == "epoch" {
+			field, scale = big.NewInt(int64(v)), 6
+		}
+	case IntervalValue:
+		field, scale = extractIntervalField(extract.Field, v)
+	default:
+		return nil, fmt.Errorf(
+			"!Cannot extract %v from %v.", extract.Field, value.ToString(),
+		)
+	}
+	if field == nil {
+		return nil, fmt.Errorf(
+			"!Field %v is not supported for type %v.",
+			extract.Field,
+			value.Type.ToString(),
+		)
+	}
+
+	return &Value{Value: DecimalValue{Unscaled: field, Scale: scale}, Type: Decimal{}}, nil
+}
+
+// Gets the hour, minute, second, millisecond or microsecond of a time of day,
+// given in microseconds since midnight. Returns nil for any other field.
+// Seconds and milliseconds include fractions of themselves.
+func extractClockField(field string, micros int64) (*big.Int, int) {
+	switch field {
+	case "hour":
+		return big.NewInt(micros / 3600000000), 0
+	case "minute":
+		return big.NewInt(micros / 60000000 % 60), 0
+	case "second":
+		return big.NewInt(micros % 60000000), 6
+	case "millisecond", "milliseconds":
+		return big.NewInt(micros % 60000000), 3
+	case "microsecond", "microseconds":
+		return big.NewInt(micros % 60000000), 0
+	}
+	return nil, 0
+}
+
+func extractTimestampField(field string, timestamp time.Time) (*big.Int, int) {
+	year := int64(timestamp.Year())
+	isoYear, isoWeek := timestamp.ISOWeek()
+	switch field {
+	case "millennium":
+		return big.NewInt((year + 999) / 1000), 0
+	case "century":
+		return big.NewInt((year + 99) / 100), 0
+	case "decade":
+		return big.NewInt(year / 10), 0
+	case "year":
+		return big.NewInt(year), 0
+	case "isoyear":
+		return big.NewInt(int64(isoYear)), 0
+	case "quarter":
+		return big.NewInt(int64(timestamp.Month()+2) / 3), 0
+	case "month":
+		return big.NewInt(int64(timestamp.Month())), 0
+	case "week":
+		return big.NewInt(int64(isoWeek)), 0
+	case "day":
+		return big.NewInt(int64(timestamp.Day())), 0
+	case "dow":
+		return big.NewInt(int64(timestamp.Weekday())), 0
+	case "isodow":
+		return big.NewInt(int64(timestamp.Weekday()+6)%7 + 1), 0
+	case "doy":
+		return big.NewInt(int64(timestamp.YearDay())), 0
+	case "epoch":
+		return big.NewInt(timestampMicros(timestamp)), 6
+	}
+	return extractClockField(field, clockMicros(timestamp))
+}
+
+func extractIntervalField(field string, interval IntervalValue) (*big.Int, int) {
+	switch field {
+	case "year":
+		return big.NewInt(interval.Months / 12), 0
+	case "month":
+		return big.NewInt(interval.Months % 12), 0
+	case "day":
+		return big.NewInt(interval.Days), 0
+	case "hour":
+		return big.NewInt(interval.Micros / 3600000000), 0
+	case "epoch":
+		// years count as 365.25 days, and other months as 30 days
+		days := new(big.Int).Mul(big.NewInt(interval.Months/12), big.NewInt(36525))
+		days.Add(days, big.NewInt((interval.Months%12*30+interval.Days)*100))
+		micros := days.Mul(days, big.NewInt(microsPerDay/100))
+		return micros.Add(micros, big.NewInt(interval.Micros)), 6
+	}
+	return extractClockField(field, interval.Micros%3600000000)
+}
+
+func (extract ExtractExpression) TypeOf(_ []Column) Type {
+	return Decimal{}
+}
+
+func (extract ExtractExpression) ToString() string {
+	return fmt.Sprintf("extract(%v from %v)", extract.Field, extract.Operand.ToString())
+}
+
+// Fields `date_trunc` can truncate to, from the smallest.
+var truncatableFields = []string{
+	"microseconds", "milliseconds", "second", "minute", "hour", "day", "week",
+	"month", "quarter", "year", "decade", "century", "millennium",
+}
+
+// Evaluates `now()`, the current time, and `date_trunc(<field>, <value>)`,
+// which truncates a date or timestamp to a precision like 'hour' or 'month'.
+// Returns false if `name` isn't one of these functions.
+func callTemporalFunction(name string, args []*Value) (*Value, bool, error) {
+	switch name {
+	case "now":
+		if len(args) != 0 {
+			return nil, true, fmt.Errorf("!Function now takes no arguments.")
+		}
+		now := time.Now().UTC().Truncate(time.Microsecond)
+		return &Value{Value: now, Type: Timestamp{WithTimeZone: true}}, true, nil
+	case "date_trunc":
+		if len(args) != 2 {
+			return nil, true, fmt.Errorf("!Function date_trunc takes 2 arguments.")
+		}
+	default:
+		return nil, false, nil
+	}
+
+	field, isString := args[0].Value.(string)
+	field = strings.ToLower(field)
+	if args[0].Value == nil || args[1].Value == nil {
+		return &Value{Value: nil, Type: Null{}}, true, nil
+	}
+	if !isString || !containsField(field) {
+		return nil, true, fmt.Errorf(
+			"!Expected one of %v as the field of date_trunc.",
+			strings.Join(truncatableFields, ", "),
+		)
+	}
+
+	resultType := dateTruncType(args[1].Type)
+	switch v := args[1].Value.(type) {
+	case time.Time:
+		return &Value{Value: truncateTimestamp(field, v), Type: resultType}, true, nil
+	case IntervalValue:
+		return &Value{Value: truncateInterval(field, v), Type: resultType}, true, nil
+	}
+	return nil, true, fmt.Errorf(
+		"!Function date_trunc requires a date, timestamp or interval.",
+	)
+}
+
+// Dates are truncated as timestamps at midnight.
+func dateTruncType(source Type) Type {
+	switch source := source.(type) {
+	case Timestamp, Interval:
+		return source
+	}
+	return Timestamp{}
+}
+
+func containsField(field string) bool {
+	for _, truncatable := range truncatableFields {
+		if field == truncatable {
+			return true
+		}
+	}
+	return false
+}
+
+func truncateTimestamp(field string, timestamp time.Time) time.Time {
+	year, month, day := timestamp.Date()
+	switch field {
+	case "microseconds":
+		return timestamp
+	case "milliseconds":
+		return timestamp.Truncate(time.Millisecond)
+	case "second":
+		return timestamp.Truncate(time.Second)
+	case "minute":
+		return timestamp.Truncate(time.Minute)
+	case "hour":
+		return timestamp.Truncate(time.Hour)
+	case "day":
+		return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	case "week":
+		// weeks start on Monday
+		monday := day - (int(timestamp.Weekday())+6)%7
+		return time.Date(year, month, monday, 0, 0, 0, 0, time.UTC)
+	case "month":
+		return time.Date(year, month, 1, 0, 0, 0, 0, time.UTC)
+	case "quarter":
+		return time.Date(year, (month-1)/3*3+1, 1, 0, 0, 0, 0, time.UTC)
+	case "year":
+		return time.Date(year, 1, 1, 0, 0, 0, 0, time.UTC)
+	case "decade":
+		return time.Date(year/10*10, 1, 1, 0, 0, 0, 0, time.UTC)
+	case "century":
+		return time.Date((year-1)/100*100+1, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	return time.Date((year-1)/1000*1000+1, 1, 1, 0, 0, 0, 0, time.UTC)
+}
+
+func truncateInterval(field string, interval IntervalValue) IntervalValue {
+	switch field {
+	case "microseconds":
+		return interval
+	case "milliseconds":
+		interval.Micros -= interval.Micros % 1000
+	case "second":
+		interval.Micros -= interval.Micros % 1000000
+	case "minute":
+		interval.Micros -= interval.Micros % 60000000
+	case "hour":
+		interval.Micros -= interval.Micros % 3600000000
+	case "day", "week":
+		interval.Micros = 0
+	case "month":
+		interval.Days, interval.Micros = 0, 0
+	case "quarter":
+		return IntervalValue{Months: interval.Months - interval.Months%3}
+	case "year":
+		return IntervalValue{Months: interval.Months - interval.Months%12}
+	case "decade":
+		return IntervalValue{Months: interval.Months - interval.Months%120}
+	case "century":
+		return IntervalValue{Months: interval.Months - interval.Months%1200}
+	case "millennium":
+		return IntervalValue{Months: interval.Months - interval.Months%12000}
+	}
+	return interval
+}
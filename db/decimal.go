@@ -0,0 +1,242 @@
+// sdb/db/decimal.go
+//
+// Exact decimal numbers, stored in `decimal(p, s)` and `numeric(p, s)` columns.
+// Unlike floats, decimals hold every number written with a decimal point
+// exactly, so sums of prices don't drift. Numeric literals with a decimal point
+// or exponent are decimals, converted when stored in float columns.
+
+package db
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Most digits a decimal type can have, before or after the decimal point.
+const MaxDecimalPrecision = 1000
+
+// Least number of digits after the decimal point kept when dividing decimals.
+const decimalDivisionScale = 20
+
+// Type of `decimal(p, s)` columns, holding numbers of up to `Precision` digits,
+// `Scale` of them after the decimal point. Values assigned to the column are
+// rounded to `Scale` digits. The zero value is an unconstrained decimal, the
+// type of decimal arithmetic.
+type Decimal struct {
+	Precision int
+	Scale     int
+}
+
+func (decimal Decimal) ToString() string {
+	if decimal.Precision == 0 {
+		return "decimal"
+	}
+	return fmt.Sprintf("decimal(%v, %v)", decimal.Precision, decimal.Scale)
+}
+
+// Rounds a number to the type's scale, returning false if it has too many
+// digits before the decimal point for the type.
+func (decimal Decimal) Round(number DecimalValue) (DecimalValue, bool) {
+	if decimal.Precision == 0 {
+		return number, number.integerDigits() <= MaxDecimalPrecision
+	}
+	rounded := number.Round(decimal.Scale)
+	return rounded, rounded.integerDigits() <= decimal.Precision-decimal.Scale
+}
+
+// Exact decimal number, `Unscaled` * 10^-`Scale`. Decimals are never changed
+// once made, so copies can share `Unscaled`.
+type DecimalValue struct {
+	Unscaled *big.Int
+	Scale    int
+}
+
+// Parses a numeric literal, like `-12.50` or `1.5e3`, as scanned by
+// `utils.ScanNumber`.
+func ParseDecimal(literal string) (DecimalValue, error) {
+	mantissa := literal
+	exponent := 0
+	if idx := strings.IndexAny(literal, "eE"); idx >= 0 {
+		mantissa = literal[:idx]
+		var err error
+		exponent, err = strconv.Atoi(literal[idx+1:])
+		if err != nil || exponent > MaxDecimalPrecision || exponent < -MaxDecimalPrecision {
+			return DecimalValue{}, fmt.Errorf("!Number %v is out of range for type decimal.", literal)
+		}
+	}
+
+	fraction := ""
+	if idx := strings.Index(mantissa, "."); idx >= 0 {
+		fraction = mantissa[idx+1:]
+		mantissa = mantissa[:idx]
+	}
+	unscaled, ok := new(big.Int).SetString(mantissa+fraction, 10)
+	if !ok {
+		return DecimalValue{}, fmt.Errorf("!Invalid number %v.", literal)
+	}
+
+	number := DecimalValue{Unscaled: unscaled, Scale: len(fraction) - exponent}
+	if number.Scale < 0 {
+		number = number.Round(0)
+	}
+	return number, nil
+}
+
+func DecimalFromInt(integer int64) DecimalValue {
+	return DecimalValue{Unscaled: big.NewInt(integer)}
+}
+
+// Converts a float to the decimal with the fewest digits that reads back as
+// the same float, so `19.99` becomes 19.99 rather than the float's exact value
+// 19.989999999999998436805981327779591083526611328125.
+func DecimalFromFloat(float float64) DecimalValue {
+	number, _ := ParseDecimal(strconv.FormatFloat(float, 'e', -1, 64))
+	return number
+}
+
+// Converts a float to the decimal with exactly its value. Every float is a
+// fraction with a power of 2 as its denominator, and so has a finite decimal
+// expansion.
+func exactDecimalFromFloat(float float64) DecimalValue {
+	fraction := new(big.Rat).SetFloat64(float)
+	scale := fraction.Denom().BitLen() - 1
+	five := new(big.Int).Exp(big.NewInt(5), big.NewInt(int64(scale)), nil)
+	return DecimalValue{Unscaled: five.Mul(five, fraction.Num()), Scale: scale}
+}
+
+// Converts an int, float or decimal value to a decimal, see `DecimalFromFloat`.
+func ToDecimal(value interface{}) (DecimalValue, bool) {
+	switch v := value.(type) {
+	case int64:
+		return DecimalFromInt(v), true
+	case float64:
+		return DecimalFromFloat(v), true
+	case DecimalValue:
+		return v, true
+	}
+	return DecimalValue{}, false
+}
+
+func (number DecimalValue) rat() *big.Rat {
+	return new(big.Rat).SetFrac(number.Unscaled, pow10(number.Scale))
+}
+
+func pow10(exponent int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(exponent)), nil)
+}
+
+// Rounds a fraction to `scale` digits after the decimal point, with halves
+// rounded away from zero.
+func roundRat(fraction *big.Rat, scale int) DecimalValue {
+	numerator := new(big.Int).Mul(fraction.Num(), pow10(scale))
+	quotient, remainder := new(big.Int).QuoRem(numerator, fraction.Denom(), new(big.Int))
+
+	doubled := new(big.Int).Abs(remainder)
+	doubled.Lsh(doubled, 1)
+	if doubled.Cmp(fraction.Denom()) >= 0 {
+		quotient.Add(quotient, big.NewInt(int64(numerator.Sign())))
+	}
+	return DecimalValue{Unscaled: quotient, Scale: scale}
+}
+
+// Rounds the number to `scale` digits after the decimal point, or pads it with
+// zeros to `scale` digits.
+func (number DecimalValue) Round(scale int) DecimalValue {
+	if scale >= number.Scale {
+		padding := pow10(scale - number.Scale)
+		return DecimalValue{Unscaled: padding.Mul(padding, number.Unscaled), Scale: scale}
+	}
+	return roundRat(number.rat(), scale)
+}
+
+// Number of digits before the decimal point, not counting leading zeros.
+func (number DecimalValue) integerDigits() int {
+	if number.Unscaled.Sign() == 0 {
+		return 0
+	}
+	return len(new(big.Int).Abs(number.Unscaled).String()) - number.Scale
+}
+
+func (number DecimalValue) Cmp(other DecimalValue) int {
+	return number.rat().Cmp(other.rat())
+}
+
+func (number DecimalValue) Sign() int {
+	return number.Unscaled.Sign()
+}
+
+func (number DecimalValue) Neg() DecimalValue {
+	return DecimalValue{Unscaled: new(big.Int).Neg(number.Unscaled), Scale: number.Scale}
+}
+
+// The float nearest to the number. Returns false if the number is too large
+// for a float.
+func (number DecimalValue) Float64() (float64, bool) {
+	float, err := strconv.ParseFloat(number.String(), 64)
+	return float, err == nil
+}
+
+func (number DecimalValue) String() string {
+	digits := new(big.Int).Abs(number.Unscaled).String()
+	if number.Scale > 0 {
+		if len(digits) <= number.Scale {
+			digits = strings.Repeat("0", number.Scale-len(digits)+1) + digits
+		}
+		point := len(digits) - number.Scale
+		digits = digits[:point] + "." + digits[point:]
+	}
+	if number.Unscaled.Sign() < 0 {
+		return "-" + digits
+	}
+	return digits
+}
+
+// Arithmetic between two decimals. Sums, differences and products are exact,
+// while quotients are rounded to `decimalDivisionScale` digits after the
+// decimal point, or the scale of either operand if larger.
+func decimalArithmetic(operator string, left DecimalValue, right DecimalValue) (*Value, error) {
+	var result DecimalValue
+	switch operator {
+	case "+", "-":
+		scale := left.Scale
+		if right.Scale > scale {
+			scale = right.Scale
+		}
+		leftUnscaled := left.Round(scale).Unscaled
+		rightUnscaled := right.Round(scale).Unscaled
+		unscaled := new(big.Int)
+		if operator == "+" {
+			unscaled.Add(leftUnscaled, rightUnscaled)
+		} else {
+			unscaled.Sub(leftUnscaled, rightUnscaled)
+		}
+		result = DecimalValue{Unscaled: unscaled, Scale: scale}
+	case "*":
+		unscaled := new(big.Int).Mul(left.Unscaled, right.Unscaled)
+		result = DecimalValue{Unscaled: unscaled, Scale: left.Scale + right.Scale}
+	case "/":
+		if right.Sign() == 0 {
+			return nil, fmt.Errorf("!Division by zero.")
+		}
+		scale := decimalDivisionScale
+		if left.Scale > scale {
+			scale = left.Scale
+		}
+		if right.Scale > scale {
+			scale = right.Scale
+		}
+		result = roundRat(new(big.Rat).Quo(left.rat(), right.rat()), scale)
+	default:
+		return nil, fmt.Errorf("!Unknown operator %v.", operator)
+	}
+
+	if result.Scale > MaxDecimalPrecision {
+		result = result.Round(MaxDecimalPrecision)
+	}
+	if result.integerDigits() > MaxDecimalPrecision {
+		return nil, fmt.Errorf("!Decimal out of range.")
+	}
+	return &Value{Value: result, Type: Decimal{}}, nil
+}
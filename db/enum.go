@@ -0,0 +1,65 @@
+// sdb/db/enum.go
+//
+// Enum types, created by `CREATE TYPE <name> AS ENUM ('<label>', ...)`. The
+// values of an enum are its labels, ordered the way they were declared.
+
+package db
+
+import "fmt"
+
+// Type of a column of an enum type. The parser only knows the name of the
+// type, so the labels are filled in from the catalog, see `ResolveType`.
+type Enum struct {
+	Name   string
+	Labels []string
+}
+
+func (enum Enum) ToString() string {
+	return enum.Name
+}
+
+// Value of an enum, along with the position of its label in the declaration,
+// which values are ordered by.
+type EnumValue struct {
+	Label    string
+	Position int
+}
+
+// Gets the value of the enum with the given label, failing if the enum
+// doesn't have that label.
+func (enum Enum) Value(label string) (Value, error) {
+	for position, enumLabel := range enum.Labels {
+		if enumLabel == label {
+			return Value{Value: EnumValue{Label: label, Position: position}, Type: enum}, nil
+		}
+	}
+	return Value{}, fmt.Errorf(
+		"!Invalid input value for enum %v: %v.", enum.Name, quoteString(label),
+	)
+}
+
+// Gives an enum type the labels of the type of that name in the catalog.
+// Other types are returned as they are.
+func (catalog *Catalog) ResolveType(t Type) (Type, error) {
+	enum, isEnum := t.(Enum)
+	if !isEnum {
+		return t, nil
+	}
+	declared, exists := catalog.Types[enum.Name]
+	if !exists {
+		return nil, fmt.Errorf("!Type %v does not exist.", enum.Name)
+	}
+	return declared, nil
+}
+
+// Resolves the type of each column, see `ResolveType`.
+func (catalog *Catalog) ResolveColumnTypes(columns []Column) error {
+	for idx := range columns {
+		resolved, err := catalog.ResolveType(columns[idx].Type)
+		if err != nil {
+			return err
+		}
+		columns[idx].Type = resolved
+	}
+	return nil
+}
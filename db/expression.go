@@ -0,0 +1,872 @@
+// sdb/db/expression.go
+//
+// Contains the types for expressions that can be evaluated against a row of a
+// table, like `price * 2` or `name`. Expressions are parsed in
+// `utils.ParseExpression` and evaluated by the statements that use them.
+
+package db
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// All expressions implement this interface. `Evaluate` computes the value of
+// the expression for a single row, where `colMap` maps column names to their
+// index in `row`. `TypeOf` gives the type the expression will evaluate to for
+// a table with the given columns, and `ToString` gives the expression as it
+// would be written in a query.
+type Expression interface {
+	Evaluate(colMap map[string]int, row []Value) (*Value, error)
+	TypeOf(columns []Column) Type
+	ToString() string
+}
+
+// Reference to the value of a column in the current row.
+type ColumnRef struct {
+	Name string
+}
+
+func (ref ColumnRef) Evaluate(colMap map[string]int, row []Value) (*Value, error) {
+	idx, ok := colMap[ref.Name]
+	if !ok || idx >= len(row) {
+		return nil, fmt.Errorf("!Column %v does not exist.", ref.Name)
+	}
+
+	value := row[idx]
+	return &value, nil
+}
+
+func (ref ColumnRef) TypeOf(columns []Column) Type {
+	for _, column := range columns {
+		if column.Name == ref.Name {
+			return column.Type
+		}
+	}
+	return Null{}
+}
+
+func (ref ColumnRef) ToString() string {
+	return ref.Name
+}
+
+// Constant value written directly in the query, like `3.14` or `'hello'`.
+// `Text` is a number as it was written, like `1e400`, or "" for any other
+// literal.
+type Literal struct {
+	Value Value
+	Text  string
+}
+
+func (literal Literal) Evaluate(_ map[string]int, _ []Value) (*Value, error) {
+	value := literal.Value
+	return &value, nil
+}
+
+func (literal Literal) TypeOf(_ []Column) Type {
+	return literal.Value.Type
+}
+
+func (literal Literal) ToString() string {
+	if literal.Text != "" {
+		return literal.Text
+	}
+	// temporal literals are written with their type, so they aren't parsed
+	// back as strings
+	if isTemporal(literal.Value.Type) {
+		return literal.Value.Type.ToString() + " " + literal.Value.ToString()
+	}
+	return literal.Value.ToString()
+}
+
+// Arithmetic between two numeric expressions, e.g. `price * 2`. `Operator` is
+// one of `+`, `-`, `*`, or `/`.
+type BinaryExpression struct {
+	Operator string
+	Left     Expression
+	Right    Expression
+}
+
+func (binary BinaryExpression) Evaluate(colMap map[string]int, row []Value) (*Value, error) {
+	left, err := binary.Left.Evaluate(colMap, row)
+	if err != nil {
+		return nil, err
+	}
+	right, err := binary.Right.Evaluate(colMap, row)
+	if err != nil {
+		return nil, err
+	}
+
+	// arithmetic with NULL is always NULL
+	if left.Value == nil || right.Value == nil {
+		return &Value{Value: nil, Type: Null{}}, nil
+	}
+
+	if isTemporal(left.Type) || isTemporal(right.Type) {
+		return temporalArithmetic(binary.Operator, left, right)
+	}
+
+	switch resultType := binaryResultType(left.Type, right.Type).(type) {
+	case Int:
+		leftInt, leftOk := left.Value.(int64)
+		rightInt, rightOk := right.Value.(int64)
+		if leftOk && rightOk {
+			return intArithmetic(binary.Operator, leftInt, rightInt, resultType)
+		}
+	case Decimal:
+		leftDecimal, leftOk := ToDecimal(left.Value)
+		rightDecimal, rightOk := ToDecimal(right.Value)
+		if leftOk && rightOk {
+			return decimalArithmetic(binary.Operator, leftDecimal, rightDecimal)
+		}
+	}
+
+	leftNum, leftOk := toFloat(left.Value)
+	rightNum, rightOk := toFloat(right.Value)
+	if !leftOk || !rightOk {
+		return nil, fmt.Errorf(
+			"!Operator %v requires numeric operands.", binary.Operator,
+		)
+	}
+
+	var result float64
+	switch binary.Operator {
+	case "+":
+		result = leftNum + rightNum
+	case "-":
+		result = leftNum - rightNum
+	case "*":
+		result = leftNum * rightNum
+	case "/":
+		if rightNum == 0 {
+			return nil, fmt.Errorf("!Division by zero.")
+		}
+		result = leftNum / rightNum
+	default:
+		return nil, fmt.Errorf("!Unknown operator %v.", binary.Operator)
+	}
+
+	// infinities couldn't be written to the table file and read back
+	if math.IsInf(result, 0) || math.IsNaN(result) {
+		return nil, fmt.Errorf("!Float out of range.")
+	}
+	return &Value{Value: result, Type: Float{}}, nil
+}
+
+// Arithmetic between two ints, failing if the result doesn't fit in
+// `resultType`. Integer division truncates.
+func intArithmetic(operator string, left int64, right int64, resultType Int) (*Value, error) {
+	var result int64
+	overflow := false
+	switch operator {
+	case "+":
+		result = left + right
+		overflow = (right > 0) != (result > left)
+	case "-":
+		result = left - right
+		overflow = (right > 0) != (result < left)
+	case "*":
+		result = left * right
+		overflow = left != 0 &&
+			(result/left != right || left == -1 && right == math.MinInt64)
+	case "/":
+		if right == 0 {
+			return nil, fmt.Errorf("!Division by zero.")
+		}
+		overflow = left == math.MinInt64 && right == -1
+		if !overflow {
+			result = left / right
+		}
+	default:
+		return nil, fmt.Errorf("!Unknown operator %v.", operator)
+	}
+
+	if overflow || !resultType.Contains(result) {
+		return nil, fmt.Errorf("!Integer out of range for type %v.", resultType.ToString())
+	}
+	return &Value{Value: result, Type: resultType}, nil
+}
+
+// Gets a numeric value as a float, converting ints.
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case int64:
+		return float64(v), true
+	case DecimalValue:
+		// too large decimals become infinities, which arithmetic rejects
+		float, _ := v.Float64()
+		return float, true
+	}
+	return 0, false
+}
+
+func (binary BinaryExpression) TypeOf(columns []Column) Type {
+	left := binary.Left.TypeOf(columns)
+	right := binary.Right.TypeOf(columns)
+	if resultType := temporalResultType(binary.Operator, left, right); resultType != nil {
+		return resultType
+	}
+	return binaryResultType(left, right)
+}
+
+func (binary BinaryExpression) ToString() string {
+	return binaryToString(binary, binary.Operator, binary.Left, binary.Right)
+}
+
+// Arithmetic between two ints stays an int, as wide as the wider of the two,
+// arithmetic between decimals and ints is exact and gives a decimal, and
+// anything involving a float is promoted to a float.
+func binaryResultType(left Type, right Type) Type {
+	leftInt, leftOk := left.(Int)
+	rightInt, rightOk := right.(Int)
+	if leftOk && rightOk {
+		_, leftMax := leftInt.Range()
+		_, rightMax := rightInt.Range()
+		if rightMax > leftMax {
+			return rightInt
+		}
+		return leftInt
+	}
+
+	_, leftDecimal := left.(Decimal)
+	_, rightDecimal := right.(Decimal)
+	if (leftOk || leftDecimal) && (rightOk || rightDecimal) {
+		return Decimal{}
+	}
+	return Float{}
+}
+
+// Negation of a numeric expression, e.g. `-price`.
+type NegateExpression struct {
+	Operand Expression
+}
+
+func (negate NegateExpression) Evaluate(colMap map[string]int, row []Value) (*Value, error) {
+	value, err := negate.Operand.Evaluate(colMap, row)
+	if err != nil {
+		return nil, err
+	}
+	if value.Value == nil {
+		return value, nil
+	}
+
+	switch num := value.Value.(type) {
+	case float64:
+		return &Value{Value: -num, Type: value.Type}, nil
+	case int64:
+		intType, _ := value.Type.(Int)
+		if num == math.MinInt64 || !intType.Contains(-num) {
+			return nil, fmt.Errorf("!Integer out of range for type %v.", intType.ToString())
+		}
+		return &Value{Value: -num, Type: value.Type}, nil
+	case DecimalValue:
+		return &Value{Value: num.Neg(), Type: value.Type}, nil
+	case IntervalValue:
+		return &Value{Value: num.neg(), Type: value.Type}, nil
+	}
+	return nil, fmt.Errorf("!Operator - requires a numeric operand.")
+}
+
+func (negate NegateExpression) TypeOf(columns []Column) Type {
+	return negate.Operand.TypeOf(columns)
+}
+
+func (negate NegateExpression) ToString() string {
+	return "-" + parenthesize(negate.Operand, precedence(negate))
+}
+
+// Comparison between two expressions, e.g. `price > 10`. `Operator` is one of
+// `=`, `!=`, `<`, `<=`, `>`, or `>=`. Evaluates to NULL if either side is NULL.
+type ComparisonExpression struct {
+	Operator string
+	Left     Expression
+	Right    Expression
+}
+
+func (comparison ComparisonExpression) Evaluate(colMap map[string]int, row []Value) (*Value, error) {
+	left, err := comparison.Left.Evaluate(colMap, row)
+	if err != nil {
+		return nil, err
+	}
+	right, err := comparison.Right.Evaluate(colMap, row)
+	if err != nil {
+		return nil, err
+	}
+
+	if left.Value == nil || right.Value == nil {
+		return &Value{Value: nil, Type: Null{}}, nil
+	}
+
+	order, err := CompareValues(left, right)
+	if err != nil {
+		return nil, err
+	}
+
+	var result bool
+	switch comparison.Operator {
+	case "=":
+		result = order == 0
+	case "!=":
+		result = order != 0
+	case "<":
+		result = order < 0
+	case "<=":
+		result = order <= 0
+	case ">":
+		result = order > 0
+	case ">=":
+		result = order >= 0
+	default:
+		return nil, fmt.Errorf("!Unknown operator %v.", comparison.Operator)
+	}
+
+	value := BoolValue(result)
+	return &value, nil
+}
+
+func (comparison ComparisonExpression) TypeOf(_ []Column) Type {
+	return BoolValue(true).Type
+}
+
+func (comparison ComparisonExpression) ToString() string {
+	return binaryToString(
+		comparison, comparison.Operator, comparison.Left, comparison.Right,
+	)
+}
+
+// Logical `and`/`or` of two expressions, using SQL's three-valued logic where
+// NULL represents an unknown truth value.
+type LogicalExpression struct {
+	Operator string
+	Left     Expression
+	Right    Expression
+}
+
+func (logical LogicalExpression) Evaluate(colMap map[string]int, row []Value) (*Value, error) {
+	left, err := logical.Left.Evaluate(colMap, row)
+	if err != nil {
+		return nil, err
+	}
+	right, err := logical.Right.Evaluate(colMap, row)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = CheckBoolean(left, logical.Operator); err != nil {
+		return nil, err
+	}
+	if err = CheckBoolean(right, logical.Operator); err != nil {
+		return nil, err
+	}
+
+	leftUnknown := left.Value == nil
+	rightUnknown := right.Value == nil
+
+	var value Value
+	if logical.Operator == "and" {
+		if (!leftUnknown && !IsTrue(left)) || (!rightUnknown && !IsTrue(right)) {
+			value = BoolValue(false)
+		} else if leftUnknown || rightUnknown {
+			value = Value{Value: nil, Type: Null{}}
+		} else {
+			value = BoolValue(true)
+		}
+	} else {
+		if IsTrue(left) || IsTrue(right) {
+			value = BoolValue(true)
+		} else if leftUnknown || rightUnknown {
+			value = Value{Value: nil, Type: Null{}}
+		} else {
+			value = BoolValue(false)
+		}
+	}
+
+	return &value, nil
+}
+
+func (logical LogicalExpression) TypeOf(_ []Column) Type {
+	return BoolValue(true).Type
+}
+
+func (logical LogicalExpression) ToString() string {
+	return binaryToString(logical, logical.Operator, logical.Left, logical.Right)
+}
+
+// Logical negation, e.g. `not price > 10`.
+type NotExpression struct {
+	Operand Expression
+}
+
+func (not NotExpression) Evaluate(colMap map[string]int, row []Value) (*Value, error) {
+	value, err := not.Operand.Evaluate(colMap, row)
+	if err != nil {
+		return nil, err
+	}
+	if err = CheckBoolean(value, "not"); err != nil {
+		return nil, err
+	}
+	if value.Value == nil {
+		return value, nil
+	}
+
+	result := BoolValue(!IsTrue(value))
+	return &result, nil
+}
+
+func (not NotExpression) TypeOf(_ []Column) Type {
+	return BoolValue(true).Type
+}
+
+func (not NotExpression) ToString() string {
+	return "not " + parenthesize(not.Operand, precedence(not))
+}
+
+// Tests if an expression is NULL, e.g. `name is null` or `name is not null`.
+type IsNullExpression struct {
+	Operand Expression
+	Negated bool
+}
+
+func (isNull IsNullExpression) Evaluate(colMap map[string]int, row []Value) (*Value, error) {
+	value, err := isNull.Operand.Evaluate(colMap, row)
+	if err != nil {
+		return nil, err
+	}
+
+	result := BoolValue((value.Value == nil) != isNull.Negated)
+	return &result, nil
+}
+
+func (isNull IsNullExpression) TypeOf(_ []Column) Type {
+	return BoolValue(true).Type
+}
+
+func (isNull IsNullExpression) ToString() string {
+	operand := parenthesize(isNull.Operand, precedence(isNull))
+	if isNull.Negated {
+		return operand + " is not null"
+	}
+	return operand + " is null"
+}
+
+// Call of a function by name, like `nextval('ids')`.
+type FunctionCall struct {
+	Name string
+	Args []Expression
+}
+
+// Sequence functions need the database state, so statements replace calls to
+// them with their results before evaluating an expression, see
+// `statements.resolveSequenceCalls`.
+func (call FunctionCall) Evaluate(colMap map[string]int, row []Value) (*Value, error) {
+	if IsSequenceFunction(call.Name) {
+		return nil, fmt.Errorf(
+			"!Function %v can only be used in DEFAULT expressions, inserted "+
+				"values, updated values and selected values.",
+			call.Name,
+		)
+	}
+
+	args := make([]*Value, len(call.Args))
+	for idx, arg := range call.Args {
+		value, err := arg.Evaluate(colMap, row)
+		if err != nil {
+			return nil, err
+		}
+		args[idx] = value
+	}
+	if result, ok, err := callTemporalFunction(call.Name, args); ok {
+		return result, err
+	}
+	if result, ok, err := callJSONFunction(call.Name, args); ok {
+		return result, err
+	}
+	if result, ok, err := callUUIDFunction(call.Name, args); ok {
+		return result, err
+	}
+	return nil, fmt.Errorf("!Function %v does not exist.", call.Name)
+}
+
+func (call FunctionCall) TypeOf(columns []Column) Type {
+	if IsSequenceFunction(call.Name) {
+		return Int{Size: 8}
+	}
+	switch call.Name {
+	case "now":
+		return Timestamp{WithTimeZone: true}
+	case "date_trunc":
+		if len(call.Args) == 2 {
+			return dateTruncType(call.Args[1].TypeOf(columns))
+		}
+	case "json_extract":
+		return JSON{}
+	case "gen_random_uuid":
+		return UUID{}
+	}
+	return Null{}
+}
+
+func (call FunctionCall) ToString() string {
+	args := make([]string, len(call.Args))
+	for idx, arg := range call.Args {
+		args[idx] = arg.ToString()
+	}
+	return fmt.Sprintf("%v(%v)", call.Name, strings.Join(args, ", "))
+}
+
+func IsSequenceFunction(name string) bool {
+	return name == "nextval" || name == "currval"
+}
+
+// Converts a Go bool to the value a predicate evaluates to.
+func BoolValue(b bool) Value {
+	return Value{Value: b, Type: Boolean{}}
+}
+
+// Determines if the value of a predicate is true. NULL is never true.
+func IsTrue(value *Value) bool {
+	b, ok := value.Value.(bool)
+	return ok && b
+}
+
+// Fails unless a value used as a condition, like the operand of `not` or the
+// condition of a WHERE clause, is a boolean or NULL. Numbers and strings
+// aren't true or false.
+func CheckBoolean(value *Value, usedBy string) error {
+	if _, ok := value.Value.(bool); ok || value.Value == nil {
+		return nil
+	}
+	return fmt.Errorf(
+		"!Argument of %v must be a boolean, not %v.", usedBy, value.Type.ToString(),
+	)
+}
+
+// Reads a string compared with a value of type `other` as a literal of that
+// type, as in `WHERE day > '2021-05-01'` or `WHERE mood = 'happy'`, see
+// `ParseAs`. Other values, and strings that aren't literals of the type, are
+// left as they are.
+func coerceString(value *Value, other Type) *Value {
+	text, isString := value.Value.(string)
+	if !isString {
+		return value
+	}
+	if parsed, ok, err := ParseAs(text, other); ok && err == nil {
+		return &parsed
+	}
+	return value
+}
+
+// Orders two non-NULL values, returning a negative number if `left` comes
+// before `right`, 0 if they are equal, and a positive number otherwise. Values
+// must both be numeric, both be strings, both be blobs, or both be booleans,
+// where false comes before true, or both be dates, times, timestamps or
+// intervals, or both be JSON documents, see `compareJSON`, or both be UUIDs,
+// or both be values of the same enum, ordered by declaration. Strings compared
+// with values written as strings are read as literals of their type, see
+// `coerceString`.
+func CompareValues(left *Value, right *Value) (int, error) {
+	left, right = coerceString(left, right.Type), coerceString(right, left.Type)
+	if order, ok := compareTemporal(left.Value, right.Value); ok {
+		return order, nil
+	}
+
+	switch l := left.Value.(type) {
+	case int64:
+		r, ok := right.Value.(int64)
+		if !ok {
+			break
+		}
+		if l < r {
+			return -1, nil
+		} else if l > r {
+			return 1, nil
+		}
+		return 0, nil
+	case float64:
+		r, ok := right.Value.(float64)
+		if !ok {
+			break
+		}
+		if l < r {
+			return -1, nil
+		} else if l > r {
+			return 1, nil
+		}
+		return 0, nil
+	case string:
+		r, ok := right.Value.(string)
+		if !ok {
+			break
+		}
+		return strings.Compare(l, r), nil
+	case BlobValue:
+		r, ok := right.Value.(BlobValue)
+		if !ok {
+			break
+		}
+		return strings.Compare(string(l), string(r)), nil
+	case JSONValue:
+		r, ok := right.Value.(JSONValue)
+		if !ok {
+			break
+		}
+		return compareJSON(l, r), nil
+	case UUIDValue:
+		r, ok := right.Value.(UUIDValue)
+		if !ok {
+			break
+		}
+		return bytes.Compare(l[:], r[:]), nil
+	case EnumValue:
+		r, ok := right.Value.(EnumValue)
+		if !ok || left.Type.ToString() != right.Type.ToString() {
+			break
+		}
+		return l.Position - r.Position, nil
+	case bool:
+		r, ok := right.Value.(bool)
+		if !ok {
+			break
+		}
+		if l == r {
+			return 0, nil
+		} else if r {
+			return -1, nil
+		}
+		return 1, nil
+	}
+
+	// decimals are compared with ints exactly, and with floats as the shortest
+	// decimal that reads back as the float, see `DecimalFromFloat`
+	if leftDecimal, ok := left.Value.(DecimalValue); ok {
+		if rightDecimal, ok := ToDecimal(right.Value); ok {
+			return leftDecimal.Cmp(rightDecimal), nil
+		}
+	} else if rightDecimal, ok := right.Value.(DecimalValue); ok {
+		if leftDecimal, ok := ToDecimal(left.Value); ok {
+			return leftDecimal.Cmp(rightDecimal), nil
+		}
+	}
+
+	// ints are compared with floats exactly, rather than as converted floats
+	leftInt, leftIsInt := left.Value.(int64)
+	rightInt, rightIsInt := right.Value.(int64)
+	leftFloat, leftIsFloat := left.Value.(float64)
+	rightFloat, rightIsFloat := right.Value.(float64)
+	if leftIsInt && rightIsFloat {
+		return compareIntFloat(leftInt, rightFloat), nil
+	} else if leftIsFloat && rightIsInt {
+		return -compareIntFloat(rightInt, leftFloat), nil
+	}
+
+	return 0, fmt.Errorf(
+		"!Cannot compare %v with %v.", left.ToString(), right.ToString(),
+	)
+}
+
+func compareIntFloat(integer int64, float float64) int {
+	// float64(math.MaxInt64) rounds up to 2^63, past every int64
+	if float >= math.MaxInt64 {
+		return -1
+	} else if float < math.MinInt64 {
+		return 1
+	}
+
+	whole := math.Trunc(float)
+	if integer < int64(whole) {
+		return -1
+	} else if integer > int64(whole) {
+		return 1
+	} else if float > whole {
+		return -1
+	} else if float < whole {
+		return 1
+	}
+	return 0
+}
+
+// Binding strength of an expression's operator, used to decide where
+// parentheses are needed when writing an expression back out as a string.
+func precedence(expression Expression) int {
+	switch e := expression.(type) {
+	case LogicalExpression:
+		if e.Operator == "or" {
+			return 1
+		}
+		return 2
+	case NotExpression:
+		return 3
+	case ComparisonExpression, IsNullExpression:
+		return 4
+	case JSONExpression:
+		if e.Operator == "?" {
+			return 4
+		}
+		return 8
+	case BinaryExpression:
+		if e.Operator == "+" || e.Operator == "-" {
+			return 5
+		}
+		return 6
+	case NegateExpression:
+		return 7
+	}
+	return 9
+}
+
+// Wraps the expression in parentheses if it binds looser than `parent`.
+func parenthesize(expression Expression, parent int) string {
+	if precedence(expression) < parent {
+		return "(" + expression.ToString() + ")"
+	}
+	return expression.ToString()
+}
+
+// Writes out a left-associative binary operator. The right operand is also
+// parenthesized at equal precedence so `a - (b - c)` keeps its meaning.
+func binaryToString(
+	expression Expression,
+	operator string,
+	left Expression,
+	right Expression,
+) string {
+	parent := precedence(expression)
+	rightString := right.ToString()
+	if precedence(right) <= parent {
+		rightString = "(" + rightString + ")"
+	}
+
+	return fmt.Sprintf(
+		"%v %v %v",
+		parenthesize(left, parent),
+		operator,
+		rightString,
+	)
+}
+
+// Rebuilds an expression from the bottom up, with every sub-expression
+// replaced by the result of `replace`.
+func MapExpression(
+	expression Expression,
+	replace func(Expression) (Expression, error),
+) (Expression, error) {
+	var err error
+	switch e := expression.(type) {
+	case BinaryExpression:
+		if e.Left, err = MapExpression(e.Left, replace); err != nil {
+			return nil, err
+		}
+		if e.Right, err = MapExpression(e.Right, replace); err != nil {
+			return nil, err
+		}
+		return replace(e)
+	case ComparisonExpression:
+		if e.Left, err = MapExpression(e.Left, replace); err != nil {
+			return nil, err
+		}
+		if e.Right, err = MapExpression(e.Right, replace); err != nil {
+			return nil, err
+		}
+		return replace(e)
+	case LogicalExpression:
+		if e.Left, err = MapExpression(e.Left, replace); err != nil {
+			return nil, err
+		}
+		if e.Right, err = MapExpression(e.Right, replace); err != nil {
+			return nil, err
+		}
+		return replace(e)
+	case NegateExpression:
+		if e.Operand, err = MapExpression(e.Operand, replace); err != nil {
+			return nil, err
+		}
+		return replace(e)
+	case NotExpression:
+		if e.Operand, err = MapExpression(e.Operand, replace); err != nil {
+			return nil, err
+		}
+		return replace(e)
+	case IsNullExpression:
+		if e.Operand, err = MapExpression(e.Operand, replace); err != nil {
+			return nil, err
+		}
+		return replace(e)
+	case ExtractExpression:
+		if e.Operand, err = MapExpression(e.Operand, replace); err != nil {
+			return nil, err
+		}
+		return replace(e)
+	case CastExpression:
+		if e.Operand, err = MapExpression(e.Operand, replace); err != nil {
+			return nil, err
+		}
+		return replace(e)
+	case JSONExpression:
+		if e.Left, err = MapExpression(e.Left, replace); err != nil {
+			return nil, err
+		}
+		if e.Right, err = MapExpression(e.Right, replace); err != nil {
+			return nil, err
+		}
+		return replace(e)
+	case AggregateCall:
+		if e.Arg != nil {
+			if e.Arg, err = MapExpression(e.Arg, replace); err != nil {
+				return nil, err
+			}
+		}
+		return replace(e)
+	case FunctionCall:
+		args := make([]Expression, len(e.Args))
+		for idx, arg := range e.Args {
+			if args[idx], err = MapExpression(arg, replace); err != nil {
+				return nil, err
+			}
+		}
+		e.Args = args
+		return replace(e)
+	}
+	return replace(expression)
+}
+
+// Rebuilds an expression with every column reference replaced by the result of
+// `replace`. Used to rename columns referenced by constraints.
+func ReplaceColumnRefs(
+	expression Expression,
+	replace func(ColumnRef) Expression,
+) Expression {
+	replaced, _ := MapExpression(expression, func(e Expression) (Expression, error) {
+		if ref, ok := e.(ColumnRef); ok {
+			return replace(ref), nil
+		}
+		return e, nil
+	})
+	return replaced
+}
+
+// Gets the names of the columns an expression references, in the order they
+// appear.
+func ReferencedColumns(expression Expression) []string {
+	var colNames []string
+	ReplaceColumnRefs(expression, func(ref ColumnRef) Expression {
+		colNames = append(colNames, ref.Name)
+		return ref
+	})
+	return colNames
+}
+
+// Determines if an expression references the column `colName`.
+func ReferencesColumn(expression Expression, colName string) bool {
+	found := false
+	ReplaceColumnRefs(expression, func(ref ColumnRef) Expression {
+		if ref.Name == colName {
+			found = true
+		}
+		return ref
+	})
+	return found
+}
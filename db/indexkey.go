@@ -0,0 +1,206 @@
+// sdb/db/indexkey.go
+//
+// Encodes values as B+tree keys. Encoded keys compare with `bytes.Compare` in
+// the same order as the values they encode, so ranges of values map to ranges
+// of keys. Each value's encoding is self-delimiting, so the encoding of a list
+// of values is just their encodings concatenated.
+
+package db
+
+import (
+	"encoding/binary"
+	"math/big"
+	"strings"
+	"time"
+)
+
+const (
+	nullKeyTag      = 0x00
+	numberKeyTag    = 0x01
+	stringKeyTag    = 0x02
+	boolKeyTag      = 0x03
+	timestampKeyTag = 0x04 // also dates, which compare with timestamps
+	timeKeyTag      = 0x05
+	intervalKeyTag  = 0x06
+	blobKeyTag      = 0x07
+	jsonKeyTag      = 0x08 // only looked up by equality, see `compareJSON`
+	enumKeyTag      = 0x09
+	uuidKeyTag      = 0x0a
+)
+
+// Encodes a list of values as an index key. NULLs sort before numbers, numbers
+// sort before strings, and strings sort before booleans, which sort before
+// timestamps, times, intervals, blobs, JSON documents, enums and UUIDs. Enums
+// are encoded by the position of their label, so they sort in the order their
+// labels were declared.
+func EncodeIndexKey(values []Value) []byte {
+	var key []byte
+	for _, value := range values {
+		key = append(key, EncodeIndexValue(&value)...)
+	}
+	return key
+}
+
+func EncodeIndexValue(value *Value) []byte {
+	switch raw := value.GetValue().(type) {
+	case int64:
+		return encodeNumber(DecimalFromInt(raw))
+	case float64:
+		return encodeNumber(exactDecimalFromFloat(raw))
+	case DecimalValue:
+		return encodeNumber(raw)
+	case string:
+		return encodeBytes(stringKeyTag, raw)
+	case BlobValue:
+		return encodeBytes(blobKeyTag, string(raw))
+	case JSONValue:
+		return encodeBytes(jsonKeyTag, string(raw))
+	case UUIDValue:
+		return encodeBytes(uuidKeyTag, string(raw[:]))
+	case EnumValue:
+		return encodeTagged(enumKeyTag, big.NewInt(int64(raw.Position)))
+	case bool:
+		if raw {
+			return []byte{boolKeyTag, 0x01}
+		}
+		return []byte{boolKeyTag, 0x00}
+	case time.Time:
+		return encodeTagged(timestampKeyTag, big.NewInt(timestampMicros(raw)))
+	case TimeOfDay:
+		return encodeTagged(timeKeyTag, big.NewInt(int64(raw)))
+	case IntervalValue:
+		return encodeTagged(intervalKeyTag, raw.span())
+	}
+	return []byte{nullKeyTag}
+}
+
+// Determines if `value` is encoded with the same tag as values of type `t`, so
+// looking it up in the index of a column of that type finds the rows it
+// compares equal to. A value of another kind can't be compared with the
+// column's values at all.
+func IndexesAs(t Type, value *Value) bool {
+	var tag byte
+	switch t.(type) {
+	case Int, Float, Decimal:
+		tag = numberKeyTag
+	case Char, VarChar, Text:
+		tag = stringKeyTag
+	case Boolean:
+		tag = boolKeyTag
+	case Date, Timestamp:
+		tag = timestampKeyTag
+	case Time:
+		tag = timeKeyTag
+	case Interval:
+		tag = intervalKeyTag
+	case Blob:
+		tag = blobKeyTag
+	case JSON:
+		tag = jsonKeyTag
+	case Enum:
+		tag = enumKeyTag
+	case UUID:
+		tag = uuidKeyTag
+	default:
+		return false
+	}
+	return EncodeIndexValue(value)[0] == tag
+}
+
+// Strings and blobs are encoded by their bytes. 0x00 bytes are escaped so the
+// 0x00 0x01 terminator sorts before any continuation of the bytes.
+func encodeBytes(tag byte, raw string) []byte {
+	key := []byte{tag}
+	for _, b := range []byte(raw) {
+		if b == 0x00 {
+			key = append(key, 0x00, 0xff)
+		} else {
+			key = append(key, b)
+		}
+	}
+	return append(key, 0x00, 0x01)
+}
+
+// Numbers are encoded by their exact decimal digits, so ints, floats and
+// decimals share one order. After the tag comes 0x00 for negative numbers, 0x01
+// for zero, or 0x02 for positive numbers. Nonzero numbers, written as
+// 0.d1d2... * 10^e, continue with the exponent e, their digits without trailing
+// zeros two to a byte, and a 0x00 terminator, all inverted for negative numbers
+// so that larger magnitudes sort first.
+func encodeNumber(number DecimalValue) []byte {
+	digits := new(big.Int).Abs(number.Unscaled).String()
+	significant := strings.TrimRight(digits, "0")
+	if significant == "" {
+		return []byte{numberKeyTag, 0x01}
+	}
+	if len(significant)%2 == 1 {
+		significant += "0"
+	}
+
+	body := make([]byte, 2, 3+len(significant)/2)
+	binary.BigEndian.PutUint16(body, uint16(len(digits)-number.Scale+1<<15))
+	for idx := 0; idx < len(significant); idx += 2 {
+		pair := (significant[idx]-'0')*10 + significant[idx+1] - '0'
+		body = append(body, pair+1)
+	}
+	body = append(body, 0x00)
+
+	if number.Sign() > 0 {
+		return append([]byte{numberKeyTag, 0x02}, body...)
+	}
+	for idx := range body {
+		body[idx] = ^body[idx]
+	}
+	return append([]byte{numberKeyTag, 0x00}, body...)
+}
+
+// Encodes an integer like a number, but with a different tag. Dates, times and
+// intervals are encoded by their number of microseconds this way, so they
+// sort in order but apart from numbers.
+func encodeTagged(tag byte, integer *big.Int) []byte {
+	key := encodeNumber(DecimalValue{Unscaled: integer})
+	key[0] = tag
+	return key
+}
+
+// Smallest key that sorts after every key starting with `prefix`, or nil if
+// there is none.
+func PrefixEnd(prefix []byte) []byte {
+	end := append([]byte{}, prefix...)
+	for idx := len(end) - 1; idx >= 0; idx-- {
+		if end[idx] < 0xff {
+			end[idx] += 1
+			return end[:idx+1]
+		}
+	}
+	return nil
+}
+
+// Range of keys `[lo, hi)` holding every value of the same kind as `value`
+// for which `<indexed value> <comparison> value` could be true, where
+// `comparison` is one of =, <, <=, >, >=. Returns false if the comparison can't
+// be answered with a range, like any comparison against NULL, or ordering JSON
+// documents, which aren't encoded in order.
+func IndexKeyRange(comparison string, value *Value) ([]byte, []byte, bool) {
+	encoded := EncodeIndexValue(value)
+	tag := encoded[0]
+	if tag == nullKeyTag || (tag == jsonKeyTag && comparison != "=") {
+		return nil, nil, false
+	}
+
+	kindStart := []byte{tag}
+	kindEnd := []byte{tag + 1}
+	switch comparison {
+	case "=":
+		return encoded, PrefixEnd(encoded), true
+	case "<":
+		return kindStart, encoded, true
+	case "<=":
+		return kindStart, PrefixEnd(encoded), true
+	case ">":
+		return PrefixEnd(encoded), kindEnd, true
+	case ">=":
+		return encoded, kindEnd, true
+	}
+	return nil, nil, false
+}
@@ -0,0 +1,313 @@
+// sdb/db/json.go
+//
+// JSON documents, stored in `json` columns, along with the `->`, `->>` and `?`
+// operators and the `json_extract` function that look inside them.
+
+package db
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// JSON document, kept as canonical text: without whitespace and with the keys
+// of objects sorted, so documents that differ only in layout are equal.
+type JSONValue string
+
+// Validates and canonicalizes the text of a JSON document.
+func ParseJSON(text string) (JSONValue, error) {
+	decoder := json.NewDecoder(strings.NewReader(text))
+	decoder.UseNumber()
+
+	var document interface{}
+	err := decoder.Decode(&document)
+	if err == nil {
+		// nothing but whitespace may follow the document
+		if _, trailing := decoder.Token(); trailing != io.EOF {
+			err = fmt.Errorf("trailing input")
+		}
+	}
+	if err != nil {
+		return "", fmt.Errorf("!Invalid JSON %v.", quoteString(text))
+	}
+	return encodeJSON(document), nil
+}
+
+func encodeJSON(document interface{}) JSONValue {
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(document)
+	return JSONValue(strings.TrimSuffix(buffer.String(), "\n"))
+}
+
+// Decodes the document into maps, slices, strings, bools, `json.Number`s and
+// nils. Canonical text always decodes.
+func (document JSONValue) decode() interface{} {
+	decoder := json.NewDecoder(strings.NewReader(string(document)))
+	decoder.UseNumber()
+	var decoded interface{}
+	decoder.Decode(&decoded)
+	return decoded
+}
+
+// Gets a value as a JSON document. Strings are parsed, as in
+// `'{"a": 1}' -> 'a'`.
+func toJSON(value *Value) (JSONValue, bool) {
+	switch v := value.Value.(type) {
+	case JSONValue:
+		return v, true
+	case string:
+		document, err := ParseJSON(v)
+		return document, err == nil
+	}
+	return "", false
+}
+
+// Orders two JSON documents. Documents of different kinds are ordered null,
+// string, number, boolean, array, then object. Strings, numbers and booleans
+// are ordered by value, and arrays and objects by their text. Numbers equal in
+// value but written differently, like 1 and 1.0, are ordered by their text so
+// only identical documents are equal.
+func compareJSON(left JSONValue, right JSONValue) int {
+	leftDecoded, rightDecoded := left.decode(), right.decode()
+	leftRank, rightRank := jsonRank(leftDecoded), jsonRank(rightDecoded)
+	if leftRank != rightRank {
+		if leftRank < rightRank {
+			return -1
+		}
+		return 1
+	}
+
+	switch l := leftDecoded.(type) {
+	case string:
+		return strings.Compare(l, rightDecoded.(string))
+	case json.Number:
+		leftNumber, _ := new(big.Rat).SetString(string(l))
+		rightNumber, _ := new(big.Rat).SetString(string(rightDecoded.(json.Number)))
+		if order := leftNumber.Cmp(rightNumber); order != 0 {
+			return order
+		}
+	case bool:
+		if l != rightDecoded.(bool) {
+			if l {
+				return 1
+			}
+			return -1
+		}
+	}
+	return strings.Compare(string(left), string(right))
+}
+
+func jsonRank(decoded interface{}) int {
+	switch decoded.(type) {
+	case nil:
+		return 0
+	case string:
+		return 1
+	case json.Number:
+		return 2
+	case bool:
+		return 3
+	case []interface{}:
+		return 4
+	}
+	return 5
+}
+
+// Gets the member of an object with key `key`, or the element of an array at
+// index `key` counting from 0, where negative indexes count from the end.
+// Returns false if there is no such member or element.
+func jsonMember(decoded interface{}, key interface{}) (interface{}, bool) {
+	switch document := decoded.(type) {
+	case map[string]interface{}:
+		if name, isString := key.(string); isString {
+			member, ok := document[name]
+			return member, ok
+		}
+	case []interface{}:
+		if index, isInt := key.(int64); isInt {
+			if index < 0 {
+				index += int64(len(document))
+			}
+			if index >= 0 && index < int64(len(document)) {
+				return document[index], true
+			}
+		}
+	}
+	return nil, false
+}
+
+// JSON operator, e.g. `payload -> 'user'`. `->` gets the member of an object
+// with the given key, or the element of an array at the given index, as JSON,
+// and `->>` gets it as text. `?` tests if an object has the given key, or an
+// array has the given string as an element. Evaluates to NULL if either side
+// is NULL, the left side is text that isn't JSON, or there is no such member.
+type JSONExpression struct {
+	Operator string
+	Left     Expression
+	Right    Expression
+}
+
+func (operator JSONExpression) Evaluate(colMap map[string]int, row []Value) (*Value, error) {
+	left, err := operator.Left.Evaluate(colMap, row)
+	if err != nil {
+		return nil, err
+	}
+	right, err := operator.Right.Evaluate(colMap, row)
+	if err != nil {
+		return nil, err
+	}
+
+	null := &Value{Value: nil, Type: Null{}}
+	if left.Value == nil || right.Value == nil {
+		return null, nil
+	}
+	document, ok := toJSON(left)
+	if _, isString := left.Value.(string); isString && !ok {
+		// text that isn't JSON has no members, so rows holding it are
+		// filtered out by conditions on them rather than failing a query
+		return null, nil
+	} else if !ok {
+		return nil, fmt.Errorf("!Operator %v requires a json operand.", operator.Operator)
+	}
+	decoded := document.decode()
+
+	if operator.Operator == "?" {
+		key, isString := right.Value.(string)
+		if !isString {
+			return nil, fmt.Errorf("!Operator ? requires a string key.")
+		}
+		result := BoolValue(jsonHasKey(decoded, key))
+		return &result, nil
+	}
+
+	switch right.Value.(type) {
+	case string, int64:
+	default:
+		return nil, fmt.Errorf(
+			"!Operator %v requires a string key or an int index.", operator.Operator,
+		)
+	}
+	member, ok := jsonMember(decoded, right.Value)
+	if !ok {
+		return null, nil
+	}
+
+	if operator.Operator == "->" {
+		return &Value{Value: encodeJSON(member), Type: JSON{}}, nil
+	}
+	switch text := member.(type) {
+	case nil:
+		return null, nil
+	case string:
+		return &Value{Value: text, Type: Text{}}, nil
+	}
+	return &Value{Value: string(encodeJSON(member)), Type: Text{}}, nil
+}
+
+func jsonHasKey(decoded interface{}, key string) bool {
+	switch document := decoded.(type) {
+	case map[string]interface{}:
+		_, ok := document[key]
+		return ok
+	case []interface{}:
+		for _, element := range document {
+			if element == key {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (operator JSONExpression) TypeOf(_ []Column) Type {
+	switch operator.Operator {
+	case "->":
+		return JSON{}
+	case "->>":
+		return Text{}
+	}
+	return Boolean{}
+}
+
+func (operator JSONExpression) ToString() string {
+	return binaryToString(operator, operator.Operator, operator.Left, operator.Right)
+}
+
+// Evaluates `json_extract(<document>, <path>)`, which gets the part of a
+// document at a path like '$.user.tags[0]' as JSON, or NULL if there is
+// nothing there. Returns false if `name` isn't `json_extract`.
+func callJSONFunction(name string, args []*Value) (*Value, bool, error) {
+	if name != "json_extract" {
+		return nil, false, nil
+	}
+	if len(args) != 2 {
+		return nil, true, fmt.Errorf("!Function json_extract takes 2 arguments.")
+	}
+
+	null := &Value{Value: nil, Type: Null{}}
+	if args[0].Value == nil || args[1].Value == nil {
+		return null, true, nil
+	}
+	document, ok := toJSON(args[0])
+	if !ok {
+		return nil, true, fmt.Errorf("!Function json_extract requires a json document.")
+	}
+	path, isString := args[1].Value.(string)
+	keys, err := parseJSONPath(path)
+	if !isString || err != nil {
+		return nil, true, fmt.Errorf("!Invalid JSON path %v.", args[1].ToString())
+	}
+
+	decoded := document.decode()
+	for _, key := range keys {
+		if decoded, ok = jsonMember(decoded, key); !ok {
+			return null, true, nil
+		}
+	}
+	return &Value{Value: encodeJSON(decoded), Type: JSON{}}, true, nil
+}
+
+// Parses a path like '$.user.tags[0]' into the keys and indexes it follows,
+// here "user", "tags" and 0.
+func parseJSONPath(path string) ([]interface{}, error) {
+	if !strings.HasPrefix(path, "$") {
+		return nil, fmt.Errorf("path must start with $")
+	}
+
+	var keys []interface{}
+	rest := path[1:]
+	for rest != "" {
+		if strings.HasPrefix(rest, ".") {
+			end := strings.IndexAny(rest[1:], ".[")
+			if end < 0 {
+				end = len(rest) - 1
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("empty key")
+			}
+			keys = append(keys, rest[1:end+1])
+			rest = rest[end+1:]
+		} else if strings.HasPrefix(rest, "[") {
+			end := strings.Index(rest, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("unclosed index")
+			}
+			index, err := strconv.ParseInt(rest[1:end], 10, 64)
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, index)
+			rest = rest[end+1:]
+		} else {
+			return nil, fmt.Errorf("unexpected %v", rest)
+		}
+	}
+	return keys, nil
+}
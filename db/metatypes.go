@@ -9,11 +9,17 @@ package db
 
 import (
 	"fmt"
+	"math"
+	"strconv"
 	"strings"
 )
 
-// Types based on fixed with vs. dynamic width. Used in `parser`.
-var ConstWidthTypes = []string{"float", "int"}
+// Types written without and with a size, like `int` and `varchar(10)`. Used in
+// `utils.ParseType`.
+var ConstWidthTypes = []string{
+	"float", "smallint", "int", "bigint", "boolean", "date", "time", "timestamptz",
+	"interval", "text", "blob", "bytea", "json", "uuid",
+}
 var VariableWidthTypes = []string{"char", "varchar"}
 
 // Converts an arbitrary string to a `Type` interface, with the appropriate type
@@ -22,9 +28,45 @@ func NewType(typename string, size int) Type {
 	if typename == "float" {
 		return Float{}
 	}
+	if typename == "smallint" {
+		return Int{Size: 2}
+	}
 	if typename == "int" {
 		return Int{}
 	}
+	if typename == "bigint" {
+		return Int{Size: 8}
+	}
+	if typename == "boolean" {
+		return Boolean{}
+	}
+	if typename == "date" {
+		return Date{}
+	}
+	if typename == "time" {
+		return Time{}
+	}
+	if typename == "timestamp" {
+		return Timestamp{}
+	}
+	if typename == "timestamptz" {
+		return Timestamp{WithTimeZone: true}
+	}
+	if typename == "interval" {
+		return Interval{}
+	}
+	if typename == "text" {
+		return Text{}
+	}
+	if typename == "blob" || typename == "bytea" {
+		return Blob{}
+	}
+	if typename == "json" {
+		return JSON{}
+	}
+	if typename == "uuid" {
+		return UUID{}
+	}
 	if typename == "char" {
 		return Char{size}
 	}
@@ -34,9 +76,112 @@ func NewType(typename string, size int) Type {
 	return nil
 }
 
+// Columns can optionally have constraints: `NotNull` rejects NULL values,
+// `Default` is used when a value isn't given on insert, and `Check` must not
+// evaluate to false for any row. Identity columns take their values from a
+// sequence through their `Default`.
 type Column struct {
-	Name string
-	Type Type
+	Name     string
+	Type     Type
+	NotNull  bool
+	Default  Expression
+	Check    Expression
+	Identity IdentityGeneration
+}
+
+// How the values of an identity column are generated. Values of
+// `GENERATED ALWAYS` columns can't be given by inserts or updates, while
+// `GENERATED BY DEFAULT` columns only use their sequence when no value is given.
+type IdentityGeneration string
+
+const (
+	GeneratedAlways    IdentityGeneration = "always"
+	GeneratedByDefault IdentityGeneration = "by default"
+)
+
+// Name of the sequence an identity column takes its values from, or "" if the
+// column isn't an identity column.
+func (column Column) IdentitySequence() string {
+	if column.Identity == "" {
+		return ""
+	}
+	call, ok := column.Default.(FunctionCall)
+	if !ok {
+		return ""
+	}
+	name, _ := SequenceArgument(call)
+	return name
+}
+
+// Table-level `PRIMARY KEY` or `UNIQUE` constraint over one or more columns.
+type KeyConstraint struct {
+	Primary bool
+	Columns []string
+}
+
+func (key KeyConstraint) ToString() string {
+	if key.Primary {
+		return fmt.Sprintf("primary key (%v)", strings.Join(key.Columns, ", "))
+	}
+	return fmt.Sprintf("unique (%v)", strings.Join(key.Columns, ", "))
+}
+
+// Action taken on rows referencing a parent row through a foreign key when the
+// parent row is deleted or its key is updated.
+type ReferentialAction string
+
+const (
+	Restrict   ReferentialAction = "restrict"
+	Cascade    ReferentialAction = "cascade"
+	SetNull    ReferentialAction = "set null"
+	SetDefault ReferentialAction = "set default"
+)
+
+// `FOREIGN KEY (<columns>) REFERENCES <ref_table> (<ref_columns>)` constraint,
+// requiring every non-NULL value of `Columns` to match a row of `RefTable`.
+// `RefColumns` must be the primary key or a unique key of `RefTable`.
+type ForeignKey struct {
+	Columns    []string
+	RefTable   string
+	RefColumns []string
+	OnDelete   ReferentialAction
+	OnUpdate   ReferentialAction
+}
+
+func (foreignKey ForeignKey) ToString() string {
+	return fmt.Sprintf(
+		"foreign key (%v) references %v (%v) on delete %v on update %v",
+		strings.Join(foreignKey.Columns, ", "),
+		foreignKey.RefTable,
+		strings.Join(foreignKey.RefColumns, ", "),
+		foreignKey.OnDelete,
+		foreignKey.OnUpdate,
+	)
+}
+
+// Secondary index created by `CREATE [UNIQUE] INDEX <name> ON <table>
+// (<columns>)`, stored as a B+tree in its own file in the database directory.
+type IndexDefinition struct {
+	Name    string
+	Unique  bool
+	Columns []string
+}
+
+func (index IndexDefinition) ToString() string {
+	prefix := "index"
+	if index.Unique {
+		prefix = "unique index"
+	}
+	return fmt.Sprintf("%v %v (%v)", prefix, index.Name, strings.Join(index.Columns, ", "))
+}
+
+// Everything the catalog records about a table: its columns, key constraints, foreign
+// keys, and indexes.
+type TableSchema struct {
+	Columns     []Column
+	Keys        []KeyConstraint
+	ForeignKeys []ForeignKey
+	Indexes     []IndexDefinition
 }
 
 type Value struct {
@@ -53,10 +198,59 @@ func (v *Value) GetType() Type {
 }
 
 func (v *Value) TypeMatches(t *Type) bool {
-	if strings.Contains(v.GetType().ToString(), "int") {
-		return v.GetType().ToString() == (*t).ToString()
+	// NULL can be stored in a column of any type
+	if _, isNull := v.GetType().(Null); isNull {
+		return true
+	}
+	if _, isBoolean := v.GetType().(Boolean); isBoolean {
+		_, ok := (*t).(Boolean)
+		return ok
+	}
+	// dates, times, timestamps and intervals are only stored in columns of
+	// their own type, see `ToTemporal` for converting them
+	if isTemporal(v.GetType()) {
+		return v.GetType() == *t
+	}
+	if _, isBlob := v.GetType().(Blob); isBlob {
+		_, ok := (*t).(Blob)
+		return ok
+	}
+	if _, isJSON := v.GetType().(JSON); isJSON {
+		_, ok := (*t).(JSON)
+		return ok
+	}
+	if _, isUUID := v.GetType().(UUID); isUUID {
+		_, ok := (*t).(UUID)
+		return ok
+	}
+	if enum, isEnum := v.GetType().(Enum); isEnum {
+		other, ok := (*t).(Enum)
+		return ok && other.Name == enum.Name
+	}
+	// any string can be stored in a text column, and text values in char and
+	// varchar columns they fit in
+	if text, isString := v.GetValue().(string); isString {
+		if _, ok := (*t).(Text); ok {
+			return true
+		}
+		if _, ok := v.GetType().(Text); ok {
+			varchar := Value{Value: text, Type: VarChar{Size: len(text)}}
+			return varchar.TypeMatches(t)
+		}
+	}
+	// an int can be stored in a column of any int type it fits in
+	if _, isInt := v.GetType().(Int); isInt {
+		colInt, ok := (*t).(Int)
+		return ok && colInt.Contains(v.GetValue().(int64))
 	} else if strings.Contains(v.GetType().ToString(), "float") {
 		return v.GetType().ToString() == (*t).ToString()
+	} else if _, isDecimal := v.GetType().(Decimal); isDecimal {
+		colDecimal, ok := (*t).(Decimal)
+		if !ok {
+			return false
+		}
+		_, fits := colDecimal.Round(v.GetValue().(DecimalValue))
+		return fits
 	}
 	// v is a varchar or char, in which case it's valid as long as it's <= the
 	// column's required length
@@ -66,28 +260,116 @@ func (v *Value) TypeMatches(t *Type) bool {
 		if ok { // cand is varchar, column is char
 			return candVarChar.Size <= colVarChar.Size
 		} else { // cand is varchar, col is varchar
-			colChar := (*t).(VarChar)
-			return candVarChar.Size <= colChar.Size
+			colChar, ok := (*t).(VarChar)
+			return ok && candVarChar.Size <= colChar.Size
 		}
 	}
-	candChar := v.GetType().(Char)
+	candChar, ok := v.GetType().(Char)
+	if !ok {
+		return false
+	}
 	colChar, ok := (*t).(Char)
 	if ok { // cand is char, column is char
 		return candChar.Size == colChar.Size
 	} else { // cand is char, col is varchar
-		colVarChar := (*t).(VarChar)
-		return candChar.Size <= colVarChar.Size
+		colVarChar, ok := (*t).(VarChar)
+		return ok && candChar.Size <= colVarChar.Size
 	}
 }
 
 func (v *Value) ToString() string {
-	if v.Type.ToString() == "float" {
-		return fmt.Sprintf("%v", v.Value)
-	} else if v.Type.ToString() == "int" {
+	if _, isNull := v.Type.(Null); isNull {
+		return "null"
+	} else if v.Type.ToString() == "float" {
+		// floats are written so they read back as the same float, and not as
+		// an int if they are whole numbers
+		formatted := strconv.FormatFloat(v.Value.(float64), 'g', -1, 64)
+		if !strings.ContainsAny(formatted, ".e") {
+			formatted += ".0"
+		}
+		return formatted
+	} else if _, isInt := v.Type.(Int); isInt {
 		return fmt.Sprintf("%v", v.Value)
+	} else if _, isDecimal := v.Type.(Decimal); isDecimal {
+		return v.Value.(DecimalValue).String()
+	} else if _, isBoolean := v.Type.(Boolean); isBoolean {
+		return strconv.FormatBool(v.Value.(bool))
+	} else if isTemporal(v.Type) {
+		return fmt.Sprintf("'%v'", temporalString(*v))
+	} else if blob, isBlob := v.Value.(BlobValue); isBlob {
+		return blob.String()
+	} else if document, isJSON := v.Value.(JSONValue); isJSON {
+		return quoteString(string(document))
+	} else if uuid, isUUID := v.Value.(UUIDValue); isUUID {
+		return fmt.Sprintf("'%v'", uuid)
+	} else if enum, isEnum := v.Value.(EnumValue); isEnum {
+		return quoteString(enum.Label)
 	}
 	// otherwise, value is a string of some kind
-	return fmt.Sprintf("'%v'", v.Value)
+	return quoteString(v.Value.(string))
+}
+
+// Writes a string as a literal that reads back as the same string, with each
+// quote inside it written as two quotes. Strings with control characters
+// like newlines, which would split a row of a table file, are written as
+// escape strings like `e'line\nline'`.
+func quoteString(text string) string {
+	needsEscapes := false
+	for idx := 0; idx < len(text); idx++ {
+		if char := text[idx]; char < 0x20 || char == 0x7f {
+			needsEscapes = true
+			break
+		}
+	}
+	if !needsEscapes {
+		return "'" + strings.ReplaceAll(text, "'", "''") + "'"
+	}
+
+	var builder strings.Builder
+	builder.WriteString("e'")
+	for idx := 0; idx < len(text); idx++ {
+		switch char := text[idx]; char {
+		case '\'':
+			builder.WriteString("''")
+		case '\\':
+			builder.WriteString(`\\`)
+		case '\n':
+			builder.WriteString(`\n`)
+		case '\r':
+			builder.WriteString(`\r`)
+		case '\t':
+			builder.WriteString(`\t`)
+		default:
+			if char < 0x20 || char == 0x7f {
+				fmt.Fprintf(&builder, `\x%02x`, char)
+			} else {
+				builder.WriteByte(char)
+			}
+		}
+	}
+	builder.WriteString("'")
+	return builder.String()
+}
+
+// Reads text as a literal of type `t`, for the types whose values are written
+// as strings: dates, times, timestamps, intervals, JSON documents, enums and
+// UUIDs. Returns false if `t` isn't one of these types.
+func ParseAs(text string, t Type) (Value, bool, error) {
+	switch t := t.(type) {
+	case Date, Time, Timestamp, Interval:
+		value, err := ParseTemporal(text, t)
+		return value, true, err
+	case JSON:
+		document, err := ParseJSON(text)
+		return Value{Value: document, Type: t}, true, err
+	case Enum:
+		value, err := t.Value(text)
+		return value, true, err
+	case UUID:
+		uuid, err := ParseUUID(text)
+		return Value{Value: uuid, Type: t}, true, err
+	}
+	return Value{}, false, nil
 }
 
 type Type interface {
@@ -97,8 +379,7 @@ type Type interface {
 // ----- TYPE STRUCTS --------------------------------------------------------
 // Structs for the various types of values that the database implements. These
 // do not store *values*, but rather the parameters for each type, as in the
-// variable width `char` and `varchar` types. Will be more useful if enums or
-// other more complex types are implemented.
+// variable width `char` and `varchar` types, or the labels of an `Enum`.
 
 type Float struct{}
 
@@ -106,12 +387,111 @@ func (float Float) ToString() string {
 	return "float"
 }
 
-type Int struct{}
+// Type of `smallint`, `int` and `bigint` columns, which hold integers of 2, 4
+// and 8 bytes. The zero value is a 4 byte `int`. Values of every int type are
+// stored as int64s.
+type Int struct {
+	Size int
+}
 
 func (int Int) ToString() string {
+	switch int.Size {
+	case 2:
+		return "smallint"
+	case 8:
+		return "bigint"
+	}
 	return "int"
 }
 
+// Smallest and largest values the type can hold.
+func (int Int) Range() (int64, int64) {
+	switch int.Size {
+	case 2:
+		return math.MinInt16, math.MaxInt16
+	case 8:
+		return math.MinInt64, math.MaxInt64
+	}
+	return math.MinInt32, math.MaxInt32
+}
+
+// Checks if `value` is in the range of the type.
+func (int Int) Contains(value int64) bool {
+	min, max := int.Range()
+	return value >= min && value <= max
+}
+
+// The smallest of `int` and `bigint` that can hold `value`, used as the type
+// of integer literals.
+func IntTypeOf(value int64) Int {
+	if (Int{}).Contains(value) {
+		return Int{}
+	}
+	return Int{Size: 8}
+}
+
+// Type of `boolean` columns, and of predicates like `price > 10`. Values are
+// Go bools, written as `true` and `false`.
+type Boolean struct{}
+
+func (boolean Boolean) ToString() string {
+	return "boolean"
+}
+
+type Date struct{}
+
+func (date Date) ToString() string {
+	return "date"
+}
+
+// Type of `time` columns, holding times of day without a date.
+type Time struct{}
+
+func (time Time) ToString() string {
+	return "time"
+}
+
+// Type of `timestamp` and `timestamp with time zone` columns. Both hold a date
+// and time of day, but timestamps with a time zone convert literals with a
+// time zone to UTC, while timestamps without one ignore the time zone.
+type Timestamp struct {
+	WithTimeZone bool
+}
+
+func (timestamp Timestamp) ToString() string {
+	if timestamp.WithTimeZone {
+		return "timestamp with time zone"
+	}
+	return "timestamp"
+}
+
+type Interval struct{}
+
+func (interval Interval) ToString() string {
+	return "interval"
+}
+
+// Type of `text` columns, holding strings of any length.
+type Text struct{}
+
+func (text Text) ToString() string {
+	return "text"
+}
+
+// Type of `blob` columns, also called `bytea`, holding binary data.
+type Blob struct{}
+
+func (blob Blob) ToString() string {
+	return "blob"
+}
+
+// Type of `json` columns, holding JSON documents, see `JSONValue`.
+type JSON struct{}
+
+func (json JSON) ToString() string {
+	return "json"
+}
+
 type Char struct {
 	Size int
 }
@@ -0,0 +1,154 @@
+// sdb/db/sequence.go
+//
+// Sequences created by `CREATE SEQUENCE` and identity columns. Sequences are
+// defined in the catalog, while the next value each will hand out is stored in
+// a hidden file in the database directory. Values
+// are allocated while holding an exclusive lock file, so processes sharing a
+// database never get the same value. A lock left by a process that died is
+// taken over, see `LockFile`.
+
+package db
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// Gets the name of the sequence passed to `nextval` or `currval`, which must be
+// given as a string literal. Like other identifiers, the name is lowercased.
+func SequenceArgument(call FunctionCall) (string, error) {
+	if len(call.Args) == 1 {
+		if literal, ok := call.Args[0].(Literal); ok {
+			if name, ok := literal.Value.GetValue().(string); ok {
+				return strings.ToLower(name), nil
+			}
+		}
+	}
+	return "", fmt.Errorf("!%v expects the name of a sequence.", call.Name)
+}
+
+func (state *DBState) sequencePath(name string) string {
+	return state.CurrentDB + "/." + name + "_sequence"
+}
+
+func (state *DBState) SequenceExists(name string) bool {
+	_, err := os.Stat(state.sequencePath(name))
+	return err == nil
+}
+
+// Creates a sequence whose first value is `start`.
+func (state *DBState) CreateSequence(name string, start int64) error {
+	file, err := os.OpenFile(
+		state.sequencePath(name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0777,
+	)
+	if err != nil {
+		if os.IsExist(err) {
+			return fmt.Errorf("!Sequence %v already exists.", name)
+		}
+		return fmt.Errorf("!Failed to create sequence %v: %v", name, err)
+	}
+	defer file.Close()
+
+	_, err = fmt.Fprintf(file, "%v\n", start)
+	if err != nil {
+		return fmt.Errorf("!Failed to create sequence %v: %v", name, err)
+	}
+	return nil
+}
+
+func (state *DBState) DropSequence(name string) error {
+	err := os.Remove(state.sequencePath(name))
+	if err != nil {
+		return fmt.Errorf("!Sequence %v does not exist.", name)
+	}
+	delete(state.SequenceValues, state.CurrentDB+"/"+name)
+	return nil
+}
+
+// Allocates the next value of a sequence, which then hands out the value
+// `increment` after it, and remembers it as the sequence's current value for
+// this session. The increment is the one in the sequence's definition.
+func (state *DBState) NextSequenceValue(name string, increment int64) (int64, error) {
+	path := state.sequencePath(name)
+	if !state.SequenceExists(name) {
+		return 0, fmt.Errorf("!Sequence %v does not exist.", name)
+	}
+
+	unlock, err := lockSequence(path, name)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, fmt.Errorf("!Failed to read sequence %v: %v", name, err)
+	}
+	var next int64
+	_, err = fmt.Sscanf(string(contents), "%d", &next)
+	if err != nil {
+		return 0, fmt.Errorf("!Sequence %v is corrupt.", name)
+	}
+
+	// the new state is renamed over the old one, so a crash can't leave the
+	// sequence half written
+	tempFile, err := ioutil.TempFile(state.CurrentDB, "."+name+"_tmp")
+	if err != nil {
+		return 0, fmt.Errorf("!Failed to update sequence %v: %v", name, err)
+	}
+	// keep the permissions the sequence was created with, which a temporary
+	// file doesn't have
+	info, err := os.Stat(path)
+	if err == nil {
+		err = tempFile.Chmod(info.Mode())
+	}
+	if err == nil {
+		_, err = fmt.Fprintf(tempFile, "%v\n", next+increment)
+	}
+	if err == nil {
+		err = tempFile.Sync()
+	}
+	closeErr := tempFile.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tempFile.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tempFile.Name())
+		return 0, fmt.Errorf("!Failed to update sequence %v: %v", name, err)
+	}
+
+	if state.SequenceValues == nil {
+		state.SequenceValues = make(map[string]int64)
+	}
+	state.SequenceValues[state.CurrentDB+"/"+name] = next
+	return next, nil
+}
+
+// Gets the value most recently returned by `NextSequenceValue` for a sequence
+// in this session.
+func (state *DBState) CurrentSequenceValue(name string) (int64, error) {
+	value, ok := state.SequenceValues[state.CurrentDB+"/"+name]
+	if !ok {
+		return 0, fmt.Errorf(
+			"!currval of sequence %v is not yet defined in this session.", name,
+		)
+	}
+	return value, nil
+}
+
+// Takes the lock on a sequence, waiting for any other process holding it.
+// Returns a function that releases the lock.
+func lockSequence(path string, name string) (func(), error) {
+	unlock, err := LockFile(path + "_lock")
+	if err == ErrLocked {
+		return nil, fmt.Errorf("!Sequence %v is locked.", name)
+	} else if err != nil {
+		return nil, fmt.Errorf("!Failed to lock sequence %v: %v", name, err)
+	}
+	return unlock, nil
+}
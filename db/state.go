@@ -6,13 +6,59 @@ import (
 	"io"
 	"os"
 	"strings"
+	"time"
 )
 
 // DBState is used to track which database the user is currently in, along with
-// any data associated with transactions.
+// any data associated with transactions. `Catalog` caches the catalog of the
+// current database, and `SequenceValues` holds the value each sequence most
+// recently handed out in this session, for `currval`. `TempDir` and
+// `TempCatalogs` hold this session's temporary tables, see `temporary.go`.
 type DBState struct {
-	CurrentDB   string
-	Transaction *Transaction
+	CurrentDB      string
+	Transaction    *Transaction
+	KeyIndexes     map[string]*KeyIndex
+	Catalog        *Catalog
+	SequenceValues map[string]int64
+	TempDir        string
+	TempCatalogs   map[string]*Catalog
+}
+
+// In-memory index of the values of a table's `PRIMARY KEY` and `UNIQUE`
+// constraints, with one set of values per key in the order of the table's
+// keys. The table file's size and modification time are recorded when the
+// index is built, so changes made by other processes invalidate it.
+type KeyIndex struct {
+	Keys    []map[string]bool
+	ModTime time.Time
+	Size    int64
+}
+
+// Records the state of the table file the index is up to date with.
+func (index *KeyIndex) Stamp(info os.FileInfo) {
+	index.ModTime = info.ModTime()
+	index.Size = info.Size()
+}
+
+// Checks if the index is up to date with the table file.
+func (index *KeyIndex) Matches(info os.FileInfo) bool {
+	return index.ModTime.Equal(info.ModTime()) && index.Size == info.Size()
+}
+
+func (state *DBState) CachedKeyIndex(tableName string) *KeyIndex {
+	return state.KeyIndexes[state.TableDir(tableName)+"/"+tableName]
+}
+
+func (state *DBState) CacheKeyIndex(tableName string, index *KeyIndex) {
+	if state.KeyIndexes == nil {
+		state.KeyIndexes = make(map[string]*KeyIndex)
+	}
+	state.KeyIndexes[state.TableDir(tableName)+"/"+tableName] = index
+}
+
+// Drops the cached key index of a table, e.g. after the table is rewritten.
+func (state *DBState) InvalidateKeyIndex(tableName string) {
+	delete(state.KeyIndexes, state.TableDir(tableName)+"/"+tableName)
 }
 
 // All SQL statement types implement this interface. The `Execute` function
@@ -41,7 +87,7 @@ func (state *DBState) IsTransacting() bool {
 
 // Checks if the given table is currently locked by any process.
 func (state *DBState) TableLockExists(tableName string) bool {
-	lockFileName := state.CurrentDB + "/." + tableName + "_lock"
+	lockFileName := state.TableDir(tableName) + "/." + tableName + "_lock"
 	_, err := os.Stat(lockFileName)
 
 	if err != nil && os.IsNotExist(err) {
@@ -51,11 +97,28 @@ func (state *DBState) TableLockExists(tableName string) bool {
 	return true
 }
 
+// Takes the lock held by an insert from checking a table's keys until its row
+// and index entries are written, so processes inserting at once can't both add
+// the same key, record the wrong offset for a row, or update an index's B+tree
+// at the same time. Creating and dropping indexes also hold it, so an insert
+// sees the table's indexes as they are when it writes. Returns a function that
+// releases the lock.
+func (state *DBState) LockTableWrites(tableName string) (func(), error) {
+	lockPath := state.TableDir(tableName) + "/." + tableName + "_write_lock"
+	unlock, err := LockFile(lockPath)
+	if err == ErrLocked {
+		return nil, fmt.Errorf("!Table %v is locked.", tableName)
+	} else if err != nil {
+		return nil, fmt.Errorf("!Failed to lock table %v: %v", tableName, err)
+	}
+	return unlock, nil
+}
+
 // Creates lock file to signify table is undergoing transaction. Returns tuple
 // of (string, error) signifying the name of the lock file created or any errors
 // during creation.
 func (state *DBState) createTableLock(tableName string) (string, error) {
-	lockFileName := state.CurrentDB + "/." + tableName + "_lock"
+	lockFileName := state.TableDir(tableName) + "/." + tableName + "_lock"
 	_, err := os.Create(lockFileName)
 	if err != nil {
 		return "", fmt.Errorf("!Failed to create transaction lock: %v", err)
@@ -69,7 +132,7 @@ func (state *DBState) createTableLock(tableName string) (string, error) {
 // PID in the lock file matches the current process' PID. An existing lock file
 // with a different PID means another process is currently locking that table.
 func (state *DBState) AcquireTableLock(tableName string) (string, error) {
-	lockFileName := state.CurrentDB + "/." + tableName + "_lock"
+	lockFileName := state.TableDir(tableName) + "/." + tableName + "_lock"
 	if state.TableLockExists(tableName) {
 		file, err := os.OpenFile(lockFileName, os.O_RDWR, 0777)
 		if err != nil {
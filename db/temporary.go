@@ -0,0 +1,92 @@
+// sdb/db/temporary.go
+//
+// Temporary tables, created by `CREATE TEMPORARY TABLE`, belong to the session
+// that created them. Their rows are stored in a directory of the session's own
+// outside of the database directory, and their schemas only in memory, so no
+// other process ever sees them. A temporary table shadows any permanent table
+// of the same name, and every temporary table is dropped when the session ends.
+
+package db
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+// Gets the catalog of the current database's temporary tables, or nil if none
+// have been created. Its `Database` is the directory holding their files.
+func (state *DBState) TemporaryCatalog() *Catalog {
+	return state.TempCatalogs[state.CurrentDB]
+}
+
+func (state *DBState) IsTemporaryTable(tableName string) bool {
+	catalog := state.TemporaryCatalog()
+	if catalog == nil {
+		return false
+	}
+	_, ok := catalog.Tables[tableName]
+	return ok
+}
+
+// Gets the directory holding the file of a table, along with its indexes and
+// transaction lock.
+func (state *DBState) TableDir(tableName string) string {
+	if state.IsTemporaryTable(tableName) {
+		return state.TemporaryCatalog().Database
+	}
+	return state.CurrentDB
+}
+
+// Like `TemporaryCatalog`, but creates the catalog and its directory if this
+// session has no temporary tables in the current database yet.
+func (state *DBState) CreateTemporaryCatalog() (*Catalog, error) {
+	if state.CurrentDB == "" {
+		return nil, errors.New("!No database selected.")
+	}
+	if catalog := state.TemporaryCatalog(); catalog != nil {
+		return catalog, nil
+	}
+
+	if state.TempDir == "" {
+		dir, err := ioutil.TempDir("", "sdb_temp")
+		if err != nil {
+			return nil, fmt.Errorf("!Failed to create temporary table directory: %v", err)
+		}
+		state.TempDir = dir
+	}
+
+	dir := state.TempDir + "/" + state.CurrentDB
+	err := os.MkdirAll(dir, os.ModeDir|os.ModePerm)
+	if err != nil {
+		return nil, fmt.Errorf("!Failed to create temporary table directory: %v", err)
+	}
+
+	catalog := NewCatalog(dir)
+	if state.TempCatalogs == nil {
+		state.TempCatalogs = make(map[string]*Catalog)
+	}
+	state.TempCatalogs[state.CurrentDB] = catalog
+	return catalog, nil
+}
+
+// Drops the temporary tables this session created in a database, e.g. when the
+// database itself is dropped.
+func (state *DBState) DropTemporaryTables(dbName string) {
+	catalog, ok := state.TempCatalogs[dbName]
+	if !ok {
+		return
+	}
+	os.RemoveAll(catalog.Database)
+	delete(state.TempCatalogs, dbName)
+}
+
+// Drops every temporary table of this session. Called when the session ends.
+func (state *DBState) DropAllTemporaryTables() {
+	if state.TempDir != "" {
+		os.RemoveAll(state.TempDir)
+	}
+	state.TempDir = ""
+	state.TempCatalogs = nil
+}
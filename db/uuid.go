@@ -0,0 +1,101 @@
+// sdb/db/uuid.go
+//
+// UUIDs, stored in `uuid` columns, and the `gen_random_uuid()` function that
+// creates random ones.
+
+package db
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// Type of `uuid` columns.
+type UUID struct{}
+
+func (uuid UUID) ToString() string {
+	return "uuid"
+}
+
+// The 16 bytes of a UUID.
+type UUIDValue [16]byte
+
+// Writes the UUID in its standard form, like
+// 'a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11'.
+func (uuid UUIDValue) String() string {
+	digits := hex.EncodeToString(uuid[:])
+	return digits[:8] + "-" + digits[8:12] + "-" + digits[12:16] + "-" +
+		digits[16:20] + "-" + digits[20:]
+}
+
+// Parses a UUID written as 32 hex digits, optionally split into groups of 8, 4,
+// 4, 4 and 12 digits by hyphens as in the standard form, and optionally
+// surrounded by braces.
+func ParseUUID(text string) (UUIDValue, error) {
+	var uuid UUIDValue
+	invalid := fmt.Errorf("!Invalid input for type uuid: %v.", quoteString(text))
+
+	digits := text
+	if strings.HasPrefix(digits, "{") && strings.HasSuffix(digits, "}") {
+		digits = digits[1 : len(digits)-1]
+	}
+	if len(digits) == 36 {
+		for _, idx := range []int{8, 13, 18, 23} {
+			if digits[idx] != '-' {
+				return uuid, invalid
+			}
+		}
+		digits = strings.Replace(digits, "-", "", 4)
+	}
+
+	if len(digits) != 32 {
+		return uuid, invalid
+	}
+	if _, err := hex.Decode(uuid[:], []byte(digits)); err != nil {
+		return uuid, invalid
+	}
+	return uuid, nil
+}
+
+// Writes the UUID the way it's stored in table files, as its 16 bytes in
+// base64, which takes 22 characters rather than the 36 of the standard form.
+func (uuid UUIDValue) StorageString() string {
+	return base64.RawStdEncoding.EncodeToString(uuid[:])
+}
+
+// Parses a UUID stored in a table file, see `StorageString`. Files written
+// before UUIDs were stored this way hold them in the standard form.
+func ParseStoredUUID(text string) (UUIDValue, error) {
+	var uuid UUIDValue
+	if len(text) == base64.RawStdEncoding.EncodedLen(len(uuid)) {
+		bytes, err := base64.RawStdEncoding.DecodeString(text)
+		if err == nil {
+			copy(uuid[:], bytes)
+			return uuid, nil
+		}
+	}
+	return ParseUUID(text)
+}
+
+// Evaluates `gen_random_uuid()`, which creates a random version 4 UUID.
+// Returns false if `name` isn't `gen_random_uuid`.
+func callUUIDFunction(name string, args []*Value) (*Value, bool, error) {
+	if name != "gen_random_uuid" {
+		return nil, false, nil
+	}
+	if len(args) != 0 {
+		return nil, true, fmt.Errorf("!Function gen_random_uuid takes no arguments.")
+	}
+
+	var uuid UUIDValue
+	if _, err := rand.Read(uuid[:]); err != nil {
+		return nil, true, fmt.Errorf("!Failed to generate uuid: %v", err)
+	}
+	// the version is 4, and the variant is that of RFC 4122
+	uuid[6] = uuid[6]&0x0f | 0x40
+	uuid[8] = uuid[8]&0x3f | 0x80
+	return &Value{Value: uuid, Type: UUID{}}, true, nil
+}
@@ -22,6 +22,7 @@ import (
 func main() {
 	reader := bufio.NewReader(os.Stdin)
 	dbstate := db.NewState()
+	defer dbstate.DropAllTemporaryTables()
 
 	var inputBuilder strings.Builder
 	var input string
@@ -47,6 +48,7 @@ func main() {
 				".exit",
 			) {
 				fmt.Println("\nGoodbye!")
+				dbstate.DropAllTemporaryTables()
 				os.Exit(0)
 			}
 		}
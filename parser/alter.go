@@ -25,32 +25,210 @@ func ParseAlterStatement(input string) (db.Executable, error) {
 	trimmed = strings.TrimPrefix(trimmed, tableName)
 	trimmed = strings.TrimSpace(trimmed)
 
-	trimmed, ok = utils.HasPrefix(trimmed, "add")
-	if !ok {
+	var alterStatement db.Executable
+	var err error
+	if trimmed, ok = utils.HasKeyword(trimmed, "add"); ok {
+		alterStatement, trimmed, err = parseAlterAdd(trimmed, tableName)
+	} else if trimmed, ok = utils.HasKeyword(trimmed, "drop"); ok {
+		alterStatement, trimmed, err = parseAlterDrop(trimmed, tableName)
+	} else if trimmed, ok = utils.HasKeyword(trimmed, "rename"); ok {
+		alterStatement, trimmed, err = parseAlterRename(trimmed, tableName)
+	} else if trimmed, ok = utils.HasKeyword(trimmed, "alter"); ok {
+		alterStatement, trimmed, err = parseAlterColumn(trimmed, tableName)
+	} else {
 		return nil, fmt.Errorf(
-			"Expected `ADD` after table name in `ALTER` statement.",
+			"Expected `ADD`, `DROP`, `RENAME`, or `ALTER` after table name in " +
+				"`ALTER` statement.",
 		)
 	}
+	if err != nil {
+		return nil, err
+	}
+	if err = checkStatementEnd(trimmed); err != nil {
+		return nil, err
+	}
+
+	return alterStatement, nil
+}
+
+// Parses `ADD [COLUMN] <column_name> <column_type>` in `ALTER` statement.
+// Returns the remaining unparsed input, as do the other parts of `ALTER`.
+func parseAlterAdd(input string, tableName string) (db.Executable, string, error) {
+	trimmed, _ := utils.HasKeyword(input, "column")
 
 	newColName := utils.ParseIdentifier(trimmed)
 	if newColName == "" {
-		return nil, fmt.Errorf(
+		return nil, input, fmt.Errorf(
 			"Missing column name after `ADD` in `ALTER` statement.",
 		)
 	}
-	trimmed = strings.TrimPrefix(trimmed, newColName)
-	trimmed = strings.TrimSpace(trimmed)
 
-	typeName, err := utils.ParseType(trimmed)
+	column, keys, foreignKeys, trimmed, err := utils.ParseColumnDefinition(trimmed)
 	if err != nil {
-		return nil, err
+		return nil, input, err
 	}
 
+	alterStatement := statements.AlterStatement{
+		TableName:   tableName,
+		Action:      statements.AlterAddColumn,
+		ColumnName:  newColName,
+		ColumnType:  column.Type,
+		Column:      *column,
+		Keys:        keys,
+		ForeignKeys: foreignKeys,
+	}
+
+	return alterStatement, trimmed, nil
+}
+
+// Parses `DROP [COLUMN] <column_name>` in `ALTER` statement.
+func parseAlterDrop(input string, tableName string) (db.Executable, string, error) {
+	trimmed, _ := utils.HasKeyword(input, "column")
+
+	colName := utils.ParseIdentifier(trimmed)
+	if colName == "" {
+		return nil, input, fmt.Errorf(
+			"Missing column name after `DROP` in `ALTER` statement.",
+		)
+	}
+	trimmed, _ = utils.HasPrefix(trimmed, colName)
+
 	alterStatement := statements.AlterStatement{
 		TableName:  tableName,
-		ColumnName: newColName,
-		ColumnType: typeName,
+		Action:     statements.AlterDropColumn,
+		ColumnName: colName,
 	}
 
-	return alterStatement, nil
+	return alterStatement, trimmed, nil
+}
+
+// Parses `RENAME TO <new_table_name>` or
+// `RENAME [COLUMN] <column_name> TO <new_column_name>` in `ALTER` statement.
+func parseAlterRename(input string, tableName string) (db.Executable, string, error) {
+	if trimmed, ok := utils.HasKeyword(input, "to"); ok {
+		newTableName := utils.ParseIdentifier(trimmed)
+		if newTableName == "" {
+			return nil, input, fmt.Errorf(
+				"Missing table name after `RENAME TO` in `ALTER` statement.",
+			)
+		}
+		trimmed, _ = utils.HasPrefix(trimmed, newTableName)
+
+		alterStatement := statements.AlterStatement{
+			TableName: tableName,
+			Action:    statements.AlterRenameTable,
+			NewName:   newTableName,
+		}
+
+		return alterStatement, trimmed, nil
+	}
+
+	trimmed, _ := utils.HasKeyword(input, "column")
+
+	colName := utils.ParseIdentifier(trimmed)
+	if colName == "" {
+		return nil, input, fmt.Errorf(
+			"Missing column name after `RENAME` in `ALTER` statement.",
+		)
+	}
+	trimmed, _ = utils.HasPrefix(trimmed, colName)
+
+	trimmed, ok := utils.HasKeyword(trimmed, "to")
+	if !ok {
+		return nil, input, fmt.Errorf(
+			"Expected `TO` after column name in `ALTER` statement.",
+		)
+	}
+
+	newColName := utils.ParseIdentifier(trimmed)
+	if newColName == "" {
+		return nil, input, fmt.Errorf(
+			"Missing new column name after `TO` in `ALTER` statement.",
+		)
+	}
+	trimmed, _ = utils.HasPrefix(trimmed, newColName)
+
+	alterStatement := statements.AlterStatement{
+		TableName:  tableName,
+		Action:     statements.AlterRenameColumn,
+		ColumnName: colName,
+		NewName:    newColName,
+	}
+
+	return alterStatement, trimmed, nil
+}
+
+// Parses `ALTER [COLUMN] <column_name> <alteration>` in `ALTER` statement,
+// where alteration is one of `SET NOT NULL`, `DROP NOT NULL`,
+// `SET DEFAULT <expression>`, `DROP DEFAULT`, or a type change.
+func parseAlterColumn(input string, tableName string) (db.Executable, string, error) {
+	trimmed, _ := utils.HasKeyword(input, "column")
+
+	colName := utils.ParseIdentifier(trimmed)
+	if colName == "" {
+		return nil, input, fmt.Errorf(
+			"Missing column name after `ALTER COLUMN` in `ALTER` statement.",
+		)
+	}
+	trimmed, _ = utils.HasPrefix(trimmed, colName)
+
+	alterStatement := statements.AlterStatement{
+		TableName:  tableName,
+		ColumnName: colName,
+	}
+
+	if rest, ok := utils.HasPrefix(trimmed, "set not null"); ok {
+		alterStatement.Action = statements.AlterSetNotNull
+		return alterStatement, rest, nil
+	} else if rest, ok := utils.HasPrefix(trimmed, "drop not null"); ok {
+		alterStatement.Action = statements.AlterDropNotNull
+		return alterStatement, rest, nil
+	} else if rest, ok := utils.HasPrefix(trimmed, "drop default"); ok {
+		alterStatement.Action = statements.AlterDropDefault
+		return alterStatement, rest, nil
+	} else if rest, ok := utils.HasPrefix(trimmed, "set default"); ok {
+		defaultExpression, rest, err := utils.ParseExpression(rest)
+		if err != nil {
+			return nil, input, err
+		}
+		alterStatement.Action = statements.AlterSetDefault
+		alterStatement.Default = defaultExpression
+		return alterStatement, rest, nil
+	}
+
+	return parseAlterColumnType(trimmed, alterStatement)
+}
+
+// Parses `[SET DATA] TYPE <column_type> [USING <expression>]` after the column
+// name in `ALTER COLUMN`.
+func parseAlterColumnType(
+	input string,
+	alterStatement statements.AlterStatement,
+) (db.Executable, string, error) {
+	trimmed, _ := utils.HasPrefix(input, "set data")
+	trimmed, ok := utils.HasKeyword(trimmed, "type")
+	if !ok {
+		return nil, input, fmt.Errorf(
+			"Expected `TYPE` after column name in `ALTER` statement.",
+		)
+	}
+
+	newType, trimmed, err := utils.ParseType(trimmed)
+	if err != nil {
+		return nil, input, err
+	}
+
+	var using db.Expression
+	if rest, ok := utils.HasKeyword(trimmed, "using"); ok {
+		using, trimmed, err = utils.ParseExpression(rest)
+		if err != nil {
+			return nil, input, err
+		}
+	}
+
+	alterStatement.Action = statements.AlterColumnType
+	alterStatement.ColumnType = newType
+	alterStatement.Using = using
+
+	return alterStatement, trimmed, nil
 }
@@ -0,0 +1,52 @@
+// sdb/parser/catalog.go
+//
+// Contains functions for parsing `SHOW DATABASES`, `SHOW TABLES` and
+// `DESCRIBE` queries.
+
+package parser
+
+import (
+	"errors"
+	"sdb/db"
+	"sdb/statements"
+	"sdb/utils"
+)
+
+// Parses `SHOW DATABASES;` and `SHOW TABLES;` input.
+func ParseShowStatement(input string) (db.Executable, error) {
+	trimmed, ok := utils.HasKeyword(input, "show")
+	if !ok {
+		return nil, nil
+	}
+
+	if _, ok := utils.HasKeyword(trimmed, "databases"); ok {
+		return statements.ShowDatabasesStatement{}, nil
+	}
+	if _, ok := utils.HasKeyword(trimmed, "tables"); ok {
+		return statements.ShowTablesStatement{}, nil
+	}
+
+	return nil, errors.New("!Expected DATABASES or TABLES after SHOW.")
+}
+
+// Parses `DESCRIBE <table_name>;` input. `DESC` is accepted as well.
+func ParseDescribeStatement(input string) (db.Executable, error) {
+	trimmed, ok := utils.HasKeyword(input, "describe")
+	if !ok {
+		trimmed, ok = utils.HasKeyword(input, "desc")
+	}
+	if !ok {
+		return nil, nil
+	}
+
+	tableName := utils.ParseIdentifier(trimmed)
+	if tableName == "" {
+		return nil, errors.New("!Missing table name.")
+	}
+
+	describe := statements.DescribeStatement{
+		TableName: tableName,
+	}
+
+	return describe, nil
+}
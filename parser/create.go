@@ -13,12 +13,22 @@ import (
 	"sdb/utils"
 )
 
-// Parses `CREATE TABLE <table_name> (<table_columns>);` input.
+// Parses `CREATE [TEMPORARY | TEMP] TABLE [IF NOT EXISTS] <table_name>
+// (<table_columns>);` input.
 func ParseCreateTableStatement(input string) (db.Executable, error) {
-	trimmed, ok := utils.HasPrefix(input, "create table")
+	trimmed, ok := utils.HasKeyword(input, "create")
 	if !ok {
 		return nil, nil
 	}
+	trimmed, temporary := utils.HasKeyword(trimmed, "temporary")
+	if !temporary {
+		trimmed, temporary = utils.HasKeyword(trimmed, "temp")
+	}
+	trimmed, ok = utils.HasKeyword(trimmed, "table")
+	if !ok {
+		return nil, nil
+	}
+	trimmed, ifNotExists := utils.HasKeyword(trimmed, "if not exists")
 
 	tableName := utils.ParseIdentifier(trimmed)
 
@@ -34,18 +44,16 @@ func ParseCreateTableStatement(input string) (db.Executable, error) {
 		)
 	}
 
-	colList, err := utils.ParseColumnList(trimmed)
+	schema, trimmed, err := utils.ParseTableDefinition(trimmed)
 
 	if err != nil {
 		return nil, err
 	}
 
-	if len(colList) < 1 {
+	if len(schema.Columns) < 1 {
 		return nil, errors.New("Empty column list for CREATE statement.")
 	}
 
-	trimmed, _ = utils.HasPrefix(trimmed, utils.ColumnsToString(colList))
-
 	trimmed, ok = utils.HasPrefix(trimmed, ")")
 	if !ok {
 		return nil, errors.New(
@@ -54,24 +62,30 @@ func ParseCreateTableStatement(input string) (db.Executable, error) {
 	}
 
 	statement := statements.CreateTableStatement{
-		TableName: tableName,
-		Columns:   colList,
+		TableName:   tableName,
+		Columns:     schema.Columns,
+		Keys:        schema.Keys,
+		ForeignKeys: schema.ForeignKeys,
+		IfNotExists: ifNotExists,
+		Temporary:   temporary,
 	}
 
 	return &statement, nil
 }
 
-// Parses `CREATE DATABASE <db_name>;` input.
+// Parses `CREATE DATABASE [IF NOT EXISTS] <db_name>;` input.
 func ParseCreateDBStatement(input string) (db.Executable, error) {
 	trimmed, ok := utils.HasPrefix(input, "create database")
 	if !ok {
 		return nil, nil
 	}
+	trimmed, ifNotExists := utils.HasKeyword(trimmed, "if not exists")
 
 	ident := utils.ParseIdentifier(trimmed)
 
 	createDB := statements.CreateDBStatement{
-		DBName: ident,
+		DBName:      ident,
+		IfNotExists: ifNotExists,
 	}
 
 	return createDB, nil
@@ -19,14 +19,23 @@ func ParseDeleteStatement(input string) (db.Executable, error) {
 		return nil, errors.New("!Expected table name after DELETE FROM.")
 	}
 
-	where, err := ParseWhereClause(trimmed)
+	where, trimmed, err := ParseWhereClause(trimmed)
 	if err != nil {
 		return nil, err
 	}
 
+	returning, trimmed, err := ParseReturningClause(trimmed)
+	if err != nil {
+		return nil, err
+	}
+	if err = checkStatementEnd(trimmed); err != nil {
+		return nil, err
+	}
+
 	delete := statements.DeleteStatment{
 		TableName:   tableName,
 		WhereClause: where,
+		Returning:   returning,
 	}
 
 	return delete, nil
@@ -12,33 +12,37 @@ import (
 	"sdb/utils"
 )
 
-// Parses `DROP DATABASE <table_name>;` input.
+// Parses `DROP DATABASE [IF EXISTS] <table_name>;` input.
 func ParseDropDBStatement(input string) (db.Executable, error) {
 	trimmed, ok := utils.HasPrefix(input, "drop database")
 	if !ok {
 		return nil, nil
 	}
+	trimmed, ifExists := utils.HasKeyword(trimmed, "if exists")
 
 	ident := utils.ParseIdentifier(trimmed)
 
 	dropDB := statements.DropDBStatement{
-		DBName: ident,
+		DBName:   ident,
+		IfExists: ifExists,
 	}
 
 	return dropDB, nil
 }
 
-// Parses `DROP TABLE <table_name>;` input.
+// Parses `DROP TABLE [IF EXISTS] <table_name>;` input.
 func ParseDropTableStatement(input string) (db.Executable, error) {
 	trimmed, ok := utils.HasPrefix(input, "drop table")
 	if !ok {
 		return nil, nil
 	}
+	trimmed, ifExists := utils.HasKeyword(trimmed, "if exists")
 
 	ident := utils.ParseIdentifier(trimmed)
 
 	dropDB := statements.DropTableStatement{
 		TableName: ident,
+		IfExists:  ifExists,
 	}
 
 	return dropDB, nil
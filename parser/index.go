@@ -0,0 +1,80 @@
+// sdb/parser/index.go
+//
+// Contains functions for parsing `CREATE INDEX` and `DROP INDEX` queries.
+
+package parser
+
+import (
+	"errors"
+	"sdb/db"
+	"sdb/statements"
+	"sdb/utils"
+)
+
+// Parses `CREATE [UNIQUE] INDEX [IF NOT EXISTS] <index_name> ON <table_name>
+// (<columns>);` input.
+func ParseCreateIndexStatement(input string) (db.Executable, error) {
+	trimmed, ok := utils.HasKeyword(input, "create")
+	if !ok {
+		return nil, nil
+	}
+	trimmed, unique := utils.HasKeyword(trimmed, "unique")
+	trimmed, ok = utils.HasKeyword(trimmed, "index")
+	if !ok {
+		return nil, nil
+	}
+	trimmed, ifNotExists := utils.HasKeyword(trimmed, "if not exists")
+
+	indexName := utils.ParseIdentifier(trimmed)
+	if indexName == "" {
+		return nil, errors.New("!Missing index name.")
+	}
+	trimmed, _ = utils.HasPrefix(trimmed, indexName)
+
+	trimmed, ok = utils.HasKeyword(trimmed, "on")
+	if !ok {
+		return nil, errors.New("!Expected ON after index name in CREATE INDEX statement.")
+	}
+
+	tableName := utils.ParseIdentifier(trimmed)
+	if tableName == "" {
+		return nil, errors.New("!Missing table name.")
+	}
+	trimmed, _ = utils.HasPrefix(trimmed, tableName)
+
+	columns, _, err := utils.ParseIdentifierList(trimmed)
+	if err != nil {
+		return nil, err
+	}
+
+	createIndex := statements.CreateIndexStatement{
+		IndexName:   indexName,
+		Unique:      unique,
+		TableName:   tableName,
+		Columns:     columns,
+		IfNotExists: ifNotExists,
+	}
+
+	return createIndex, nil
+}
+
+// Parses `DROP INDEX [IF EXISTS] <index_name>;` input.
+func ParseDropIndexStatement(input string) (db.Executable, error) {
+	trimmed, ok := utils.HasPrefix(input, "drop index")
+	if !ok {
+		return nil, nil
+	}
+	trimmed, ifExists := utils.HasKeyword(trimmed, "if exists")
+
+	indexName := utils.ParseIdentifier(trimmed)
+	if indexName == "" {
+		return nil, errors.New("!Missing index name.")
+	}
+
+	dropIndex := statements.DropIndexStatement{
+		IndexName: indexName,
+		IfExists:  ifExists,
+	}
+
+	return dropIndex, nil
+}
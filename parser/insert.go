@@ -16,27 +16,59 @@ func ParseInsertStatement(input string) (db.Executable, error) {
 	tableName := utils.ParseIdentifier(trimmed)
 	trimmed, _ = utils.HasPrefix(trimmed, tableName)
 
+	// optional list of columns being inserted into
+	var colNames []string
+	if trimmed, ok = utils.HasPrefix(trimmed, "("); ok {
+		colNames = []string{}
+		for {
+			colName := utils.ParseIdentifier(trimmed)
+			if colName == "" {
+				return nil, fmt.Errorf("Expected column name in list of columns to insert into")
+			}
+			trimmed, _ = utils.HasPrefix(trimmed, colName)
+			colNames = append(colNames, colName)
+
+			trimmed, ok = utils.HasPrefix(trimmed, ",")
+			if !ok {
+				break
+			}
+		}
+
+		trimmed, ok = utils.HasPrefix(trimmed, ")")
+		if !ok {
+			return nil, fmt.Errorf("Expected list of columns to insert into to end in ')'")
+		}
+	}
+
 	trimmed, _ = utils.HasPrefix(trimmed, "values")
 	trimmed, ok = utils.HasPrefix(trimmed, "(")
 	if !ok {
 		return nil, fmt.Errorf("Expected 'values' after table to insert into")
 	}
 
-	var valueList []db.Value
-	var err error
-	valueList, trimmed, err = utils.ParseValueList(trimmed)
+	valueList, trimmed, err := utils.ParseExpressionList(trimmed)
 	if err != nil {
 		return nil, err
 	}
 
-	_, ok = utils.HasPrefix(trimmed, ")")
+	trimmed, ok = utils.HasPrefix(trimmed, ")")
 	if !ok {
 		return nil, fmt.Errorf("Expected list of values to end in ')'")
 	}
 
+	returning, trimmed, err := ParseReturningClause(trimmed)
+	if err != nil {
+		return nil, err
+	}
+	if err = checkStatementEnd(trimmed); err != nil {
+		return nil, err
+	}
+
 	statement := statements.InsertStatement{
-		TableName: tableName,
-		Values:    valueList,
+		TableName:   tableName,
+		ColumnNames: colNames,
+		Values:      valueList,
+		Returning:   returning,
 	}
 
 	return statement, nil
@@ -22,11 +22,14 @@ import (
 	"strings"
 )
 
-func ParseJoinClause(input, leftTableName string) (*statements.JoinClause, error) {
+// Parses a join clause following the name of the left table. Returns the
+// clause along with the remaining unparsed input, or nil if input doesn't
+// start with one.
+func ParseJoinClause(input, leftTableName string) (*statements.JoinClause, string, error) {
 	leftTableAlias := utils.ParseIdentifier(input)
 	trimmed, _ := utils.HasPrefix(input, leftTableAlias)
 	if leftTableAlias == "" || trimmed == "" {
-		return nil, nil
+		return nil, input, nil
 	}
 
 	var joinType statements.JoinType
@@ -43,18 +46,17 @@ func ParseJoinClause(input, leftTableName string) (*statements.JoinClause, error
 		joinType = statements.RightOuterJoin
 		trimmed, _ = utils.HasPrefix(trimmed, "right outer join")
 	} else {
-		return nil, nil
+		return nil, input, nil
 	}
 
-	rightTableName := utils.ParseIdentifier(trimmed)
-	trimmed, _ = utils.HasPrefix(trimmed, rightTableName)
+	rightTableName, trimmed := parseTableName(trimmed)
 	rightTableAlias := utils.ParseIdentifier(trimmed)
 	trimmed, _ = utils.HasPrefix(trimmed, rightTableAlias)
 
-	if joinType == statements.InnerJoin {
-		trimmed, _ = utils.HasPrefix(trimmed, "where")
-	} else {
-		trimmed, _ = utils.HasPrefix(trimmed, "on")
+	// `INNER JOIN` can be written with either `ON` or `WHERE`
+	trimmed, ok := utils.HasKeyword(trimmed, "on")
+	if !ok && joinType == statements.InnerJoin {
+		trimmed, _ = utils.HasKeyword(trimmed, "where")
 	}
 
 	trimmed, _ = utils.HasPrefix(trimmed, leftTableAlias)
@@ -79,5 +81,5 @@ func ParseJoinClause(input, leftTableName string) (*statements.JoinClause, error
 		RightTableColumn: rightTableColumn,
 	}
 
-	return joinClause, nil
+	return joinClause, trimmed, nil
 }
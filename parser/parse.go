@@ -22,7 +22,7 @@ import (
 // db.Executable interface is returned to be executed in sdb/main.go.
 func Parse(input string) (db.Executable, error) {
 	input = strings.TrimSpace(input)
-	input = strings.ToLower(input)
+	input = lowercaseOutsideStrings(input)
 
 	if utils.IsComment(input) {
 		return statements.Comment{}, nil
@@ -44,6 +44,46 @@ func Parse(input string) (db.Executable, error) {
 		return dropTable, nil
 	}
 
+	dropIndex, err := ParseDropIndexStatement(input)
+
+	if err != nil {
+		return nil, err
+	} else if dropIndex != nil {
+		return dropIndex, nil
+	}
+
+	dropSequence, err := ParseDropSequenceStatement(input)
+
+	if err != nil {
+		return nil, err
+	} else if dropSequence != nil {
+		return dropSequence, nil
+	}
+
+	dropType, err := ParseDropTypeStatement(input)
+
+	if err != nil {
+		return nil, err
+	} else if dropType != nil {
+		return dropType, nil
+	}
+
+	dropView, err := ParseDropViewStatement(input)
+
+	if err != nil {
+		return nil, err
+	} else if dropView != nil {
+		return dropView, nil
+	}
+
+	dropMaterializedView, err := ParseDropMaterializedViewStatement(input)
+
+	if err != nil {
+		return nil, err
+	} else if dropMaterializedView != nil {
+		return dropMaterializedView, nil
+	}
+
 	useDB, err := ParseUseDBStatement(input)
 
 	if err != nil {
@@ -52,6 +92,22 @@ func Parse(input string) (db.Executable, error) {
 		return useDB, nil
 	}
 
+	show, err := ParseShowStatement(input)
+
+	if err != nil {
+		return nil, err
+	} else if show != nil {
+		return show, nil
+	}
+
+	describe, err := ParseDescribeStatement(input)
+
+	if err != nil {
+		return nil, err
+	} else if describe != nil {
+		return describe, nil
+	}
+
 	selectStatement, err := ParseSelectStatement(input)
 
 	if err != nil {
@@ -84,6 +140,54 @@ func Parse(input string) (db.Executable, error) {
 		return createDB, nil
 	}
 
+	createIndex, err := ParseCreateIndexStatement(input)
+
+	if err != nil {
+		return nil, err
+	} else if createIndex != nil {
+		return createIndex, nil
+	}
+
+	createSequence, err := ParseCreateSequenceStatement(input)
+
+	if err != nil {
+		return nil, err
+	} else if createSequence != nil {
+		return createSequence, nil
+	}
+
+	createType, err := ParseCreateTypeStatement(input)
+
+	if err != nil {
+		return nil, err
+	} else if createType != nil {
+		return createType, nil
+	}
+
+	createView, err := ParseCreateViewStatement(input)
+
+	if err != nil {
+		return nil, err
+	} else if createView != nil {
+		return createView, nil
+	}
+
+	createMaterializedView, err := ParseCreateMaterializedViewStatement(input)
+
+	if err != nil {
+		return nil, err
+	} else if createMaterializedView != nil {
+		return createMaterializedView, nil
+	}
+
+	refreshMaterializedView, err := ParseRefreshMaterializedViewStatement(input)
+
+	if err != nil {
+		return nil, err
+	} else if refreshMaterializedView != nil {
+		return refreshMaterializedView, nil
+	}
+
 	insert, err := ParseInsertStatement(input)
 
 	if err != nil {
@@ -108,6 +212,14 @@ func Parse(input string) (db.Executable, error) {
 		return delete, nil
 	}
 
+	truncate, err := ParseTruncateStatement(input)
+
+	if err != nil {
+		return nil, err
+	} else if truncate != nil {
+		return truncate, nil
+	}
+
 	transaction, err := ParseBeginTransaction(input)
 
 	if err != nil {
@@ -126,3 +238,46 @@ func Parse(input string) (db.Executable, error) {
 
 	return nil, errors.New("!Syntax error.")
 }
+
+// Lowercases keywords and identifiers, leaving the contents of string literals
+// like `'Bob'` and `e'Line\n'` in their original case. A backslash in an
+// escape string escapes the character after it.
+func lowercaseOutsideStrings(input string) string {
+	var builder strings.Builder
+	start := 0
+	for idx := 0; idx < len(input); idx++ {
+		if input[idx] != '\'' {
+			continue
+		}
+		builder.WriteString(strings.ToLower(input[start:idx]))
+
+		escapes := idx > 0 && (input[idx-1] == 'e' || input[idx-1] == 'E') &&
+			(idx == 1 || !isIdentifierByte(input[idx-2]))
+		end := idx + 1
+		for end < len(input) {
+			if input[end] == '\\' && escapes {
+				end += 2
+			} else if strings.HasPrefix(input[end:], "''") {
+				end += 2
+			} else if input[end] == '\'' {
+				break
+			} else {
+				end++
+			}
+		}
+		if end >= len(input) {
+			// unterminated strings are reported by the statement's parser
+			return builder.String() + input[idx:]
+		}
+		builder.WriteString(input[idx : end+1])
+		start = end + 1
+		idx = end
+	}
+	builder.WriteString(strings.ToLower(input[start:]))
+	return builder.String()
+}
+
+func isIdentifierByte(char byte) bool {
+	return char == '_' || (char >= 'a' && char <= 'z') ||
+		(char >= 'A' && char <= 'Z') || (char >= '0' && char <= '9')
+}
@@ -0,0 +1,48 @@
+// sdb/parser/returning.go
+//
+// Contains functions for parsing `RETURNING` clauses at the end of `INSERT`,
+// `UPDATE`, and `DELETE` statements, and for checking nothing follows them.
+
+package parser
+
+import (
+	"fmt"
+	"sdb/statements"
+	"sdb/utils"
+	"strings"
+)
+
+// Parses `RETURNING *` or `RETURNING <expression>, ...` input. Returns nil if
+// the input does not start with `RETURNING`, along with the remaining input.
+func ParseReturningClause(input string) (*statements.ReturningClause, string, error) {
+	trimmed, ok := utils.HasKeyword(input, "returning")
+	if !ok {
+		return nil, input, nil
+	}
+
+	if trimmed, ok = utils.HasPrefix(trimmed, "*"); ok {
+		return &statements.ReturningClause{AllColumns: true}, trimmed, nil
+	}
+
+	expressions, trimmed, err := utils.ParseExpressionList(trimmed)
+	if err != nil {
+		return nil, input, err
+	}
+
+	returning := statements.ReturningClause{
+		Expressions: expressions,
+	}
+
+	return &returning, trimmed, nil
+}
+
+// Checks that nothing but the `;` ending a statement, optionally followed by a
+// comment, is left after parsing it, so that input the parser doesn't
+// understand, like `WHERE b IN (1, 2)`, is an error rather than ignored.
+func checkStatementEnd(input string) error {
+	rest, _ := utils.HasPrefix(input, ";")
+	if rest != "" && !strings.HasPrefix(rest, "--") {
+		return fmt.Errorf("!Unexpected input `%v` at end of statement.", input)
+	}
+	return nil
+}
@@ -20,43 +20,131 @@ func ParseSelectStatement(input string) (db.Executable, error) {
 		return nil, nil
 	}
 
-	colNames := []string{}
-	for {
-		ident := utils.ParseIdentifier(trimmed)
-		trimmed, _ = utils.HasPrefix(trimmed, ident)
+	allColumns := false
+	var columns []statements.SelectedColumn
+	if trimmed, allColumns = utils.HasPrefix(trimmed, "*"); !allColumns {
+		for {
+			expression, rest, err := utils.ParseExpression(trimmed)
+			if err != nil {
+				return nil, err
+			}
+			selected := statements.SelectedColumn{Expression: expression}
 
-		colNames = append(colNames, ident)
-		if ident == "*" {
-			break
-		}
+			if rest, ok = utils.HasKeyword(rest, "as"); ok {
+				selected.Alias = utils.ParseIdentifier(rest)
+				if selected.Alias == "" {
+					return nil, fmt.Errorf("!Expected column name after AS.")
+				}
+				rest, _ = utils.HasPrefix(rest, selected.Alias)
+			}
+			columns = append(columns, selected)
 
-		trimmed, ok = utils.HasPrefix(trimmed, ",")
-		if !ok {
-			break
+			trimmed, ok = utils.HasPrefix(rest, ",")
+			if !ok {
+				break
+			}
 		}
 	}
 
-	trimmed, ok = utils.HasPrefix(trimmed, "from")
-	if !ok {
+	// a SELECT without FROM, like `SELECT nextval('ids');`, selects from a
+	// single row with no columns
+	tableName := ""
+	var joinClause *statements.JoinClause
+	var err error
+	if trimmed, ok = utils.HasPrefix(trimmed, "from"); ok {
+		tableName, trimmed = parseTableName(trimmed)
+		joinClause, trimmed, err = ParseJoinClause(trimmed, tableName)
+		if err != nil {
+			return nil, err
+		}
+	} else if allColumns {
 		return nil, fmt.Errorf("Expected `FROM` after columns in `SELECT`.")
 	}
 
-	tableName := utils.ParseIdentifier(trimmed)
-	trimmed, _ = utils.HasPrefix(trimmed, tableName)
+	// further conditions of an inner join, as in `FROM a x, b y WHERE x.id =
+	// y.id AND y.n > 1`, filter the joined rows like a WHERE clause
+	if rest, ok := utils.HasKeyword(trimmed, "and"); ok &&
+		joinClause != nil && joinClause.JoinType == statements.InnerJoin {
+		trimmed = "where " + rest
+	}
+	where, trimmed, err := ParseWhereClause(trimmed)
+	if err != nil {
+		return nil, err
+	}
 
-	where, _ := ParseWhereClause(trimmed)
+	var groupBy []db.Expression
+	if rest, ok := utils.HasPrefix(trimmed, "group by"); ok {
+		groupBy, trimmed, err = utils.ParseExpressionList(rest)
+		if err != nil {
+			return nil, err
+		}
+	}
 
-	var joinClause *statements.JoinClause
-	if where == nil {
-		joinClause, _ = ParseJoinClause(trimmed, tableName)
+	orderBy, trimmed, err := parseOrderBy(trimmed)
+	if err != nil {
+		return nil, err
+	}
+	if err = checkStatementEnd(trimmed); err != nil {
+		return nil, err
 	}
 
 	statement := statements.SelectStatement{
 		TableName:   tableName,
-		ColumnNames: colNames,
+		AllColumns:  allColumns,
+		Columns:     columns,
 		WhereClause: where,
 		JoinClause:  joinClause,
+		GroupBy:     groupBy,
+		OrderBy:     orderBy,
 	}
 
 	return statement, nil
 }
+
+// Parses `ORDER BY <expression> [ASC | DESC], ...`. Returns nil if input
+// doesn't start with `ORDER BY`, along with the remaining unparsed input.
+func parseOrderBy(input string) ([]statements.OrderTerm, string, error) {
+	trimmed, ok := utils.HasPrefix(input, "order by")
+	if !ok {
+		return nil, input, nil
+	}
+
+	var orderBy []statements.OrderTerm
+	for {
+		expression, rest, err := utils.ParseExpression(trimmed)
+		if err != nil {
+			return nil, input, err
+		}
+		term := statements.OrderTerm{Expression: expression}
+
+		if rest, ok = utils.HasKeyword(rest, "desc"); ok {
+			term.Descending = true
+		} else {
+			rest, _ = utils.HasKeyword(rest, "asc")
+		}
+		orderBy = append(orderBy, term)
+
+		trimmed, ok = utils.HasPrefix(rest, ",")
+		if !ok {
+			return orderBy, trimmed, nil
+		}
+	}
+}
+
+// Parses the name of a table being selected from, which may be qualified by a
+// schema as in `information_schema.tables`. Returns the name along with the
+// remaining unparsed input.
+func parseTableName(input string) (string, string) {
+	tableName := utils.ParseIdentifier(input)
+	trimmed, _ := utils.HasPrefix(input, tableName)
+
+	if rest, ok := utils.HasPrefix(trimmed, "."); ok && tableName != "" {
+		qualifiedName := utils.ParseIdentifier(rest)
+		if qualifiedName != "" {
+			trimmed, _ = utils.HasPrefix(rest, qualifiedName)
+			tableName = tableName + "." + qualifiedName
+		}
+	}
+
+	return tableName, trimmed
+}
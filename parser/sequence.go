@@ -0,0 +1,97 @@
+// sdb/parser/sequence.go
+//
+// Contains functions for parsing `CREATE SEQUENCE` and `DROP SEQUENCE` queries.
+
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"sdb/db"
+	"sdb/statements"
+	"sdb/utils"
+	"strconv"
+	"strings"
+)
+
+// Parses `CREATE SEQUENCE [IF NOT EXISTS] <name> [START [WITH] <n>]
+// [INCREMENT [BY] <n>];` input. Sequences start at 1 and increment by 1 unless
+// given otherwise.
+func ParseCreateSequenceStatement(input string) (db.Executable, error) {
+	trimmed, ok := utils.HasPrefix(input, "create sequence")
+	if !ok {
+		return nil, nil
+	}
+	trimmed, ifNotExists := utils.HasKeyword(trimmed, "if not exists")
+
+	sequenceName := utils.ParseIdentifier(trimmed)
+	if sequenceName == "" {
+		return nil, errors.New("!Missing sequence name.")
+	}
+	trimmed, _ = utils.HasPrefix(trimmed, sequenceName)
+
+	statement := statements.CreateSequenceStatement{
+		SequenceName: sequenceName,
+		Start:        1,
+		Increment:    1,
+		IfNotExists:  ifNotExists,
+	}
+
+	var err error
+	for {
+		if rest, ok := utils.HasKeyword(trimmed, "start"); ok {
+			rest, _ = utils.HasKeyword(rest, "with")
+			statement.Start, trimmed, err = parseSequenceNumber(rest, "START")
+		} else if rest, ok := utils.HasKeyword(trimmed, "increment"); ok {
+			rest, _ = utils.HasKeyword(rest, "by")
+			statement.Increment, trimmed, err = parseSequenceNumber(rest, "INCREMENT")
+		} else {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if statement.Increment == 0 {
+		return nil, errors.New("!INCREMENT of a sequence can't be 0.")
+	}
+
+	return statement, nil
+}
+
+// Parses the integer given for a sequence option, which may be negative.
+func parseSequenceNumber(input string, option string) (int64, string, error) {
+	end := strings.IndexAny(input, " ;")
+	if end < 0 {
+		end = len(input)
+	}
+
+	number, err := strconv.ParseInt(input[:end], 10, 64)
+	if err != nil {
+		return 0, input, fmt.Errorf("!Expected integer after %v.", option)
+	}
+
+	return number, strings.TrimSpace(input[end:]), nil
+}
+
+// Parses `DROP SEQUENCE [IF EXISTS] <name>;` input.
+func ParseDropSequenceStatement(input string) (db.Executable, error) {
+	trimmed, ok := utils.HasPrefix(input, "drop sequence")
+	if !ok {
+		return nil, nil
+	}
+	trimmed, ifExists := utils.HasKeyword(trimmed, "if exists")
+
+	sequenceName := utils.ParseIdentifier(trimmed)
+	if sequenceName == "" {
+		return nil, errors.New("!Missing sequence name.")
+	}
+
+	dropSequence := statements.DropSequenceStatement{
+		SequenceName: sequenceName,
+		IfExists:     ifExists,
+	}
+
+	return dropSequence, nil
+}
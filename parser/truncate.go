@@ -0,0 +1,36 @@
+// sdb/parser/truncate.go
+//
+// Contains function for parsing `TRUNCATE TABLE` queries.
+
+package parser
+
+import (
+	"errors"
+	"sdb/db"
+	"sdb/statements"
+	"sdb/utils"
+)
+
+// Parses `TRUNCATE [TABLE] <table_name>;` input.
+func ParseTruncateStatement(input string) (db.Executable, error) {
+	trimmed, ok := utils.HasKeyword(input, "truncate")
+	if !ok {
+		return nil, nil
+	}
+	trimmed, _ = utils.HasKeyword(trimmed, "table")
+
+	tableName := utils.ParseIdentifier(trimmed)
+	if tableName == "" {
+		return nil, errors.New("!Expected table name after TRUNCATE.")
+	}
+	trimmed, _ = utils.HasPrefix(trimmed, tableName)
+	if err := checkStatementEnd(trimmed); err != nil {
+		return nil, err
+	}
+
+	truncate := statements.TruncateStatement{
+		TableName: tableName,
+	}
+
+	return truncate, nil
+}
@@ -0,0 +1,76 @@
+// sdb/parser/type.go
+//
+// Contains functions for parsing `CREATE TYPE` and `DROP TYPE` queries.
+
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"sdb/db"
+	"sdb/statements"
+	"sdb/utils"
+)
+
+// Parses `CREATE TYPE <name> AS ENUM ('<label>', ...);` input.
+func ParseCreateTypeStatement(input string) (db.Executable, error) {
+	trimmed, ok := utils.HasPrefix(input, "create type")
+	if !ok {
+		return nil, nil
+	}
+
+	typeName := utils.ParseIdentifier(trimmed)
+	if typeName == "" {
+		return nil, errors.New("!Missing type name.")
+	}
+	trimmed, _ = utils.HasPrefix(trimmed, typeName)
+
+	trimmed, ok = utils.HasKeyword(trimmed, "as enum")
+	if !ok {
+		return nil, fmt.Errorf("!Expected AS ENUM after type name %v.", typeName)
+	}
+	trimmed, ok = utils.HasPrefix(trimmed, "(")
+	if !ok {
+		return nil, fmt.Errorf("!Expected labels of enum type %v.", typeName)
+	}
+	labels, trimmed, err := utils.ParseValueList(trimmed)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok = utils.HasPrefix(trimmed, ")"); !ok {
+		return nil, fmt.Errorf("!Expected ')' after labels of enum type %v.", typeName)
+	}
+
+	statement := statements.CreateTypeStatement{TypeName: typeName}
+	for _, label := range labels {
+		text, isString := label.Value.(string)
+		if !isString {
+			return nil, fmt.Errorf("!Label %v of enum type %v is not a string.",
+				label.ToString(), typeName)
+		}
+		statement.Labels = append(statement.Labels, text)
+	}
+
+	return statement, nil
+}
+
+// Parses `DROP TYPE [IF EXISTS] <name>;` input.
+func ParseDropTypeStatement(input string) (db.Executable, error) {
+	trimmed, ok := utils.HasPrefix(input, "drop type")
+	if !ok {
+		return nil, nil
+	}
+	trimmed, ifExists := utils.HasKeyword(trimmed, "if exists")
+
+	typeName := utils.ParseIdentifier(trimmed)
+	if typeName == "" {
+		return nil, errors.New("!Missing type name.")
+	}
+
+	dropType := statements.DropTypeStatement{
+		TypeName: typeName,
+		IfExists: ifExists,
+	}
+
+	return dropType, nil
+}
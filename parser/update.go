@@ -21,16 +21,30 @@ func ParseUpdateStatement(input string) (db.Executable, error) {
 
 	trimmed, _ = utils.HasPrefix(trimmed, "=")
 
-	value, _ := utils.ParseValue(trimmed)
-	trimmed, _ = utils.HasPrefix(trimmed, value.ToString())
+	value, trimmed, err := utils.ParseExpression(trimmed)
+	if err != nil {
+		return nil, err
+	}
+
+	where, trimmed, err := ParseWhereClause(trimmed)
+	if err != nil {
+		return nil, err
+	}
 
-	where, _ := ParseWhereClause(trimmed)
+	returning, trimmed, err := ParseReturningClause(trimmed)
+	if err != nil {
+		return nil, err
+	}
+	if err = checkStatementEnd(trimmed); err != nil {
+		return nil, err
+	}
 
 	update := statements.UpdateStatement{
 		TableName:    tableName,
 		UpdatedCol:   colName,
 		UpdatedValue: value,
 		WhereClause:  where,
+		Returning:    returning,
 	}
 
 	return update, nil
@@ -0,0 +1,175 @@
+// sdb/parser/view.go
+//
+// Contains functions for parsing `CREATE VIEW` and `DROP VIEW` queries, and
+// their `MATERIALIZED VIEW` counterparts.
+
+package parser
+
+import (
+	"errors"
+	"sdb/db"
+	"sdb/statements"
+	"sdb/utils"
+)
+
+// Views are stored as the text of their query, which the statements package
+// can't parse itself.
+func init() {
+	statements.ParseViewQuery = parseViewQuery
+}
+
+// Parses `CREATE [OR REPLACE] VIEW [IF NOT EXISTS] <view_name> AS SELECT ...;`
+// input.
+func ParseCreateViewStatement(input string) (db.Executable, error) {
+	trimmed, ok := utils.HasKeyword(input, "create")
+	if !ok {
+		return nil, nil
+	}
+	trimmed, orReplace := utils.HasKeyword(trimmed, "or replace")
+	trimmed, ok = utils.HasKeyword(trimmed, "view")
+	if !ok {
+		return nil, nil
+	}
+	trimmed, ifNotExists := utils.HasKeyword(trimmed, "if not exists")
+	if orReplace && ifNotExists {
+		return nil, errors.New("!CREATE VIEW can't have both OR REPLACE and IF NOT EXISTS.")
+	}
+
+	viewName := utils.ParseIdentifier(trimmed)
+	if viewName == "" {
+		return nil, errors.New("!Missing view name.")
+	}
+	trimmed, _ = utils.HasPrefix(trimmed, viewName)
+
+	query, ok := utils.HasKeyword(trimmed, "as")
+	if !ok {
+		return nil, errors.New("!Expected AS after view name in CREATE VIEW statement.")
+	}
+
+	selectStatement, err := parseViewQuery(query)
+	if err != nil {
+		return nil, err
+	}
+
+	createView := statements.CreateViewStatement{
+		ViewName:    viewName,
+		OrReplace:   orReplace,
+		IfNotExists: ifNotExists,
+		Query:       query,
+		Select:      selectStatement,
+	}
+
+	return createView, nil
+}
+
+// Parses `DROP VIEW [IF EXISTS] <view_name>;` input.
+func ParseDropViewStatement(input string) (db.Executable, error) {
+	trimmed, ok := utils.HasPrefix(input, "drop view")
+	if !ok {
+		return nil, nil
+	}
+	trimmed, ifExists := utils.HasKeyword(trimmed, "if exists")
+
+	viewName := utils.ParseIdentifier(trimmed)
+	if viewName == "" {
+		return nil, errors.New("!Missing view name.")
+	}
+
+	dropView := statements.DropViewStatement{
+		ViewName: viewName,
+		IfExists: ifExists,
+	}
+
+	return dropView, nil
+}
+
+// Parses `CREATE MATERIALIZED VIEW [IF NOT EXISTS] <view_name> AS SELECT ...;`
+// input.
+func ParseCreateMaterializedViewStatement(input string) (db.Executable, error) {
+	trimmed, ok := utils.HasPrefix(input, "create materialized view")
+	if !ok {
+		return nil, nil
+	}
+	trimmed, ifNotExists := utils.HasKeyword(trimmed, "if not exists")
+
+	viewName := utils.ParseIdentifier(trimmed)
+	if viewName == "" {
+		return nil, errors.New("!Missing view name.")
+	}
+	trimmed, _ = utils.HasPrefix(trimmed, viewName)
+
+	query, ok := utils.HasKeyword(trimmed, "as")
+	if !ok {
+		return nil, errors.New(
+			"!Expected AS after view name in CREATE MATERIALIZED VIEW statement.",
+		)
+	}
+
+	selectStatement, err := parseViewQuery(query)
+	if err != nil {
+		return nil, err
+	}
+
+	createView := statements.CreateMaterializedViewStatement{
+		ViewName:    viewName,
+		Query:       query,
+		Select:      selectStatement,
+		IfNotExists: ifNotExists,
+	}
+
+	return createView, nil
+}
+
+// Parses `REFRESH MATERIALIZED VIEW <view_name>;` input.
+func ParseRefreshMaterializedViewStatement(input string) (db.Executable, error) {
+	trimmed, ok := utils.HasPrefix(input, "refresh materialized view")
+	if !ok {
+		return nil, nil
+	}
+
+	viewName := utils.ParseIdentifier(trimmed)
+	if viewName == "" {
+		return nil, errors.New("!Missing view name.")
+	}
+
+	refreshView := statements.RefreshMaterializedViewStatement{
+		ViewName: viewName,
+	}
+
+	return refreshView, nil
+}
+
+// Parses `DROP MATERIALIZED VIEW [IF EXISTS] <view_name>;` input.
+func ParseDropMaterializedViewStatement(input string) (db.Executable, error) {
+	trimmed, ok := utils.HasPrefix(input, "drop materialized view")
+	if !ok {
+		return nil, nil
+	}
+	trimmed, ifExists := utils.HasKeyword(trimmed, "if exists")
+
+	viewName := utils.ParseIdentifier(trimmed)
+	if viewName == "" {
+		return nil, errors.New("!Missing view name.")
+	}
+
+	dropView := statements.DropMaterializedViewStatement{
+		ViewName: viewName,
+		IfExists: ifExists,
+	}
+
+	return dropView, nil
+}
+
+// Parses the `SELECT` query of a view.
+func parseViewQuery(query string) (statements.SelectStatement, error) {
+	selectStatement, err := ParseSelectStatement(query)
+	if err != nil {
+		return statements.SelectStatement{}, err
+	}
+	if selectStatement == nil {
+		return statements.SelectStatement{}, errors.New(
+			"!Expected SELECT query after AS in CREATE VIEW statement.",
+		)
+	}
+	return selectStatement.(statements.SelectStatement), nil
+}
@@ -5,31 +5,17 @@ import (
 	"sdb/utils"
 )
 
-func ParseWhereClause(input string) (*statements.WhereClause, error) {
+// Parses `WHERE <condition>`, see `statements.NewWhereClause`.
+func ParseWhereClause(input string) (*statements.WhereClause, string, error) {
 	trimmed, ok := utils.HasPrefix(input, "where")
 	if !ok {
-		return nil, nil
+		return nil, input, nil
 	}
 
-	colName := utils.ParseIdentifier(trimmed)
-	trimmed, _ = utils.HasPrefix(trimmed, colName)
-
-	var comparison string
-	if trimmed[0] == '=' || trimmed[0] == '<' || trimmed[0] == '>' {
-		comparison = string(trimmed[0])
-	} else if trimmed[:2] == "!=" || trimmed[:2] == "<=" || trimmed[:2] == ">=" {
-		comparison = string(trimmed[:2])
-	}
-
-	trimmed, _ = utils.HasPrefix(trimmed, comparison)
-
-	value, _ := utils.ParseValue(trimmed)
-
-	where := statements.WhereClause{
-		ColName:         colName,
-		Comparison:      comparison,
-		ComparisonValue: value,
+	condition, trimmed, err := utils.ParseExpression(trimmed)
+	if err != nil {
+		return nil, input, err
 	}
 
-	return &where, nil
+	return statements.NewWhereClause(condition), trimmed, nil
 }
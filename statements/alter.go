@@ -7,62 +7,596 @@
 package statements
 
 import (
-	"bufio"
 	"fmt"
 	"os"
 	"sdb/db"
 	"sdb/utils"
-	"strings"
 )
 
+type AlterAction string
+
+const (
+	AlterAddColumn    AlterAction = "add column"
+	AlterDropColumn   AlterAction = "drop column"
+	AlterRenameColumn AlterAction = "rename column"
+	AlterRenameTable  AlterAction = "rename to"
+	AlterColumnType   AlterAction = "alter column type"
+	AlterSetNotNull   AlterAction = "set not null"
+	AlterDropNotNull  AlterAction = "drop not null"
+	AlterSetDefault   AlterAction = "set default"
+	AlterDropDefault  AlterAction = "drop default"
+)
+
+// `Column` is the definition of the column added by `ADD COLUMN`, and `Keys`
+// and `ForeignKeys` are any `PRIMARY KEY`, `UNIQUE`, or `REFERENCES`
+// constraints declared with it. `NewName` is
+// the new column name for `RENAME COLUMN`, or the new table name for
+// `RENAME TO`. `Using` is the optional expression used to compute the converted
+// values in `ALTER COLUMN ... TYPE`, and `Default` is the new default for
+// `ALTER COLUMN ... SET DEFAULT`.
 type AlterStatement struct {
-	TableName  string
-	ColumnName string
-	ColumnType db.Type
+	TableName   string
+	Action      AlterAction
+	ColumnName  string
+	ColumnType  db.Type
+	Column      db.Column
+	Keys        []db.KeyConstraint
+	ForeignKeys []db.ForeignKey
+	NewName     string
+	Using       db.Expression
+	Default     db.Expression
 }
 
-// Executes `ALTER TABLE <table_name> ADD <column_name> <column_type>;`
-// statements.
+// Executes `ALTER TABLE <table_name> <action>;` statements, where action is
+// one of:
+// ADD [COLUMN] <column_name> <column_type> [<constraints>]
+// DROP [COLUMN] <column_name>
+// RENAME [COLUMN] <column_name> TO <new_name>
+// RENAME TO <new_table_name>
+// ALTER [COLUMN] <column_name> TYPE <column_type> [USING <expression>]
+// ALTER [COLUMN] <column_name> SET NOT NULL | DROP NOT NULL
+// ALTER [COLUMN] <column_name> SET DEFAULT <expression> | DROP DEFAULT
 func (statement AlterStatement) Execute(state *db.DBState) error {
-	tableFile, err := utils.OpenTable(state, statement.TableName, os.O_RDWR)
-	if err != nil {
+	if _, exists := utils.TableExists(state, statement.TableName); !exists {
 		return fmt.Errorf(
 			"!Failed to alter table %v because it does not exist.",
 			statement.TableName,
 		)
 	}
-	defer tableFile.Close()
 
-	// read current header from table file
-	reader := bufio.NewReader(tableFile)
-	currentCols, err := reader.ReadString('\n')
-	currentCols = currentCols[:len(currentCols)-1] // chop off last `\n` char
+	err := checkNotMaterializedView(state, statement.TableName)
+	if err != nil {
+		return err
+	}
+
+	// enum types are only named by the statement
+	catalog, err := utils.LoadCatalog(state)
+	if err != nil {
+		return err
+	}
+	statement.ColumnType, err = catalog.ResolveType(statement.ColumnType)
+	if err != nil {
+		return err
+	}
+	statement.Column.Type, err = catalog.ResolveType(statement.Column.Type)
+	if err != nil {
+		return err
+	}
+
+	if state.TableLockExists(statement.TableName) {
+		return fmt.Errorf("!Table %v is locked.", statement.TableName)
+	}
 
+	// columns referenced by foreign keys of other tables can't be renamed or
+	// dropped, and neither can the table itself
+	references, err := referencingForeignKeys(state, statement.TableName)
 	if err != nil {
 		return err
 	}
+	for _, reference := range references {
+		if reference.childTable == statement.TableName {
+			continue
+		}
+		referenced := statement.Action == AlterRenameTable ||
+			(statement.Action == AlterDropColumn ||
+				statement.Action == AlterRenameColumn) &&
+				containsString(reference.foreignKey.RefColumns, statement.ColumnName)
+		if referenced {
+			return fmt.Errorf(
+				"!Failed to alter table %v because it is referenced by a "+
+					"foreign key of table %v.",
+				statement.TableName,
+				reference.childTable,
+			)
+		}
+	}
+
+	// views must still find the table and the columns they use
+	dependentColumn := ""
+	switch statement.Action {
+	case AlterDropColumn, AlterRenameColumn, AlterColumnType:
+		dependentColumn = statement.ColumnName
+	}
+	if statement.Action == AlterRenameTable || dependentColumn != "" {
+		dependent, err := findDependentView(state, statement.TableName, dependentColumn)
+		if err != nil {
+			return err
+		}
+		if dependent != "" {
+			return fmt.Errorf(
+				"!Failed to alter table %v because view %v depends on it.",
+				statement.TableName,
+				dependent,
+			)
+		}
+	}
+
+	if statement.Action == AlterRenameTable {
+		return statement.renameTable(state)
+	}
+
+	schema, rows, err := utils.ReadTable(state, statement.TableName)
+	if err != nil {
+		return err
+	}
+	columns := schema.Columns
+
+	colIdx := -1
+	for idx, column := range columns {
+		if column.Name == statement.ColumnName {
+			colIdx = idx
+		}
+	}
+
+	// identity columns must stay NOT NULL ints whose default is their sequence
+	if colIdx >= 0 && columns[colIdx].Identity != "" {
+		_, toInt := statement.ColumnType.(db.Int)
+		identityChanged := statement.Action == AlterSetDefault ||
+			statement.Action == AlterDropDefault ||
+			statement.Action == AlterDropNotNull ||
+			statement.Action == AlterColumnType && !toInt
+		if identityChanged {
+			return fmt.Errorf(
+				"!Cannot alter column %v of table %v, it is an identity column.",
+				statement.ColumnName,
+				statement.TableName,
+			)
+		}
+	}
+
+	droppedSequence := ""
+	switch statement.Action {
+	case AlterAddColumn:
+		if colIdx >= 0 {
+			return fmt.Errorf(
+				"!Column %v already exists in table %v.",
+				statement.ColumnName,
+				statement.TableName,
+			)
+		}
 
-	// create new header string based off current header
-	var builder strings.Builder
-	builder.WriteString(currentCols)
-	builder.WriteString(
-		fmt.Sprintf(", %v %v\n",
+		// existing rows of an identity column are numbered from 1, and its
+		// sequence is only created once everything else has succeeded
+		if statement.Column.Identity != "" {
+			err = validateIdentityColumn(statement.TableName, statement.Column)
+			if err != nil {
+				return err
+			}
+			for rowIdx := range rows {
+				rows[rowIdx] = append(
+					rows[rowIdx], db.Value{Value: int64(rowIdx + 1), Type: db.Int{}},
+				)
+			}
+		}
+
+		// otherwise existing rows are back-filled with the new column's
+		// default, computed separately for each row
+		for rowIdx := range rows {
+			if statement.Column.Identity != "" {
+				break
+			}
+			value, err := defaultValue(state, statement.Column)
+			if err != nil {
+				return err
+			}
+			assigned, err := assignValue(*value, nil, statement.Column)
+			if err != nil {
+				return fmt.Errorf(
+					"!Default %v is not of type %v",
+					value.ToString(),
+					statement.Column.Type.ToString(),
+				)
+			}
+			rows[rowIdx] = append(rows[rowIdx], assigned)
+		}
+
+		columns = append(columns, statement.Column)
+		schema.Keys = append(schema.Keys, statement.Keys...)
+		schema.ForeignKeys = append(schema.ForeignKeys, statement.ForeignKeys...)
+
+	case AlterDropColumn:
+		if colIdx < 0 {
+			return statement.missingColumnError()
+		}
+		if len(columns) == 1 {
+			return fmt.Errorf(
+				"!Cannot drop %v, the only column of table %v.",
+				statement.ColumnName,
+				statement.TableName,
+			)
+		}
+
+		err = checkNotReferenced(statement.TableName, schema, colIdx)
+		if err != nil {
+			return err
+		}
+
+		droppedSequence = columns[colIdx].IdentitySequence()
+		columns = append(columns[:colIdx], columns[colIdx+1:]...)
+		for rowIdx, row := range rows {
+			rows[rowIdx] = append(row[:colIdx], row[colIdx+1:]...)
+		}
+
+	case AlterRenameColumn:
+		if colIdx < 0 {
+			return statement.missingColumnError()
+		}
+		for _, column := range columns {
+			if column.Name == statement.NewName {
+				return fmt.Errorf(
+					"!Column %v already exists in table %v.",
+					statement.NewName,
+					statement.TableName,
+				)
+			}
+		}
+
+		columns[colIdx].Name = statement.NewName
+
+		// constraints referring to the old name are updated to the new one
+		rename := func(ref db.ColumnRef) db.Expression {
+			if ref.Name == statement.ColumnName {
+				return db.ColumnRef{Name: statement.NewName}
+			}
+			return ref
+		}
+		for idx, column := range columns {
+			if column.Check != nil {
+				columns[idx].Check = db.ReplaceColumnRefs(column.Check, rename)
+			}
+		}
+		for _, key := range schema.Keys {
+			renameInList(key.Columns, statement.ColumnName, statement.NewName)
+		}
+		for _, foreignKey := range schema.ForeignKeys {
+			renameInList(foreignKey.Columns, statement.ColumnName, statement.NewName)
+			if foreignKey.RefTable == statement.TableName {
+				renameInList(
+					foreignKey.RefColumns, statement.ColumnName, statement.NewName,
+				)
+			}
+		}
+		for _, index := range schema.Indexes {
+			renameInList(index.Columns, statement.ColumnName, statement.NewName)
+		}
+
+	case AlterColumnType:
+		if colIdx < 0 {
+			return statement.missingColumnError()
+		}
+
+		// values are converted the way `CAST` converts them, and every row is
+		// converted before anything is written, so a single invalid value
+		// leaves the table untouched
+		using := statement.Using
+		if using == nil {
+			using = db.ColumnRef{Name: statement.ColumnName}
+		}
+		colMap := columnsToColMap(columns)
+		for rowIdx, row := range rows {
+			value, err := using.Evaluate(colMap, row)
+			if err != nil {
+				return err
+			}
+
+			converted, err := db.Cast(*value, statement.ColumnType)
+			if err != nil {
+				return fmt.Errorf(
+					"!Failed to alter column %v to type %v: %v",
+					statement.ColumnName,
+					statement.ColumnType.ToString(),
+					err,
+				)
+			}
+			rows[rowIdx][colIdx] = *converted
+		}
+
+		columns[colIdx].Type = statement.ColumnType
+
+	case AlterSetNotNull, AlterDropNotNull:
+		if colIdx < 0 {
+			return statement.missingColumnError()
+		}
+		columns[colIdx].NotNull = statement.Action == AlterSetNotNull
+
+	case AlterSetDefault, AlterDropDefault:
+		if colIdx < 0 {
+			return statement.missingColumnError()
+		}
+		columns[colIdx].Default = statement.Default
+	}
+
+	// existing rows must satisfy the altered table's constraints
+	schema.Columns = columns
+	for _, row := range rows {
+		err = checkConstraints(statement.TableName, columns, row)
+		if err != nil {
+			return err
+		}
+	}
+	err = checkKeys(statement.TableName, schema, rows)
+	if err != nil {
+		return err
+	}
+	if statement.Action == AlterAddColumn && len(statement.ForeignKeys) > 0 {
+		err = validateForeignKeys(state, statement.TableName, schema)
+		if err != nil {
+			return err
+		}
+		err = checkTemporaryReferences(
+			state, statement.TableName, state.IsTemporaryTable(statement.TableName), schema,
+		)
+		if err != nil {
+			return err
+		}
+		err = checkForeignKeys(state, statement.TableName, schema, rows, rows)
+		if err != nil {
+			return err
+		}
+	}
+
+	addedIdentity := statement.Action == AlterAddColumn &&
+		statement.Column.Identity != ""
+	if addedIdentity && state.IsTemporaryTable(statement.TableName) {
+		return fmt.Errorf(
+			"!Temporary table %v can't have identity column %v.",
+			statement.TableName,
+			statement.ColumnName,
+		)
+	}
+	if addedIdentity {
+		err = utils.UpdateCatalog(state, func(catalog *db.Catalog) error {
+			return createIdentitySequence(
+				state,
+				catalog,
+				statement.TableName,
+				&columns[len(columns)-1],
+				int64(len(rows)+1),
+			)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	err = utils.WriteTable(state, statement.TableName, schema, rows)
+	if err != nil {
+		if addedIdentity {
+			dropSequence(state, columns[len(columns)-1].IdentitySequence())
+		}
+		return err
+	}
+
+	// a dropped identity column's sequence goes with it
+	if statement.Action == AlterDropColumn && droppedSequence != "" {
+		dropSequence(state, droppedSequence)
+	}
+
+	switch statement.Action {
+	case AlterAddColumn:
+		fmt.Printf(
+			"Table %v modified, added column %v.\n",
+			statement.TableName,
+			statement.ColumnName,
+		)
+	case AlterDropColumn:
+		fmt.Printf(
+			"Table %v modified, dropped column %v.\n",
+			statement.TableName,
+			statement.ColumnName,
+		)
+	case AlterRenameColumn:
+		fmt.Printf(
+			"Table %v modified, renamed column %v to %v.\n",
+			statement.TableName,
+			statement.ColumnName,
+			statement.NewName,
+		)
+	case AlterColumnType:
+		fmt.Printf(
+			"Table %v modified, column %v is now %v.\n",
+			statement.TableName,
 			statement.ColumnName,
 			statement.ColumnType.ToString(),
-		),
-	)
+		)
+	case AlterSetNotNull:
+		fmt.Printf(
+			"Table %v modified, column %v is now NOT NULL.\n",
+			statement.TableName,
+			statement.ColumnName,
+		)
+	case AlterDropNotNull:
+		fmt.Printf(
+			"Table %v modified, column %v is now nullable.\n",
+			statement.TableName,
+			statement.ColumnName,
+		)
+	case AlterSetDefault:
+		fmt.Printf(
+			"Table %v modified, column %v now defaults to %v.\n",
+			statement.TableName,
+			statement.ColumnName,
+			statement.Default.ToString(),
+		)
+	case AlterDropDefault:
+		fmt.Printf(
+			"Table %v modified, dropped default of column %v.\n",
+			statement.TableName,
+			statement.ColumnName,
+		)
+	}
+
+	return nil
+}
+
+// Returns an error if a key or a constraint on any other column of the table
+// refers to the column at `colIdx`, which would break if the column were
+// dropped.
+func checkNotReferenced(tableName string, schema *db.TableSchema, colIdx int) error {
+	colName := schema.Columns[colIdx].Name
+	for _, foreignKey := range schema.ForeignKeys {
+		referenced := containsString(foreignKey.Columns, colName) ||
+			foreignKey.RefTable == tableName &&
+				containsString(foreignKey.RefColumns, colName)
+		if referenced {
+			return fmt.Errorf(
+				"!Cannot drop column %v of table %v, it is part of %v.",
+				colName,
+				tableName,
+				foreignKey.ToString(),
+			)
+		}
+	}
+	for _, key := range schema.Keys {
+		for _, keyColName := range key.Columns {
+			if keyColName == colName {
+				return fmt.Errorf(
+					"!Cannot drop column %v of table %v, it is part of %v.",
+					colName,
+					tableName,
+					key.ToString(),
+				)
+			}
+		}
+	}
+	for _, index := range schema.Indexes {
+		if containsString(index.Columns, colName) {
+			return fmt.Errorf(
+				"!Cannot drop column %v of table %v, it is part of %v.",
+				colName,
+				tableName,
+				index.ToString(),
+			)
+		}
+	}
+
+	for idx, column := range schema.Columns {
+		if idx == colIdx || column.Check == nil {
+			continue
+		}
+		if db.ReferencesColumn(column.Check, colName) {
+			return fmt.Errorf(
+				"!Cannot drop column %v of table %v, it is used by CHECK (%v) "+
+					"on column %v.",
+				colName,
+				tableName,
+				column.Check.ToString(),
+				column.Name,
+			)
+		}
+	}
+	return nil
+}
+
+// Renames the table in the catalog along with its table file, failing if a
+// table or view with the new name already exists.
+func (statement AlterStatement) renameTable(state *db.DBState) error {
+	if state.IsTemporaryTable(statement.TableName) {
+		return statement.renameTemporaryTable(state)
+	}
+
+	tablePath, _ := utils.TableExists(state, statement.TableName)
+	newTablePath := state.CurrentDB + "/" + statement.NewName
 
-	// overwrite header in table file with new header
-	_, err = tableFile.WriteAt([]byte(builder.String()), 0)
+	err := utils.UpdateCatalog(state, func(catalog *db.Catalog) error {
+		if _, exists := catalog.Tables[statement.NewName]; exists {
+			return fmt.Errorf(
+				"!Failed to rename table %v because table %v already exists.",
+				statement.TableName,
+				statement.NewName,
+			)
+		}
+		if _, exists := catalog.Views[statement.NewName]; exists {
+			return fmt.Errorf(
+				"!Failed to rename table %v because view %v already exists.",
+				statement.TableName,
+				statement.NewName,
+			)
+		}
+
+		err := os.Rename(tablePath, newTablePath)
+		if err != nil {
+			return err
+		}
+		catalog.Tables[statement.NewName] = catalog.Tables[statement.TableName]
+		delete(catalog.Tables, statement.TableName)
+		return nil
+	})
 	if err != nil {
 		return err
 	}
+	state.InvalidateKeyIndex(statement.TableName)
 
 	fmt.Printf(
-		"Table %v modified, added column %v.\n",
+		"Table %v renamed to %v.\n",
 		statement.TableName,
-		statement.ColumnName,
+		statement.NewName,
 	)
+	return nil
+}
 
+// Like `renameTable`, but for temporary tables, which only have to avoid the
+// names of other temporary tables.
+func (statement AlterStatement) renameTemporaryTable(state *db.DBState) error {
+	catalog := state.TemporaryCatalog()
+	if _, exists := catalog.Tables[statement.NewName]; exists {
+		return fmt.Errorf(
+			"!Failed to rename table %v because table %v already exists.",
+			statement.TableName,
+			statement.NewName,
+		)
+	}
+
+	tablePath, _ := utils.TableExists(state, statement.TableName)
+	err := os.Rename(tablePath, catalog.Database+"/"+statement.NewName)
+	if err != nil {
+		return err
+	}
+	state.InvalidateKeyIndex(statement.TableName)
+	catalog.Tables[statement.NewName] = catalog.Tables[statement.TableName]
+	delete(catalog.Tables, statement.TableName)
+
+	fmt.Printf(
+		"Table %v renamed to %v.\n",
+		statement.TableName,
+		statement.NewName,
+	)
 	return nil
 }
+
+// Replaces every occurrence of `oldName` in the list with `newName`.
+func renameInList(names []string, oldName string, newName string) {
+	for idx, name := range names {
+		if name == oldName {
+			names[idx] = newName
+		}
+	}
+}
+
+func (statement AlterStatement) missingColumnError() error {
+	return fmt.Errorf(
+		"!Column %v does not exist in table %v.",
+		statement.ColumnName,
+		statement.TableName,
+	)
+}
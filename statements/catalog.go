@@ -0,0 +1,254 @@
+// sdb/statements/catalog.go
+//
+// Contains logic for statements that describe the database itself: `SHOW
+// DATABASES`, `SHOW TABLES` and `DESCRIBE`, along with the
+// `information_schema.tables` and `information_schema.columns` virtual tables,
+// which can be selected from like any other table. Apart from `SHOW DATABASES`,
+// all of them are built from the current database's catalog.
+
+package statements
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sdb/db"
+	"sdb/utils"
+	"sort"
+)
+
+const informationSchema = "information_schema."
+
+// Types of the columns of the catalog's virtual tables.
+var (
+	catalogName = db.VarChar{Size: 64}
+	catalogText = db.VarChar{Size: 255}
+)
+
+type ShowDatabasesStatement struct{}
+
+type ShowTablesStatement struct{}
+
+type DescribeStatement struct {
+	TableName string
+}
+
+// Executes `SHOW DATABASES;` queries. Every directory in the working directory
+// holding a catalog is a database, other directories are left out.
+func (statement ShowDatabasesStatement) Execute(state *db.DBState) error {
+	entries, err := ioutil.ReadDir(".")
+	if err != nil {
+		return fmt.Errorf("!Failed to list databases: %v", err)
+	}
+
+	var rows [][]db.Value
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		if _, err := os.Stat(utils.CatalogPath(entry.Name())); err == nil {
+			rows = append(rows, []db.Value{catalogString(entry.Name())})
+		}
+	}
+
+	printResult([]db.Column{{Name: "database_name", Type: catalogName}}, rows)
+	return nil
+}
+
+// Executes `SHOW TABLES;` queries, listing the tables and views of the current
+// database.
+func (statement ShowTablesStatement) Execute(state *db.DBState) error {
+	if state.CurrentDB == "" {
+		return fmt.Errorf("!No database selected.")
+	}
+
+	relations, err := listRelations(state)
+	if err != nil {
+		return err
+	}
+
+	var rows [][]db.Value
+	for _, relation := range relations {
+		rows = append(rows, []db.Value{
+			catalogString(relation.name),
+			catalogString(relation.tableType),
+		})
+	}
+
+	printResult([]db.Column{
+		{Name: "table_name", Type: catalogName},
+		{Name: "table_type", Type: catalogName},
+	}, rows)
+	return nil
+}
+
+// Executes `DESCRIBE <table_name>;` queries, listing the columns of a table or
+// view.
+func (statement DescribeStatement) Execute(state *db.DBState) error {
+	if state.CurrentDB == "" {
+		return fmt.Errorf("!No database selected.")
+	}
+
+	relations, err := listRelations(state)
+	if err != nil {
+		return err
+	}
+
+	for _, relation := range relations {
+		if relation.name != statement.TableName {
+			continue
+		}
+
+		columns, err := relationColumns(state, relation.name, 0)
+		if err != nil {
+			return err
+		}
+
+		var rows [][]db.Value
+		for _, row := range columnRows(state, relation.name, columns) {
+			// everything after the schema, table name and position
+			rows = append(rows, row[3:])
+		}
+		printResult(informationSchemaColumns[3:], rows)
+		return nil
+	}
+
+	return fmt.Errorf(
+		"!Failed to describe %v because it does not exist.", statement.TableName,
+	)
+}
+
+// A table or view listed in the catalog.
+type catalogEntry struct {
+	name      string
+	tableType string
+}
+
+// Lists the tables, views and materialized views of the current database,
+// ordered by name.
+func listRelations(state *db.DBState) ([]catalogEntry, error) {
+	tableNames, err := utils.ListTables(state)
+	if err != nil {
+		return nil, err
+	}
+	viewNames, err := listViews(state, false)
+	if err != nil {
+		return nil, err
+	}
+
+	var relations []catalogEntry
+	for _, tableName := range tableNames {
+		tableType := "BASE TABLE"
+		if state.IsTemporaryTable(tableName) {
+			tableType = "LOCAL TEMPORARY"
+		} else if isMaterializedView(state, tableName) {
+			tableType = "MATERIALIZED VIEW"
+		}
+		relations = append(relations, catalogEntry{name: tableName, tableType: tableType})
+	}
+	for _, viewName := range viewNames {
+		relations = append(relations, catalogEntry{name: viewName, tableType: "VIEW"})
+	}
+
+	sort.Slice(relations, func(i, j int) bool {
+		return relations[i].name < relations[j].name
+	})
+	return relations, nil
+}
+
+// Computes the rows of one of the `information_schema` virtual tables.
+func queryInformationSchema(
+	state *db.DBState,
+	name string,
+) ([]db.Column, [][]db.Value, error) {
+	if state.CurrentDB == "" {
+		return nil, nil, fmt.Errorf("!No database selected.")
+	}
+
+	columns, err := informationSchemaTable(name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	relations, err := listRelations(state)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var rows [][]db.Value
+	for _, relation := range relations {
+		if name == informationSchema+"tables" {
+			rows = append(rows, []db.Value{
+				catalogString(state.CurrentDB),
+				catalogString(relation.name),
+				catalogString(relation.tableType),
+			})
+			continue
+		}
+
+		tableColumns, err := relationColumns(state, relation.name, 0)
+		if err != nil {
+			return nil, nil, err
+		}
+		rows = append(rows, columnRows(state, relation.name, tableColumns)...)
+	}
+
+	return columns, rows, nil
+}
+
+var informationSchemaTables = []db.Column{
+	{Name: "table_schema", Type: catalogName},
+	{Name: "table_name", Type: catalogName},
+	{Name: "table_type", Type: catalogName},
+}
+
+var informationSchemaColumns = []db.Column{
+	{Name: "table_schema", Type: catalogName},
+	{Name: "table_name", Type: catalogName},
+	{Name: "ordinal_position", Type: db.Int{}},
+	{Name: "column_name", Type: catalogName},
+	{Name: "data_type", Type: catalogName},
+	{Name: "is_nullable", Type: catalogName},
+	{Name: "column_default", Type: catalogText},
+}
+
+// Gets the columns of one of the `information_schema` virtual tables.
+func informationSchemaTable(name string) ([]db.Column, error) {
+	switch name {
+	case informationSchema + "tables":
+		return informationSchemaTables, nil
+	case informationSchema + "columns":
+		return informationSchemaColumns, nil
+	}
+	return nil, fmt.Errorf("!Failed to select from table %v because it does not exist.", name)
+}
+
+// Rows of `information_schema.columns` describing the columns of a table.
+func columnRows(state *db.DBState, tableName string, columns []db.Column) [][]db.Value {
+	var rows [][]db.Value
+	for idx, column := range columns {
+		isNullable := "YES"
+		if column.NotNull {
+			isNullable = "NO"
+		}
+		columnDefault := db.Value{Value: nil, Type: db.Null{}}
+		if column.Default != nil {
+			columnDefault = catalogString(column.Default.ToString())
+		}
+
+		rows = append(rows, []db.Value{
+			catalogString(state.CurrentDB),
+			catalogString(tableName),
+			{Value: int64(idx + 1), Type: db.Int{}},
+			catalogString(column.Name),
+			catalogString(column.Type.ToString()),
+			catalogString(isNullable),
+			columnDefault,
+		})
+	}
+	return rows
+}
+
+func catalogString(value string) db.Value {
+	return db.Value{Value: value, Type: db.VarChar{Size: len(value)}}
+}
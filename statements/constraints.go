@@ -0,0 +1,69 @@
+// sdb/statements/constraints.go
+//
+// Implements enforcement of column constraints (`NOT NULL`, `DEFAULT`, and
+// `CHECK`) for statements that write rows.
+
+package statements
+
+import (
+	"fmt"
+	"sdb/db"
+	"sdb/utils"
+	"strings"
+)
+
+// Checks a row against the constraints of every column in the table. Returns
+// an error naming the first column and constraint that the row violates.
+func checkConstraints(tableName string, columns []db.Column, row []db.Value) error {
+	colMap := columnsToColMap(columns)
+
+	for idx, column := range columns {
+		if column.NotNull && row[idx].GetValue() == nil {
+			return fmt.Errorf(
+				"!Constraint violation: column %v of table %v is NOT NULL.",
+				column.Name,
+				tableName,
+			)
+		}
+
+		if column.Check == nil {
+			continue
+		}
+
+		result, err := column.Check.Evaluate(colMap, row)
+		if err != nil {
+			return err
+		}
+
+		// like in SQL, a CHECK that evaluates to NULL is not a violation
+		if result.GetValue() != nil && !db.IsTrue(result) {
+			return fmt.Errorf(
+				"!Constraint violation: CHECK (%v) on column %v of table %v "+
+					"failed for row {%v}.",
+				column.Check.ToString(),
+				column.Name,
+				tableName,
+				strings.TrimSpace(utils.ValueListToString(row)),
+			)
+		}
+	}
+
+	return nil
+}
+
+// Computes the value a column gets when a row is written without one, which is
+// the column's `DEFAULT` if it has one or NULL otherwise.
+func defaultValue(state *db.DBState, column db.Column) (*db.Value, error) {
+	if column.Default == nil {
+		return &db.Value{Value: nil, Type: db.Null{}}, nil
+	}
+
+	value, err := evaluateConstant(state, column.Default)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"!Failed to compute DEFAULT for column %v: %v", column.Name, err,
+		)
+	}
+
+	return value, nil
+}
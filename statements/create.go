@@ -13,17 +13,32 @@ import (
 	"sdb/utils"
 )
 
+// `IfNotExists` makes creating something that already exists report a notice
+// instead of failing, here and in the other `CREATE` statements.
 type CreateDBStatement struct {
-	DBName string
+	DBName      string
+	IfNotExists bool
 }
 
+// `Temporary` tables are only visible to this session, see
+// `sdb/db/temporary.go`.
 type CreateTableStatement struct {
-	TableName string
-	Columns   []db.Column
+	TableName   string
+	Columns     []db.Column
+	Keys        []db.KeyConstraint
+	ForeignKeys []db.ForeignKey
+	IfNotExists bool
+	Temporary   bool
 }
 
-// Executes `CREATE DATABASE <db_name>;` query.
+// Executes `CREATE DATABASE [IF NOT EXISTS] <db_name>;` query.
 func (statement CreateDBStatement) Execute(state *db.DBState) error {
+	if info, err := os.Stat(statement.DBName); err == nil && info.IsDir() &&
+		statement.IfNotExists {
+		printSkipped("Database", statement.DBName, true)
+		return nil
+	}
+
 	err := os.Mkdir(statement.DBName, os.ModeDir|os.ModePerm)
 
 	if err != nil {
@@ -33,27 +48,187 @@ func (statement CreateDBStatement) Execute(state *db.DBState) error {
 		)
 	}
 
+	err = utils.CreateCatalog(statement.DBName)
+	if err != nil {
+		os.RemoveAll(statement.DBName)
+		return err
+	}
+
 	fmt.Printf("Database %v created.\n", statement.DBName)
 	return nil
 }
 
-// Executes `CREATE TABLE <table_name> (<table_columns>);` queries.
+// Executes `CREATE [TEMPORARY] TABLE [IF NOT EXISTS] <table_name>
+// (<table_columns>);` queries. A temporary table may have the same name as a
+// permanent table, which it then hides.
 func (statement CreateTableStatement) Execute(state *db.DBState) error {
-	tablePath, exists := utils.TableExists(state, statement.TableName)
+	_, exists := utils.TableExists(state, statement.TableName)
+	if statement.Temporary {
+		exists = state.IsTemporaryTable(statement.TableName)
+	}
 
+	if exists && statement.IfNotExists {
+		printSkipped("Table", statement.TableName, true)
+		return nil
+	}
 	if exists {
 		return fmt.Errorf("!Failed to create table %v because it already exists.", statement.TableName)
 	}
+	if viewExists(state, statement.TableName) {
+		return fmt.Errorf(
+			"!Failed to create table %v because view %v already exists.",
+			statement.TableName,
+			statement.TableName,
+		)
+	}
 
-	tableFile, err := os.Create(tablePath)
+	schema := &db.TableSchema{
+		Columns:     statement.Columns,
+		Keys:        statement.Keys,
+		ForeignKeys: statement.ForeignKeys,
+	}
+
+	err := statement.validateKeys()
 	if err != nil {
-		return fmt.Errorf("!Failed to create table %v because it already exists.", statement.TableName)
+		return err
+	}
+	err = validateForeignKeys(state, statement.TableName, schema)
+	if err != nil {
+		return err
+	}
+	err = checkTemporaryReferences(state, statement.TableName, statement.Temporary, schema)
+	if err != nil {
+		return err
+	}
+
+	schema.Columns = append([]db.Column{}, statement.Columns...)
+	for _, column := range schema.Columns {
+		if column.Identity == "" {
+			continue
+		}
+		if column.Default != nil {
+			return fmt.Errorf(
+				"!Identity column %v of table %v can't also have a DEFAULT.",
+				column.Name,
+				statement.TableName,
+			)
+		}
+		err = validateIdentityColumn(statement.TableName, column)
+		if err != nil {
+			return err
+		}
+		// the sequence would outlive the table in the shared catalog
+		if statement.Temporary {
+			return fmt.Errorf(
+				"!Temporary table %v can't have identity column %v.",
+				statement.TableName,
+				column.Name,
+			)
+		}
 	}
 
-	tableTypesString := utils.ColumnsToString(statement.Columns)
-	tableFile.WriteString(tableTypesString)
-	tableFile.WriteString("\n")
+	if statement.Temporary {
+		catalog, err := utils.LoadCatalog(state)
+		if err == nil {
+			err = catalog.ResolveColumnTypes(schema.Columns)
+		}
+		if err == nil {
+			catalog, err = state.CreateTemporaryCatalog()
+		}
+		if err == nil {
+			err = utils.AddTable(state, catalog, statement.TableName, schema)
+		}
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Temporary table %v created.\n", statement.TableName)
+		return nil
+	}
+
+	err = utils.UpdateCatalog(state, func(catalog *db.Catalog) error {
+		if _, exists := catalog.Tables[statement.TableName]; exists {
+			return fmt.Errorf("!Failed to create table %v because it already exists.", statement.TableName)
+		}
+		err := catalog.ResolveColumnTypes(schema.Columns)
+		if err != nil {
+			return err
+		}
+
+		// each identity column gets its own sequence, and nothing is left
+		// behind if any of them, or the table itself, can't be created
+		var sequences []string
+		for idx, column := range schema.Columns {
+			if column.Identity == "" {
+				continue
+			}
+			err := createIdentitySequence(
+				state, catalog, statement.TableName, &schema.Columns[idx], 1,
+			)
+			if err == nil {
+				sequences = append(sequences, schema.Columns[idx].IdentitySequence())
+				continue
+			}
+			for _, sequence := range sequences {
+				state.DropSequence(sequence)
+			}
+			return err
+		}
+
+		err = utils.AddTable(state, catalog, statement.TableName, schema)
+		if err != nil {
+			for _, sequence := range sequences {
+				state.DropSequence(sequence)
+			}
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
 
 	fmt.Printf("Table %v created.\n", statement.TableName)
 	return nil
 }
+
+// Checks that every key refers to columns of the table, and that there is at
+// most one primary key.
+func (statement CreateTableStatement) validateKeys() error {
+	colMap := columnsToColMap(statement.Columns)
+	hasPrimaryKey := false
+
+	for _, key := range statement.Keys {
+		if key.Primary {
+			if hasPrimaryKey {
+				return fmt.Errorf(
+					"!Failed to create table %v because it has multiple primary keys.",
+					statement.TableName,
+				)
+			}
+			hasPrimaryKey = true
+		}
+
+		for _, colName := range key.Columns {
+			if _, ok := colMap[colName]; !ok {
+				return fmt.Errorf(
+					"!Failed to create table %v because key column %v does not exist.",
+					statement.TableName,
+					colName,
+				)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Prints the notice given instead of an error when an `IF [NOT] EXISTS` clause
+// skips a statement. `exists` tells whether it was skipped because `name`
+// already exists, or because it doesn't.
+func printSkipped(kind string, name string, exists bool) {
+	if exists {
+		fmt.Printf("%v %v already exists, skipping.\n", kind, name)
+	} else {
+		fmt.Printf("%v %v does not exist, skipping.\n", kind, name)
+	}
+}
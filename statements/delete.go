@@ -18,28 +18,72 @@ import (
 type DeleteStatment struct {
 	TableName   string
 	WhereClause *WhereClause
+	Returning   *ReturningClause
 }
 
 func (statement DeleteStatment) Execute(state *db.DBState) error {
+	deferred, err := deferToTransaction(
+		state, statement.TableName, statement, "delete",
+	)
+	if deferred || err != nil {
+		return err
+	}
+
 	tableFile, err := utils.OpenTable(state, statement.TableName, os.O_RDONLY)
 	if err != nil {
-		fmt.Println(err)
-		return fmt.Errorf("!Failed to insert into table %v because it does not exist.", statement.TableName)
+		return fmt.Errorf("!Failed to delete from table %v because it does not exist.", statement.TableName)
 	}
 	defer tableFile.Close()
 
+	schema, err := utils.ReadTableSchema(state, statement.TableName)
+	if err != nil {
+		return err
+	}
+	tableColumns := schema.Columns
+	colNames := columnsToColMap(tableColumns)
+	if err = checkWhereColumns(statement.WhereClause, tableColumns); err != nil {
+		return err
+	}
+	statement.WhereClause, err = foldWhereCasts(statement.WhereClause)
+	if err != nil {
+		return err
+	}
+
 	reader := bufio.NewReader(tableFile)
-	tableHeader, err := reader.ReadString('\n')
+
+	references, err := referencingForeignKeys(state, statement.TableName)
 	if err != nil {
-		return fmt.Errorf("!Failed to read from table file %v.", statement.TableName)
+		return err
 	}
 
-	colNames := utils.TableHeaderToColMap(tableHeader)
+	// deleting every row without returning them doesn't need to parse any of
+	// the rows, the table is just emptied
+	if statement.WhereClause == nil && statement.Returning == nil &&
+		len(references) == 0 {
+		deleted := 0
+		for {
+			_, err := reader.ReadString('\n')
+			if err != nil {
+				break
+			}
+			deleted += 1
+		}
+
+		err = utils.ReplaceTable(state, statement.TableName, schema, "")
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Deleted %v rows.\n", deleted)
+		return nil
+	}
 
 	var replaceStringBuilder strings.Builder
-	replaceStringBuilder.WriteString(tableHeader)
 
 	deleted := 0
+	var deletedRows [][]db.Value
+	var remainingRows [][]db.Value
+	var changes []rowChange
 
 	for {
 		row, err := reader.ReadString('\n')
@@ -47,25 +91,44 @@ func (statement DeleteStatment) Execute(state *db.DBState) error {
 			break
 		}
 
-		rowValues, _, _ := utils.ParseValueList(row)
-		if !whereApplies(statement.WhereClause, colNames, rowValues) {
+		rowValues, _ := utils.ParseRow(row, tableColumns)
+		applies, err := whereApplies(statement.WhereClause, colNames, rowValues)
+		if err != nil {
+			return err
+		}
+		if !applies {
 			replaceStringBuilder.WriteString(row)
+			remainingRows = append(remainingRows, rowValues)
 		} else {
 			deleted += 1
+			deletedRows = append(deletedRows, rowValues)
+			changes = append(changes, rowChange{Old: rowValues})
 		}
 	}
 
-	// need to close file before reopening to truncate
-	tableFile.Close()
-	tableFile, err = utils.OpenTable(state, statement.TableName, os.O_WRONLY|os.O_TRUNC)
-	if err != nil {
-		return err
+	if deleted > 0 && len(references) > 0 {
+		// apply ON DELETE actions of foreign keys referencing this table, then
+		// write this table along with any tables the delete cascaded to
+		cascade := newCascade(state)
+		cascade.set(statement.TableName, schema, remainingRows)
+		err = cascade.propagate(statement.TableName, changes, 0)
+		if err != nil {
+			return err
+		}
+		err = cascade.write()
+		if err != nil {
+			return err
+		}
+	} else if deleted > 0 {
+		// if nothing matched, there's no need to rewrite the table
+		err = utils.ReplaceTable(
+			state, statement.TableName, schema, replaceStringBuilder.String(),
+		)
+		if err != nil {
+			return err
+		}
 	}
-	defer tableFile.Close()
-
-	replacedTable := replaceStringBuilder.String()
-	tableFile.WriteString(replacedTable)
 
 	fmt.Printf("Deleted %v rows.\n", deleted)
-	return nil
+	return printReturning(statement.Returning, tableColumns, deletedRows)
 }
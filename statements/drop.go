@@ -13,25 +13,98 @@ import (
 	"sdb/utils"
 )
 
+// `IfExists` makes dropping something that doesn't exist report a notice
+// instead of failing, here and in the other `DROP` statements.
 type DropDBStatement struct {
-	DBName string
+	DBName   string
+	IfExists bool
 }
 
 type DropTableStatement struct {
 	TableName string
+	IfExists  bool
 }
 
-// Executes `DROP TABLE <table_name>;` query. Assumes that the table being
-// deleted is in the current database stored in DBState.
+// Executes `DROP TABLE [IF EXISTS] <table_name>;` query. Assumes that the table
+// being deleted is in the current database stored in DBState.
 func (statement DropTableStatement) Execute(state *db.DBState) error {
-	tablePath, exists := utils.TableExists(state, statement.TableName)
+	_, exists := utils.TableExists(state, statement.TableName)
 
+	if !exists && statement.IfExists {
+		printSkipped("Table", statement.TableName, false)
+		return nil
+	}
 	if !exists {
 		return fmt.Errorf("!Failed to delete %v because it does not exist.", statement.TableName)
 	}
 
-	err := os.Remove(tablePath)
+	temporary := state.IsTemporaryTable(statement.TableName)
+	if isMaterializedView(state, statement.TableName) && !temporary {
+		return fmt.Errorf(
+			"!Failed to delete %v because it is a materialized view. Use DROP "+
+				"MATERIALIZED VIEW instead.",
+			statement.TableName,
+		)
+	}
+
+	references, err := referencingForeignKeys(state, statement.TableName)
+	if err != nil {
+		return err
+	}
+	for _, reference := range references {
+		if reference.childTable != statement.TableName {
+			return fmt.Errorf(
+				"!Failed to delete %v because it is referenced by a foreign "+
+					"key of table %v.",
+				statement.TableName,
+				reference.childTable,
+			)
+		}
+	}
 
+	dependent, err := findDependentView(state, statement.TableName, "")
+	if err != nil {
+		return err
+	}
+	if dependent != "" {
+		return fmt.Errorf(
+			"!Failed to delete %v because view %v depends on it.",
+			statement.TableName,
+			dependent,
+		)
+	}
+
+	if state.TableLockExists(statement.TableName) {
+		return fmt.Errorf("!Table %v is locked.", statement.TableName)
+	}
+
+	if temporary {
+		err = utils.RemoveTable(state, state.TemporaryCatalog(), statement.TableName)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Deleted temporary table %v.\n", statement.TableName)
+		return nil
+	}
+
+	err = utils.UpdateCatalog(state, func(catalog *db.Catalog) error {
+		schema, ok := catalog.Tables[statement.TableName]
+		if !ok {
+			return fmt.Errorf("!Failed to delete %v because it does not exist.", statement.TableName)
+		}
+
+		err := utils.RemoveTable(state, catalog, statement.TableName)
+		if err != nil {
+			return err
+		}
+		for _, column := range schema.Columns {
+			if sequence := column.IdentitySequence(); sequence != "" {
+				removeSequence(state, catalog, sequence)
+			}
+		}
+		return nil
+	})
 	if err != nil {
 		return err
 	}
@@ -40,15 +113,22 @@ func (statement DropTableStatement) Execute(state *db.DBState) error {
 	return nil
 }
 
-// Executes `DROP DATABASE <db_name>;` query.
+// Executes `DROP DATABASE [IF EXISTS] <db_name>;` query.
 func (statement DropDBStatement) Execute(state *db.DBState) error {
 	_, err := os.Stat(statement.DBName)
 
+	if err != nil && statement.IfExists {
+		printSkipped("Database", statement.DBName, false)
+		return nil
+	}
 	if err != nil {
 		return fmt.Errorf("!Failed to delete %v because it does not exist.", statement.DBName)
 	}
 
 	os.RemoveAll(statement.DBName)
+	state.KeyIndexes = nil
+	state.Catalog = nil
+	state.DropTemporaryTables(statement.DBName)
 
 	fmt.Printf("Database %v deleted.\n", statement.DBName)
 	return nil
@@ -0,0 +1,451 @@
+// sdb/statements/foreignkeys.go
+//
+// Implements enforcement of `FOREIGN KEY` constraints. Rows written to a child
+// table are checked against the key index of the parent table, and deleting or
+// updating parent rows applies each referencing foreign key's `ON DELETE` or
+// `ON UPDATE` action to the child rows, cascading through further tables as
+// needed. Every affected table is computed in memory before any are written.
+
+package statements
+
+import (
+	"fmt"
+	"sdb/db"
+	"sdb/utils"
+	"strings"
+)
+
+// Cascades can loop through self-referencing or cyclic foreign keys, so they
+// are cut off at this depth.
+const maxCascadeDepth = 32
+
+// A foreign key of `childTable` that references some parent table.
+type reference struct {
+	childTable string
+	foreignKey db.ForeignKey
+}
+
+// Finds every foreign key in the current database that references `tableName`.
+func referencingForeignKeys(state *db.DBState, tableName string) ([]reference, error) {
+	tableNames, err := utils.ListTables(state)
+	if err != nil {
+		return nil, err
+	}
+
+	// tables only ever reference tables of their own kind, so a permanent
+	// table's foreign key names a permanent table even when a temporary table
+	// of the same name hides it
+	temporary := state.IsTemporaryTable(tableName)
+	var references []reference
+	for _, childTable := range tableNames {
+		if state.IsTemporaryTable(childTable) != temporary {
+			continue
+		}
+		schema, err := utils.ReadTableSchema(state, childTable)
+		if err != nil {
+			return nil, err
+		}
+		for _, foreignKey := range schema.ForeignKeys {
+			if foreignKey.RefTable == tableName {
+				references = append(references, reference{
+					childTable: childTable,
+					foreignKey: foreignKey,
+				})
+			}
+		}
+	}
+
+	return references, nil
+}
+
+// Finds every table that a change to `tableName` could cascade to, following
+// foreign keys transitively. Does not include `tableName` itself.
+func referencingTables(state *db.DBState, tableName string) ([]string, error) {
+	seen := map[string]bool{tableName: true}
+	queue := []string{tableName}
+	var tableNames []string
+
+	for len(queue) > 0 {
+		references, err := referencingForeignKeys(state, queue[0])
+		if err != nil {
+			return nil, err
+		}
+		queue = queue[1:]
+
+		for _, reference := range references {
+			if seen[reference.childTable] {
+				continue
+			}
+			seen[reference.childTable] = true
+			queue = append(queue, reference.childTable)
+			tableNames = append(tableNames, reference.childTable)
+		}
+	}
+
+	return tableNames, nil
+}
+
+// Finds the index of the key of `schema` over exactly `colNames`, or -1 if
+// there isn't one.
+func findKey(schema *db.TableSchema, colNames []string) int {
+	for keyIdx, key := range schema.Keys {
+		if strings.Join(key.Columns, ",") == strings.Join(colNames, ",") {
+			return keyIdx
+		}
+	}
+	return -1
+}
+
+// Checks that each foreign key of a table being created or altered refers to
+// columns of the table, and to the primary key or a unique key of the parent.
+func validateForeignKeys(state *db.DBState, tableName string, schema *db.TableSchema) error {
+	colMap := columnsToColMap(schema.Columns)
+
+	for _, foreignKey := range schema.ForeignKeys {
+		for _, colName := range foreignKey.Columns {
+			if _, ok := colMap[colName]; !ok {
+				return fmt.Errorf(
+					"!Foreign key column %v does not exist in table %v.",
+					colName,
+					tableName,
+				)
+			}
+		}
+
+		parentSchema := schema
+		if foreignKey.RefTable != tableName {
+			var err error
+			parentSchema, err = utils.ReadTableSchema(state, foreignKey.RefTable)
+			if err != nil {
+				return fmt.Errorf(
+					"!Referenced table %v does not exist.", foreignKey.RefTable,
+				)
+			}
+		}
+
+		if findKey(parentSchema, foreignKey.RefColumns) < 0 {
+			return fmt.Errorf(
+				"!Referenced columns (%v) are not the primary key or a unique "+
+					"key of table %v.",
+				strings.Join(foreignKey.RefColumns, ", "),
+				foreignKey.RefTable,
+			)
+		}
+	}
+
+	return nil
+}
+
+// Checks that temporary tables only reference other temporary tables, and
+// permanent tables only other permanent tables, since other sessions can't see
+// this session's temporary tables to enforce the foreign key.
+func checkTemporaryReferences(
+	state *db.DBState,
+	tableName string,
+	temporary bool,
+	schema *db.TableSchema,
+) error {
+	for _, foreignKey := range schema.ForeignKeys {
+		if foreignKey.RefTable == tableName {
+			continue
+		}
+		if state.IsTemporaryTable(foreignKey.RefTable) != temporary {
+			if temporary {
+				return fmt.Errorf(
+					"!Temporary table %v can't reference permanent table %v.",
+					tableName,
+					foreignKey.RefTable,
+				)
+			}
+			return fmt.Errorf(
+				"!Table %v can't reference temporary table %v.",
+				tableName,
+				foreignKey.RefTable,
+			)
+		}
+	}
+	return nil
+}
+
+// Checks that every non-NULL foreign key value of `rows` matches a row of the
+// referenced table. For foreign keys that reference the table itself,
+// `tableRows` gives the full contents of the table after the change, or nil to
+// use the table's current contents.
+func checkForeignKeys(
+	state *db.DBState,
+	tableName string,
+	schema *db.TableSchema,
+	rows [][]db.Value,
+	tableRows [][]db.Value,
+) error {
+	colMap := columnsToColMap(schema.Columns)
+
+	for _, foreignKey := range schema.ForeignKeys {
+		parentSchema := schema
+		if foreignKey.RefTable != tableName {
+			var err error
+			parentSchema, err = utils.ReadTableSchema(state, foreignKey.RefTable)
+			if err != nil {
+				return fmt.Errorf(
+					"!Referenced table %v does not exist.", foreignKey.RefTable,
+				)
+			}
+		}
+
+		keyIdx := findKey(parentSchema, foreignKey.RefColumns)
+		if keyIdx < 0 {
+			return fmt.Errorf(
+				"!Referenced columns (%v) are not a key of table %v.",
+				strings.Join(foreignKey.RefColumns, ", "),
+				foreignKey.RefTable,
+			)
+		}
+
+		var parentKeys map[string]bool
+		if foreignKey.RefTable == tableName && tableRows != nil {
+			parentKeys = keySet(parentSchema.Keys[keyIdx], colMap, tableRows)
+		} else {
+			index, err := loadKeyIndex(state, foreignKey.RefTable, parentSchema)
+			if err != nil {
+				return err
+			}
+			parentKeys = index.Keys[keyIdx]
+		}
+
+		childKey := db.KeyConstraint{Columns: foreignKey.Columns}
+		for _, row := range rows {
+			keyValue, ok := keyString(childKey, colMap, row)
+			if ok && !parentKeys[keyValue] {
+				return fmt.Errorf(
+					"!Constraint violation: key (%v)=(%v) of table %v is not "+
+						"present in table %v.",
+					strings.Join(foreignKey.Columns, ", "),
+					keyValue,
+					tableName,
+					foreignKey.RefTable,
+				)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Collects the values of `key` across every row.
+func keySet(key db.KeyConstraint, colMap map[string]int, rows [][]db.Value) map[string]bool {
+	keyValues := make(map[string]bool)
+	for _, row := range rows {
+		if keyValue, ok := keyString(key, colMap, row); ok {
+			keyValues[keyValue] = true
+		}
+	}
+	return keyValues
+}
+
+// Change to a single row. `New` is nil if the row was deleted.
+type rowChange struct {
+	Old []db.Value
+	New []db.Value
+}
+
+// Tracks the new contents of every table modified by a statement and the
+// cascades it causes, so that they can be checked before any are written.
+type cascade struct {
+	state  *db.DBState
+	tables map[string]*cascadeTable
+	order  []string
+}
+
+type cascadeTable struct {
+	schema *db.TableSchema
+	rows   [][]db.Value
+}
+
+func newCascade(state *db.DBState) *cascade {
+	return &cascade{
+		state:  state,
+		tables: make(map[string]*cascadeTable),
+	}
+}
+
+// Records the new contents of a table.
+func (c *cascade) set(tableName string, schema *db.TableSchema, rows [][]db.Value) {
+	if _, ok := c.tables[tableName]; !ok {
+		c.order = append(c.order, tableName)
+	}
+	c.tables[tableName] = &cascadeTable{schema: schema, rows: rows}
+}
+
+// Gets the new contents of a table, reading it from disk if it hasn't been
+// modified yet.
+func (c *cascade) table(tableName string) (*cascadeTable, error) {
+	if table, ok := c.tables[tableName]; ok {
+		return table, nil
+	}
+
+	schema, rows, err := utils.ReadTable(c.state, tableName)
+	if err != nil {
+		return nil, err
+	}
+	c.set(tableName, schema, rows)
+
+	return c.tables[tableName], nil
+}
+
+// Applies the referential actions of every foreign key referencing
+// `parentTable` to the rows affected by `changes`. The new contents of the
+// parent table must already be recorded with `set`.
+func (c *cascade) propagate(parentTable string, changes []rowChange, depth int) error {
+	if len(changes) == 0 {
+		return nil
+	}
+	if depth > maxCascadeDepth {
+		return fmt.Errorf("!Foreign key cascade from table %v is too deep.", parentTable)
+	}
+
+	references, err := referencingForeignKeys(c.state, parentTable)
+	if err != nil {
+		return err
+	}
+
+	parent, err := c.table(parentTable)
+	if err != nil {
+		return err
+	}
+	parentColMap := columnsToColMap(parent.schema.Columns)
+
+	for _, reference := range references {
+		foreignKey := reference.foreignKey
+		parentKey := db.KeyConstraint{Columns: foreignKey.RefColumns}
+
+		// old parent key -> change, for parent rows whose key went away
+		affected := make(map[string]rowChange)
+		for _, change := range changes {
+			oldKey, ok := keyString(parentKey, parentColMap, change.Old)
+			if !ok {
+				continue
+			}
+			if change.New != nil {
+				newKey, ok := keyString(parentKey, parentColMap, change.New)
+				if ok && newKey == oldKey {
+					continue
+				}
+			}
+			affected[oldKey] = change
+		}
+		if len(affected) == 0 {
+			continue
+		}
+
+		child, err := c.table(reference.childTable)
+		if err != nil {
+			return err
+		}
+		childColMap := columnsToColMap(child.schema.Columns)
+		childKey := db.KeyConstraint{Columns: foreignKey.Columns}
+
+		var childChanges []rowChange
+		var newRows [][]db.Value
+		for _, row := range child.rows {
+			keyValue, ok := keyString(childKey, childColMap, row)
+			change, hit := affected[keyValue]
+			if !ok || !hit {
+				newRows = append(newRows, row)
+				continue
+			}
+
+			action := foreignKey.OnUpdate
+			if change.New == nil {
+				action = foreignKey.OnDelete
+			}
+
+			newRow := append([]db.Value{}, row...)
+			switch action {
+			case db.Cascade:
+				if change.New == nil {
+					childChanges = append(childChanges, rowChange{Old: row})
+					continue
+				}
+				for idx, colName := range foreignKey.Columns {
+					newRow[childColMap[colName]] =
+						change.New[parentColMap[foreignKey.RefColumns[idx]]]
+				}
+			case db.SetNull:
+				for _, colName := range foreignKey.Columns {
+					newRow[childColMap[colName]] = db.Value{Value: nil, Type: db.Null{}}
+				}
+			case db.SetDefault:
+				for _, colName := range foreignKey.Columns {
+					colIdx := childColMap[colName]
+					value, err := defaultValue(c.state, child.schema.Columns[colIdx])
+					if err != nil {
+						return err
+					}
+					newRow[colIdx] = *value
+				}
+			default:
+				return fmt.Errorf(
+					"!Constraint violation: key (%v)=(%v) of table %v is still "+
+						"referenced from table %v.",
+					strings.Join(foreignKey.RefColumns, ", "),
+					keyValue,
+					parentTable,
+					reference.childTable,
+				)
+			}
+
+			err = checkConstraints(reference.childTable, child.schema.Columns, newRow)
+			if err != nil {
+				return err
+			}
+			childChanges = append(childChanges, rowChange{Old: row, New: newRow})
+			newRows = append(newRows, newRow)
+		}
+
+		child.rows = newRows
+		err = checkKeys(reference.childTable, child.schema, child.rows)
+		if err != nil {
+			return err
+		}
+
+		// rows set to their defaults must still reference an existing row
+		if foreignKey.OnDelete == db.SetDefault || foreignKey.OnUpdate == db.SetDefault {
+			parentKeys := keySet(parentKey, parentColMap, parent.rows)
+			for _, change := range childChanges {
+				if change.New == nil {
+					continue
+				}
+				keyValue, ok := keyString(childKey, childColMap, change.New)
+				if ok && !parentKeys[keyValue] {
+					return fmt.Errorf(
+						"!Constraint violation: default key (%v)=(%v) of table "+
+							"%v is not present in table %v.",
+						strings.Join(foreignKey.Columns, ", "),
+						keyValue,
+						reference.childTable,
+						parentTable,
+					)
+				}
+			}
+		}
+
+		err = c.propagate(reference.childTable, childChanges, depth+1)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Writes the new contents of every modified table.
+func (c *cascade) write() error {
+	for _, tableName := range c.order {
+		table := c.tables[tableName]
+		err := utils.WriteTable(c.state, tableName, table.schema, table.rows)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
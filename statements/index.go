@@ -0,0 +1,387 @@
+// sdb/statements/index.go
+//
+// Contains logic for `CREATE INDEX` and `DROP INDEX` statements, and for
+// using indexes to find the rows matching WHERE clauses and joins without
+// scanning the whole table.
+
+package statements
+
+import (
+	"fmt"
+	"os"
+	"sdb/db"
+	"sdb/utils"
+)
+
+type CreateIndexStatement struct {
+	IndexName   string
+	Unique      bool
+	TableName   string
+	Columns     []string
+	IfNotExists bool
+}
+
+type DropIndexStatement struct {
+	IndexName string
+	IfExists  bool
+}
+
+// Executes `CREATE [UNIQUE] INDEX [IF NOT EXISTS] <index_name> ON <table_name>
+// (<columns>);` queries. The index is added to the table's schema and built by rewriting
+// the table, which fails without changing anything if a unique index would
+// have duplicates.
+func (statement CreateIndexStatement) Execute(state *db.DBState) error {
+	if _, exists := utils.TableExists(state, statement.TableName); !exists {
+		return fmt.Errorf(
+			"!Failed to create index %v because table %v does not exist.",
+			statement.IndexName,
+			statement.TableName,
+		)
+	}
+
+	if state.TableLockExists(statement.TableName) {
+		return fmt.Errorf("!Table %v is locked.", statement.TableName)
+	}
+	unlock, err := state.LockTableWrites(statement.TableName)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	ownerTable, _, err := findIndex(state, statement.IndexName)
+	if err != nil {
+		return err
+	}
+	// permanent tables hidden by temporary tables keep their index names
+	if catalog := state.TemporaryCatalog(); ownerTable == "" && catalog != nil {
+		for tableName := range catalog.Tables {
+			schema, err := permanentTableSchema(state, tableName)
+			if err != nil {
+				return err
+			}
+			for _, index := range schema.Indexes {
+				if index.Name == statement.IndexName {
+					ownerTable = tableName
+				}
+			}
+		}
+	}
+	if ownerTable != "" && statement.IfNotExists {
+		printSkipped("Index", statement.IndexName, true)
+		return nil
+	}
+	if ownerTable != "" {
+		return fmt.Errorf(
+			"!Failed to create index %v because it already exists.",
+			statement.IndexName,
+		)
+	}
+
+	schema, rows, err := utils.ReadTable(state, statement.TableName)
+	if err != nil {
+		return err
+	}
+
+	colMap := columnsToColMap(schema.Columns)
+	for idx, colName := range statement.Columns {
+		if _, ok := colMap[colName]; !ok {
+			return fmt.Errorf(
+				"!Column %v does not exist in table %v.",
+				colName,
+				statement.TableName,
+			)
+		}
+		if containsString(statement.Columns[:idx], colName) {
+			return fmt.Errorf(
+				"!Column %v appears more than once in index %v.",
+				colName,
+				statement.IndexName,
+			)
+		}
+	}
+
+	schema.Indexes = append(schema.Indexes, db.IndexDefinition{
+		Name:    statement.IndexName,
+		Unique:  statement.Unique,
+		Columns: statement.Columns,
+	})
+	err = utils.WriteTable(state, statement.TableName, schema, rows)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf(
+		"Created index %v on table %v.\n",
+		statement.IndexName,
+		statement.TableName,
+	)
+	return nil
+}
+
+// Executes `DROP INDEX [IF EXISTS] <index_name>;` queries.
+func (statement DropIndexStatement) Execute(state *db.DBState) error {
+	tableName, indexIdx, err := findIndex(state, statement.IndexName)
+	if err != nil {
+		return err
+	}
+	if tableName == "" && statement.IfExists {
+		printSkipped("Index", statement.IndexName, false)
+		return nil
+	}
+	if tableName == "" {
+		return fmt.Errorf(
+			"!Failed to delete index %v because it does not exist.",
+			statement.IndexName,
+		)
+	}
+
+	if state.TableLockExists(tableName) {
+		return fmt.Errorf("!Table %v is locked.", tableName)
+	}
+	unlock, err := state.LockTableWrites(tableName)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	schema, rows, err := utils.ReadTable(state, tableName)
+	if err != nil {
+		return err
+	}
+
+	schema.Indexes = append(schema.Indexes[:indexIdx], schema.Indexes[indexIdx+1:]...)
+	err = utils.WriteTable(state, tableName, schema, rows)
+	if err != nil {
+		return err
+	}
+	os.Remove(utils.IndexPath(state, tableName, statement.IndexName))
+
+	fmt.Printf("Deleted index %v.\n", statement.IndexName)
+	return nil
+}
+
+// Finds the table an index belongs to, and the index's position in the table's
+// schema. Returns an empty table name if no table has the index.
+func findIndex(state *db.DBState, indexName string) (string, int, error) {
+	tableNames, err := utils.ListTables(state)
+	if err != nil {
+		return "", 0, err
+	}
+
+	for _, tableName := range tableNames {
+		schema, err := utils.ReadTableSchema(state, tableName)
+		if err != nil {
+			return "", 0, err
+		}
+		for idx, index := range schema.Indexes {
+			if index.Name == indexName {
+				return tableName, idx, nil
+			}
+		}
+	}
+
+	return "", 0, nil
+}
+
+// Gets the schema of a permanent table even if a temporary table hides it, or
+// an empty schema if there is no such permanent table.
+func permanentTableSchema(state *db.DBState, tableName string) (*db.TableSchema, error) {
+	catalog, err := utils.LoadCatalog(state)
+	if err != nil {
+		return nil, err
+	}
+	if schema, ok := catalog.Tables[tableName]; ok {
+		return schema, nil
+	}
+	return &db.TableSchema{}, nil
+}
+
+// Finds an index that can be searched by the value of `colName`, meaning
+// `colName` is its first column.
+func indexOnColumn(schema *db.TableSchema, colName string) *db.IndexDefinition {
+	for idx, index := range schema.Indexes {
+		if index.Columns[0] == colName {
+			return &schema.Indexes[idx]
+		}
+	}
+	return nil
+}
+
+// Uses an index to find the offsets of every row of a table that could match
+// a WHERE clause. Returns false if no index can answer the clause, in which
+// case the whole table has to be scanned. Rows found this way still need to be
+// checked against the clause.
+func whereIndexOffsets(
+	state *db.DBState,
+	tableName string,
+	schema *db.TableSchema,
+	where *WhereClause,
+) ([]int64, bool, error) {
+	if where == nil || where.Condition != nil {
+		return nil, false, nil
+	}
+
+	index := indexOnColumn(schema, where.ColName)
+	if index == nil {
+		return nil, false, nil
+	}
+
+	comparison, value := indexLookupValue(
+		schema, where.ColName, where.Comparison, where.ComparisonValue,
+	)
+	// a value that can't be compared with the column is left for the scan to
+	// report, see `whereApplies`
+	colType := schema.Columns[columnsToColMap(schema.Columns)[where.ColName]].Type
+	if !db.IndexesAs(colType, value) {
+		return nil, false, nil
+	}
+	lo, hi, ok := db.IndexKeyRange(comparison, value)
+	if !ok {
+		return nil, false, nil
+	}
+
+	tree, err := utils.OpenIndex(state, tableName, *index)
+	if err != nil {
+		return nil, false, err
+	}
+	defer tree.Close()
+
+	offsets, err := utils.IndexRowOffsets(tree, lo, hi)
+	if err != nil {
+		return nil, false, err
+	}
+	return offsets, true, nil
+}
+
+// Converts a value compared against an indexed column the way
+// `db.CompareValues` does, so the index finds the rows the comparison is true
+// for. Floats compare with decimals as the shortest decimal that reads back as
+// the same float, so a decimal is looked up in a float column as its nearest
+// float, with `<` and `>` widened to include that float. Strings compare with
+// dates, times, timestamps, intervals, JSON documents, enums and UUIDs as
+// literals of their type.
+func indexLookupValue(
+	schema *db.TableSchema,
+	colName string,
+	comparison string,
+	value *db.Value,
+) (string, *db.Value) {
+	colType := schema.Columns[columnsToColMap(schema.Columns)[colName]].Type
+	switch raw := value.Value.(type) {
+	case string:
+		if parsed, ok, err := db.ParseAs(raw, colType); ok && err == nil {
+			return comparison, &parsed
+		}
+	case float64:
+		if _, isDecimal := colType.(db.Decimal); isDecimal {
+			return comparison, &db.Value{Value: db.DecimalFromFloat(raw), Type: db.Decimal{}}
+		}
+	case db.DecimalValue:
+		if _, isFloat := colType.(db.Float); isFloat {
+			float, ok := raw.Float64()
+			if !ok {
+				return comparison, value
+			}
+			if comparison == "<" || comparison == ">" {
+				comparison += "="
+			}
+			return comparison, &db.Value{Value: float, Type: db.Float{}}
+		}
+	}
+	return comparison, value
+}
+
+// Uses the index on a joined table's column to read the rows of the joined
+// table that could match `value`.
+func indexedJoinRows(
+	tree *db.BTree,
+	joinTableFile *os.File,
+	schema *db.TableSchema,
+	colName string,
+	value *db.Value,
+) ([][]db.Value, error) {
+	comparison, value := indexLookupValue(schema, colName, "=", value)
+	lo, hi, ok := db.IndexKeyRange(comparison, value)
+	if !ok {
+		return nil, nil
+	}
+
+	offsets, err := utils.IndexRowOffsets(tree, lo, hi)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows [][]db.Value
+	for _, offset := range offsets {
+		row, err := utils.ReadRowAt(joinTableFile, offset)
+		if err != nil {
+			return nil, err
+		}
+		rowValues, _ := utils.ParseRow(row, schema.Columns)
+		rows = append(rows, rowValues)
+	}
+	return rows, nil
+}
+
+// Checks a row about to be inserted against the table's unique indexes, and
+// that its values aren't too long to be indexed.
+func checkInsertIndexes(
+	state *db.DBState,
+	tableName string,
+	schema *db.TableSchema,
+	row []db.Value,
+) error {
+	colMap := columnsToColMap(schema.Columns)
+	for _, index := range schema.Indexes {
+		key, noNulls := utils.IndexKey(index, colMap, row)
+		// entries also hold the row's 8 byte offset
+		if len(key)+8 > db.MaxIndexKeyLength {
+			return fmt.Errorf(
+				"!Values of row are too long to be stored in index %v.",
+				index.Name,
+			)
+		}
+		if !index.Unique || !noNulls {
+			continue
+		}
+
+		tree, err := utils.OpenIndex(state, tableName, index)
+		if err != nil {
+			return err
+		}
+		duplicate, err := utils.IndexContainsKey(tree, key)
+		tree.Close()
+		if err != nil {
+			return err
+		}
+		if duplicate {
+			return utils.DuplicateIndexKeyError(tableName, index, colMap, row)
+		}
+	}
+	return nil
+}
+
+// Adds a row just appended to a table at `offset` to each of its indexes. An
+// index that can't be updated is deleted, to be rebuilt from the table the
+// next time it's opened.
+func addInsertedIndexEntries(
+	state *db.DBState,
+	tableName string,
+	schema *db.TableSchema,
+	row []db.Value,
+	offset int64,
+) {
+	colMap := columnsToColMap(schema.Columns)
+	for _, index := range schema.Indexes {
+		tree, err := utils.OpenIndex(state, tableName, index)
+		if err != nil {
+			os.Remove(utils.IndexPath(state, tableName, index.Name))
+			continue
+		}
+		err = utils.InsertIndexEntry(tree, index, colMap, row, offset)
+		closeErr := tree.Close()
+		if err != nil || closeErr != nil {
+			os.Remove(utils.IndexPath(state, tableName, index.Name))
+		}
+	}
+}
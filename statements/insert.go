@@ -7,7 +7,6 @@
 package statements
 
 import (
-	"bufio"
 	"fmt"
 	"os"
 	"sdb/db"
@@ -15,74 +14,250 @@ import (
 	"strings"
 )
 
+// `ColumnNames` is nil unless the insert names the columns being inserted
+// into, in which case any other columns get their default values. `Values`
+// can't reference columns, but can call sequence functions like `nextval`.
 type InsertStatement struct {
-	TableName string
-	Values    []db.Value
+	TableName   string
+	ColumnNames []string
+	Values      []db.Expression
+	Returning   *ReturningClause
 }
 
 func (statement InsertStatement) Execute(state *db.DBState) error {
+	err := checkNotMaterializedView(state, statement.TableName)
+	if err != nil {
+		return err
+	}
+
+	// taken before reading the schema, so indexes can't be created or dropped
+	// before the row's index entries are added
+	unlock, err := state.LockTableWrites(statement.TableName)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
 	tableFile, err := utils.OpenTable(state, statement.TableName, os.O_APPEND|os.O_RDWR)
 	if err != nil {
 		return fmt.Errorf("!Failed to insert into table %v because it does not exist.", statement.TableName)
 	}
 	defer tableFile.Close()
 
-	reader := bufio.NewReader(tableFile)
-	tableHeader, err := reader.ReadString('\n')
+	schema, err := utils.ReadTableSchema(state, statement.TableName)
+	if err != nil {
+		return err
+	}
+	tableColumns := schema.Columns
+
+	rowValues, err := statement.buildRow(state, tableColumns)
+	if err != nil {
+		return err
+	}
+
+	err = checkConstraints(statement.TableName, tableColumns, rowValues)
+	if err != nil {
+		return err
+	}
+
+	err = checkInsertKeys(state, statement.TableName, schema, rowValues)
+	if err != nil {
+		return err
+	}
+
+	err = checkInsertIndexes(state, statement.TableName, schema, rowValues)
+	if err != nil {
+		return err
+	}
+
+	err = checkForeignKeys(
+		state, statement.TableName, schema, [][]db.Value{rowValues}, nil,
+	)
+	if err != nil {
+		return err
+	}
+
+	rowString := utils.RowToString(rowValues)
+
+	// the row is appended, so it starts at the current end of the file
+	info, err := tableFile.Stat()
+	if err != nil {
+		return err
+	}
+
+	_, err = tableFile.WriteString(rowString)
 	if err != nil {
-		return fmt.Errorf("!Failed to read from table file %v.", statement.TableName)
+		return err
 	}
+	addInsertedKeys(state, statement.TableName, schema, rowValues)
+	addInsertedIndexEntries(state, statement.TableName, schema, rowValues, info.Size())
+	fmt.Printf(
+		"Inserted {%v} into %v\n",
+		strings.TrimSpace(utils.ValueListToString(rowValues)),
+		statement.TableName,
+	)
 
-	var tableTypes []db.Type
-	var ok bool
-	for {
-		if tableHeader == "" {
-			break
+	return printReturning(
+		statement.Returning,
+		tableColumns,
+		[][]db.Value{rowValues},
+	)
+}
+
+// Arranges the inserted values in the order of the table's columns, filling in
+// default values for any columns that weren't named in the insert, and
+// converts each value to its column's type, see `assignValue`. Identity
+// columns also get their default, from their sequence, when given NULL.
+func (statement InsertStatement) buildRow(
+	state *db.DBState,
+	tableColumns []db.Column,
+) ([]db.Value, error) {
+	given := make(map[int]db.Expression)
+	if statement.ColumnNames == nil {
+		if len(tableColumns) != len(statement.Values) {
+			return nil, fmt.Errorf("!Failed, list of values to insert does not match table arity.")
+		}
+		for idx, value := range statement.Values {
+			given[idx] = value
+		}
+	} else {
+		if len(statement.ColumnNames) != len(statement.Values) {
+			return nil, fmt.Errorf("!Failed, list of values to insert does not match list of columns.")
 		}
 
-		ident := utils.ParseIdentifier(tableHeader)
-		tableHeader, _ = utils.HasPrefix(tableHeader, ident)
+		colMap := columnsToColMap(tableColumns)
+		for idx, colName := range statement.ColumnNames {
+			colIdx, ok := colMap[colName]
+			if !ok {
+				return nil, fmt.Errorf("!Column %v does not exist in table %v.", colName, statement.TableName)
+			}
+			given[colIdx] = statement.Values[idx]
+		}
+	}
 
-		typeName, err := utils.ParseType(tableHeader)
-		if err != nil {
-			return err
+	rowValues := make([]db.Value, len(tableColumns))
+	for idx, tableColumn := range tableColumns {
+		if expression, ok := given[idx]; ok {
+			value, err := evaluateConstant(state, expression)
+			if err != nil {
+				return nil, err
+			}
+
+			if tableColumn.Identity == "" || value.GetValue() != nil {
+				if tableColumn.Identity == db.GeneratedAlways {
+					return nil, fmt.Errorf(
+						"!Cannot insert a value into column %v of table %v, it "+
+							"is GENERATED ALWAYS AS IDENTITY.",
+						tableColumn.Name,
+						statement.TableName,
+					)
+				}
+				rowValues[idx], err = assignValue(*value, expression, tableColumn)
+				if err != nil {
+					return nil, err
+				}
+				continue
+			}
 		}
-		tableTypes = append(tableTypes, typeName)
 
-		tableHeader, _ = utils.HasPrefix(tableHeader, typeName.ToString())
-		tableHeader, ok = utils.HasPrefix(tableHeader, ",")
-		if !ok {
-			break
+		value, err := defaultValue(state, tableColumn)
+		if err != nil {
+			return nil, err
+		}
+		rowValues[idx], err = assignValue(*value, nil, tableColumn)
+		if err != nil {
+			return nil, err
 		}
+	}
 
+	return rowValues, nil
+}
+
+// Converts a value to be stored in a column, checking that it can be. Numbers
+// stored in decimal columns are rounded to the column's scale, and ints and
+// decimals stored in float columns are converted to floats. Ints and
+// decimals that are out of the range of their column are told apart from
+// values of the wrong type. Values given by a number literal, `expression`,
+// are named in errors as written in the query, so `1e400` isn't spelled out in
+// full. `expression` is nil for values not given in the query, like defaults.
+func assignValue(value db.Value, expression db.Expression, column db.Column) (db.Value, error) {
+	written := value.ToString()
+	if negate, ok := expression.(db.NegateExpression); ok {
+		if literal, ok := negate.Operand.(db.Literal); ok && literal.Text != "" {
+			written = "-" + literal.Text
+		}
+	} else if literal, ok := expression.(db.Literal); ok && literal.Text != "" {
+		written = literal.Text
 	}
+	outOfRange := fmt.Errorf(
+		"!Value %v is out of range for type %v.",
+		written,
+		column.Type.ToString(),
+	)
 
-	if len(tableTypes) != len(statement.Values) {
-		return fmt.Errorf("!Failed, list of values to insert does not match table arity.")
+	if decimalType, isDecimal := column.Type.(db.Decimal); isDecimal && value.Value != nil {
+		if number, ok := db.ToDecimal(value.Value); ok {
+			rounded, fits := decimalType.Round(number)
+			if !fits {
+				return value, outOfRange
+			}
+			return db.Value{Value: rounded, Type: decimalType}, nil
+		}
 	}
-	// check types match
-	for statementIdx, tableColType := range tableTypes {
-		if !statement.Values[statementIdx].TypeMatches(&tableColType) {
-			return fmt.Errorf("!Value %v is not of type %v", statement.Values[statementIdx], tableColType.ToString())
+
+	// strings are stored in date, time, timestamp and interval columns by
+	// parsing them, as in `INSERT INTO t VALUES ('2021-05-01')`
+	if value.Value != nil {
+		switch column.Type.(type) {
+		case db.Date, db.Time, db.Timestamp, db.Interval:
+			return db.ToTemporal(value, column.Type)
 		}
 	}
 
-	var rowBuilder strings.Builder
-	for idx, val := range statement.Values {
-		rowBuilder.WriteString(val.ToString())
-		if idx < len(statement.Values)-1 {
-			rowBuilder.WriteString(", ")
+	// strings are stored in blob columns as their bytes, read like PostgreSQL
+	// reads `bytea`, in JSON, enum and uuid columns as the document, label or
+	// UUID they hold, and in text columns as they are
+	if text, isString := value.Value.(string); isString {
+		switch column.Type.(type) {
+		case db.Blob:
+			blob, err := db.ParseBlob(text)
+			if err != nil {
+				return value, err
+			}
+			return db.Value{Value: blob, Type: column.Type}, nil
+		case db.Text:
+			return db.Value{Value: text, Type: column.Type}, nil
+		case db.JSON, db.Enum, db.UUID:
+			parsed, _, err := db.ParseAs(text, column.Type)
+			if err != nil {
+				return value, err
+			}
+			return parsed, nil
 		}
 	}
-	rowBuilder.WriteRune('\n')
 
-	rowString := rowBuilder.String()
+	// int and decimal literals are stored in float columns as the nearest
+	// float
+	if _, isFloat := column.Type.(db.Float); isFloat {
+		switch number := value.Value.(type) {
+		case int64:
+			return db.Value{Value: float64(number), Type: column.Type}, nil
+		case db.DecimalValue:
+			float, ok := number.Float64()
+			if !ok {
+				return value, outOfRange
+			}
+			return db.Value{Value: float, Type: column.Type}, nil
+		}
+	}
 
-	_, err = tableFile.WriteString(rowString)
-	if err != nil {
-		return err
+	if value.TypeMatches(&column.Type) {
+		return value, nil
 	}
-	fmt.Printf("Inserted {%v} into %v\n", strings.TrimSpace(rowString), statement.TableName)
 
-	return nil
+	_, isInt := value.Type.(db.Int)
+	if _, colInt := column.Type.(db.Int); isInt && colInt {
+		return value, outOfRange
+	}
+	return value, fmt.Errorf("!Value %v is not of type %v", written, column.Type.ToString())
 }
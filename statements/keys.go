@@ -0,0 +1,179 @@
+// sdb/statements/keys.go
+//
+// Implements enforcement of `PRIMARY KEY` and `UNIQUE` constraints. Inserts
+// check new rows against an in-memory index of each key's existing values,
+// cached in DBState, instead of scanning the table for every row.
+
+package statements
+
+import (
+	"fmt"
+	"os"
+	"sdb/db"
+	"sdb/utils"
+	"strings"
+)
+
+// Builds the string that identifies a row's value for the columns of `key`.
+// Returns false if any of the columns is NULL, since NULLs never conflict.
+func keyString(key db.KeyConstraint, colMap map[string]int, row []db.Value) (string, bool) {
+	var keyBuilder strings.Builder
+	for idx, colName := range key.Columns {
+		value := row[colMap[colName]]
+		if value.GetValue() == nil {
+			return "", false
+		}
+		keyBuilder.WriteString(value.ToString())
+		if idx < len(key.Columns)-1 {
+			keyBuilder.WriteString(", ")
+		}
+	}
+	return keyBuilder.String(), true
+}
+
+func duplicateKeyError(tableName string, key db.KeyConstraint, keyValue string) error {
+	constraintName := "UNIQUE"
+	if key.Primary {
+		constraintName = "PRIMARY KEY"
+	}
+	return fmt.Errorf(
+		"!Constraint violation: duplicate key (%v)=(%v) violates %v of table %v.",
+		strings.Join(key.Columns, ", "),
+		keyValue,
+		constraintName,
+		tableName,
+	)
+}
+
+// Checks that no two rows share a value for any of the table's keys or unique
+// indexes. Used by statements that rewrite the whole table, which have every
+// row in hand anyway.
+func checkKeys(tableName string, schema *db.TableSchema, rows [][]db.Value) error {
+	colMap := columnsToColMap(schema.Columns)
+	for _, key := range schema.Keys {
+		seen := make(map[string]bool)
+		for _, row := range rows {
+			keyValue, ok := keyString(key, colMap, row)
+			if !ok {
+				continue
+			}
+			if seen[keyValue] {
+				return duplicateKeyError(tableName, key, keyValue)
+			}
+			seen[keyValue] = true
+		}
+	}
+	for _, index := range schema.Indexes {
+		if !index.Unique {
+			continue
+		}
+		seen := make(map[string]bool)
+		for _, row := range rows {
+			key, noNulls := utils.IndexKey(index, colMap, row)
+			if !noNulls {
+				continue
+			}
+			if seen[string(key)] {
+				return utils.DuplicateIndexKeyError(tableName, index, colMap, row)
+			}
+			seen[string(key)] = true
+		}
+	}
+	return nil
+}
+
+// Returns the key index for a table, rebuilding it from the table file if it
+// isn't cached or the table file has changed since it was built.
+func loadKeyIndex(
+	state *db.DBState,
+	tableName string,
+	schema *db.TableSchema,
+) (*db.KeyIndex, error) {
+	tablePath, _ := utils.TableExists(state, tableName)
+	info, err := os.Stat(tablePath)
+	if err != nil {
+		return nil, err
+	}
+
+	index := state.CachedKeyIndex(tableName)
+	if index != nil && index.Matches(info) {
+		return index, nil
+	}
+
+	_, rows, err := utils.ReadTable(state, tableName)
+	if err != nil {
+		return nil, err
+	}
+
+	colMap := columnsToColMap(schema.Columns)
+	index = &db.KeyIndex{}
+	for _, key := range schema.Keys {
+		keyValues := make(map[string]bool)
+		for _, row := range rows {
+			if keyValue, ok := keyString(key, colMap, row); ok {
+				keyValues[keyValue] = true
+			}
+		}
+		index.Keys = append(index.Keys, keyValues)
+	}
+	index.Stamp(info)
+
+	state.CacheKeyIndex(tableName, index)
+	return index, nil
+}
+
+// Checks a row about to be inserted against the table's key index.
+func checkInsertKeys(
+	state *db.DBState,
+	tableName string,
+	schema *db.TableSchema,
+	row []db.Value,
+) error {
+	if len(schema.Keys) == 0 {
+		return nil
+	}
+
+	index, err := loadKeyIndex(state, tableName, schema)
+	if err != nil {
+		return err
+	}
+
+	colMap := columnsToColMap(schema.Columns)
+	for keyIdx, key := range schema.Keys {
+		keyValue, ok := keyString(key, colMap, row)
+		if ok && index.Keys[keyIdx][keyValue] {
+			return duplicateKeyError(tableName, key, keyValue)
+		}
+	}
+
+	return nil
+}
+
+// Adds a newly inserted row to the table's key index, so the index stays valid
+// without being rebuilt.
+func addInsertedKeys(
+	state *db.DBState,
+	tableName string,
+	schema *db.TableSchema,
+	row []db.Value,
+) {
+	index := state.CachedKeyIndex(tableName)
+	if index == nil {
+		return
+	}
+
+	tablePath, _ := utils.TableExists(state, tableName)
+	info, err := os.Stat(tablePath)
+	if err != nil {
+		state.InvalidateKeyIndex(tableName)
+		return
+	}
+
+	colMap := columnsToColMap(schema.Columns)
+	for keyIdx, key := range schema.Keys {
+		if keyValue, ok := keyString(key, colMap, row); ok {
+			index.Keys[keyIdx][keyValue] = true
+		}
+	}
+	index.Stamp(info)
+}
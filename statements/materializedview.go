@@ -0,0 +1,242 @@
+// sdb/statements/materializedview.go
+//
+// Contains logic for `CREATE MATERIALIZED VIEW`, `REFRESH MATERIALIZED VIEW`
+// and `DROP MATERIALIZED VIEW` statements. The rows of a materialized view are
+// stored in an ordinary table, so selecting from one reads them like any other
+// table, and its query is kept in the catalog so that it can be run again on
+// refresh.
+
+package statements
+
+import (
+	"fmt"
+	"sdb/db"
+	"sdb/utils"
+	"strings"
+)
+
+type CreateMaterializedViewStatement struct {
+	ViewName    string
+	Query       string
+	Select      SelectStatement
+	IfNotExists bool
+}
+
+type RefreshMaterializedViewStatement struct {
+	ViewName string
+}
+
+type DropMaterializedViewStatement struct {
+	ViewName string
+	IfExists bool
+}
+
+// Executes `CREATE MATERIALIZED VIEW [IF NOT EXISTS] <view_name> AS SELECT ...;`
+// queries.
+func (statement CreateMaterializedViewStatement) Execute(state *db.DBState) error {
+	if statement.IfNotExists && isMaterializedView(state, statement.ViewName) {
+		printSkipped("Materialized view", statement.ViewName, true)
+		return nil
+	}
+
+	err := checkNoTemporaryTables(state, statement.ViewName, statement.Select)
+	if err != nil {
+		return err
+	}
+
+	schema, rows, err := materialize(state, statement.Select)
+	if err != nil {
+		return err
+	}
+
+	err = utils.UpdateCatalog(state, func(catalog *db.Catalog) error {
+		_, tableExists := catalog.Tables[statement.ViewName]
+		_, viewExists := catalog.Views[statement.ViewName]
+		if tableExists || viewExists {
+			return fmt.Errorf(
+				"!Failed to create materialized view %v because %v already exists.",
+				statement.ViewName,
+				statement.ViewName,
+			)
+		}
+
+		catalog.Views[statement.ViewName] = db.ViewDefinition{
+			Query:        statement.Query,
+			Materialized: true,
+		}
+		return utils.AddTable(state, catalog, statement.ViewName, schema)
+	})
+	if err != nil {
+		return err
+	}
+
+	// the table is created empty and then replaced with its contents, so it's
+	// never seen half written
+	err = utils.WriteTable(state, statement.ViewName, schema, rows)
+	if err != nil {
+		utils.UpdateCatalog(state, func(catalog *db.Catalog) error {
+			delete(catalog.Views, statement.ViewName)
+			return utils.RemoveTable(state, catalog, statement.ViewName)
+		})
+		return err
+	}
+
+	fmt.Printf("Materialized view %v created.\n", statement.ViewName)
+	return nil
+}
+
+// Executes `REFRESH MATERIALIZED VIEW <view_name>;` queries. The new rows
+// replace the old ones all at once.
+func (statement RefreshMaterializedViewStatement) Execute(state *db.DBState) error {
+	query, err := readMaterializedView(state, statement.ViewName)
+	if err != nil {
+		return err
+	}
+
+	if state.TableLockExists(statement.ViewName) {
+		return fmt.Errorf("!Table %v is locked.", statement.ViewName)
+	}
+
+	oldSchema, err := utils.ReadTableSchema(state, statement.ViewName)
+	if err != nil {
+		return err
+	}
+
+	schema, rows, err := materialize(state, *query)
+	if err != nil {
+		return fmt.Errorf(
+			"!Failed to refresh materialized view %v: %v",
+			statement.ViewName,
+			strings.TrimPrefix(err.Error(), "!"),
+		)
+	}
+
+	// indexes created on the view are kept, and rebuilt by `WriteTable`
+	colMap := columnsToColMap(schema.Columns)
+	for _, index := range oldSchema.Indexes {
+		for _, colName := range index.Columns {
+			if _, ok := colMap[colName]; !ok {
+				return fmt.Errorf(
+					"!Failed to refresh materialized view %v because column "+
+						"%v of %v no longer exists.",
+					statement.ViewName,
+					colName,
+					index.ToString(),
+				)
+			}
+		}
+	}
+	schema.Indexes = oldSchema.Indexes
+
+	err = utils.WriteTable(state, statement.ViewName, schema, rows)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Materialized view %v refreshed.\n", statement.ViewName)
+	return nil
+}
+
+// Executes `DROP MATERIALIZED VIEW [IF EXISTS] <view_name>;` queries.
+// Materialized views that other views select from can't be dropped.
+func (statement DropMaterializedViewStatement) Execute(state *db.DBState) error {
+	if statement.IfExists && !isMaterializedView(state, statement.ViewName) {
+		printSkipped("Materialized view", statement.ViewName, false)
+		return nil
+	}
+
+	if !isMaterializedView(state, statement.ViewName) {
+		return fmt.Errorf(
+			"!Failed to delete materialized view %v because it does not exist.",
+			statement.ViewName,
+		)
+	}
+
+	dependent, err := findDependentView(state, statement.ViewName, "")
+	if err != nil {
+		return err
+	}
+	if dependent != "" {
+		return fmt.Errorf(
+			"!Failed to delete materialized view %v because view %v depends on it.",
+			statement.ViewName,
+			dependent,
+		)
+	}
+
+	if state.TableLockExists(statement.ViewName) {
+		return fmt.Errorf("!Table %v is locked.", statement.ViewName)
+	}
+
+	err = utils.UpdateCatalog(state, func(catalog *db.Catalog) error {
+		delete(catalog.Views, statement.ViewName)
+		return utils.RemoveTable(state, catalog, statement.ViewName)
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Deleted materialized view %v.\n", statement.ViewName)
+	return nil
+}
+
+func isMaterializedView(state *db.DBState, viewName string) bool {
+	_, exists := lookupView(state, viewName, true)
+	return exists
+}
+
+// Reads and parses the query of a materialized view.
+func readMaterializedView(state *db.DBState, viewName string) (*SelectStatement, error) {
+	query, exists := lookupView(state, viewName, true)
+	if !exists {
+		return nil, fmt.Errorf("!Materialized view %v does not exist.", viewName)
+	}
+	return parseView(viewName, query)
+}
+
+// Returns an error if `tableName` is a materialized view, whose rows can only
+// be changed by refreshing it.
+func checkNotMaterializedView(state *db.DBState, tableName string) error {
+	if isMaterializedView(state, tableName) && !state.IsTemporaryTable(tableName) {
+		return fmt.Errorf(
+			"!Cannot modify %v, it is a materialized view. Use REFRESH "+
+				"MATERIALIZED VIEW instead.",
+			tableName,
+		)
+	}
+	return nil
+}
+
+// Runs the query of a materialized view, giving the schema and rows of the
+// table storing it. Only the names and types of the selected columns are kept,
+// not their constraints. Selected expressions other than column names need to
+// be named with `AS` to be stored in a table.
+func materialize(
+	state *db.DBState,
+	query SelectStatement,
+) (*db.TableSchema, [][]db.Value, error) {
+	columns, rows, err := query.query(state, 1)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	schema := &db.TableSchema{}
+	for _, column := range columns {
+		if utils.ParseIdentifier(column.Name) != column.Name {
+			return nil, nil, fmt.Errorf(
+				"!Column %v of a materialized view must be named with AS.",
+				column.Name,
+			)
+		}
+		if _, isNull := column.Type.(db.Null); isNull {
+			return nil, nil, fmt.Errorf(
+				"!Column %v of a materialized view has no type.", column.Name,
+			)
+		}
+		schema.Columns = append(schema.Columns, db.Column{
+			Name: column.Name,
+			Type: column.Type,
+		})
+	}
+	return schema, rows, nil
+}
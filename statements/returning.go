@@ -0,0 +1,79 @@
+// sdb/statements/returning.go
+//
+// Implements logic for `RETURNING` clauses in INSERT/UPDATE/DELETE statements.
+
+package statements
+
+import (
+	"fmt"
+	"sdb/db"
+	"sdb/utils"
+	"strings"
+)
+
+// `RETURNING *` is represented with `AllColumns` set and no expressions.
+type ReturningClause struct {
+	AllColumns  bool
+	Expressions []db.Expression
+}
+
+// Prints the rows affected by a statement in the same format as `SELECT`
+// output, evaluating the returning expressions against each row. Does nothing
+// if the statement had no `RETURNING` clause.
+func printReturning(
+	returning *ReturningClause,
+	columns []db.Column,
+	rows [][]db.Value,
+) error {
+	if returning == nil {
+		return nil
+	}
+
+	var outputBuilder strings.Builder
+
+	if returning.AllColumns {
+		outputBuilder.WriteString(utils.ColumnsToString(columns))
+		outputBuilder.WriteString("\n")
+		for _, row := range rows {
+			outputBuilder.WriteString(utils.ValueListToString(row))
+		}
+
+		fmt.Println(outputBuilder.String())
+		return nil
+	}
+
+	for idx, expression := range returning.Expressions {
+		outputBuilder.WriteString(expression.ToString())
+		outputBuilder.WriteString(" ")
+		outputBuilder.WriteString(expression.TypeOf(columns).ToString())
+		if idx < len(returning.Expressions)-1 {
+			outputBuilder.WriteString(", ")
+		}
+	}
+	outputBuilder.WriteString("\n")
+
+	colMap := columnsToColMap(columns)
+	for _, row := range rows {
+		var returnedValues []db.Value
+		for _, expression := range returning.Expressions {
+			value, err := expression.Evaluate(colMap, row)
+			if err != nil {
+				return err
+			}
+			returnedValues = append(returnedValues, *value)
+		}
+		outputBuilder.WriteString(utils.ValueListToString(returnedValues))
+	}
+
+	fmt.Println(outputBuilder.String())
+	return nil
+}
+
+// Maps each column name to its index, like `utils.TableHeaderToColMap`.
+func columnsToColMap(columns []db.Column) map[string]int {
+	colMap := make(map[string]int)
+	for idx, column := range columns {
+		colMap[column.Name] = idx
+	}
+	return colMap
+}
@@ -10,141 +10,639 @@ package statements
 import (
 	"bufio"
 	"fmt"
+	"io"
 	"os"
 	"sdb/db"
 	"sdb/utils"
+	"sort"
 	"strings"
 )
 
+// `SELECT *` is represented with `AllColumns` set and no columns, like
+// `ReturningClause`.
 type SelectStatement struct {
 	TableName   string
-	ColumnNames []string
+	AllColumns  bool
+	Columns     []SelectedColumn
 	JoinClause  *JoinClause
 	WhereClause *WhereClause
+	GroupBy     []db.Expression
+	OrderBy     []OrderTerm
 }
 
-// Executes `SELECT <columns> FROM <table_name> [WHERE <condition>];` queries.
+// Expression in the list of a `SELECT`, like `price` or `price > 10 AS
+// expensive`. `Alias` is "" if the expression isn't given a name.
+type SelectedColumn struct {
+	Expression db.Expression
+	Alias      string
+}
+
+// Expression a query's rows are sorted by, like `price DESC`. `ORDER BY`
+// takes a list of these, where later terms break ties between earlier ones.
+type OrderTerm struct {
+	Expression db.Expression
+	Descending bool
+}
+
+// Executes `SELECT <columns> [FROM <table_name>] [WHERE <condition>] [GROUP BY
+// <expressions>] [ORDER BY <terms>];` queries, where columns are `*` or
+// expressions, each optionally named with `AS <name>`. Without `FROM`, the
+// expressions are evaluated once, as in `SELECT nextval('ids');`.
 func (statement SelectStatement) Execute(state *db.DBState) error {
-	tableFile, err := utils.OpenTable(state, statement.TableName, os.O_RDONLY)
+	columns, rows, err := statement.query(state, 0)
 	if err != nil {
-		return fmt.Errorf("!Failed to select from table %v because it does not exist.", statement.TableName)
+		return err
 	}
-	defer tableFile.Close()
 
-	var joinTableFile *os.File
+	printResult(columns, rows)
+	return nil
+}
+
+// Prints the header of a result's columns followed by each of its rows.
+func printResult(columns []db.Column, rows [][]db.Value) {
+	var outputBuilder strings.Builder
+	outputBuilder.WriteString(utils.ColumnsToString(columns))
+	outputBuilder.WriteString("\n")
+	for _, row := range rows {
+		outputBuilder.WriteString(utils.ValueListToString(row))
+	}
+
+	fmt.Println(outputBuilder.String())
+}
+
+// Computes the columns and rows selected by the statement. `depth` is the
+// number of views being queried through, see `queryView`.
+func (statement SelectStatement) query(
+	state *db.DBState,
+	depth int,
+) ([]db.Column, [][]db.Value, error) {
+	source, err := openRelation(state, statement.TableName, depth)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer source.close()
+	tableColumns := source.schema.Columns
+
+	var joined *relation
 	if statement.JoinClause != nil {
-		joinTableFile, err = utils.OpenTable(state, statement.JoinClause.RightTable, os.O_RDONLY)
+		joined, err = openRelation(state, statement.JoinClause.RightTable, depth)
 		if err != nil {
-			return fmt.Errorf("!Failed to select from table %v because it does not exist.", statement.JoinClause.RightTable)
+			return nil, nil, err
 		}
-		defer joinTableFile.Close()
-	}
+		defer joined.close()
 
-	var outputBuilder strings.Builder
+		// add joined columns to header
+		tableColumns = append(
+			append([]db.Column{}, tableColumns...), joined.schema.Columns...,
+		)
+	}
+	colMap := columnsToColMap(tableColumns)
+	leftColMap := columnsToColMap(source.schema.Columns)
 
-	tableReader := bufio.NewReader(tableFile)
-	tableHeader, err := tableReader.ReadString('\n')
+	selectedColumns, err := statement.resultColumns(tableColumns)
 	if err != nil {
-		return err
+		return nil, nil, err
+	}
+	if err = checkWhereColumns(statement.WhereClause, tableColumns); err != nil {
+		return nil, nil, err
+	}
+	statement.WhereClause, err = foldWhereCasts(statement.WhereClause)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	// write names of selected columns into output
-	tableColumns, err := utils.ParseColumnList(tableHeader)
+	// the WHERE clause can only use an index of the table being selected
+	// from, not of the joined table
+	var where *WhereClause
+	if statement.WhereClause != nil && colMap[statement.WhereClause.ColName] < len(source.schema.Columns) {
+		where = statement.WhereClause
+	}
+	nextRow, err := source.scan(state, where)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 
-	// need to forward declare variables used in JOINs
-	var joinTableColMap map[string]int
-	var joinTableRows [][]db.Value
-	if statement.JoinClause != nil {
-		joinTableReader := bufio.NewReader(joinTableFile)
-		joinTableHeader, _ := joinTableReader.ReadString('\n')
-		joinTableColMap = utils.TableHeaderToColMap(joinTableHeader)
+	// iterate through all rows of the table and process as necessary
+	var matched [][]db.Value
+	for {
+		rowValues, err := nextRow()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, nil, err
+		}
 
-		for {
-			joinRow, err := joinTableReader.ReadString('\n')
+		candidates := [][]db.Value{rowValues}
+		if statement.JoinClause != nil {
+			leftValue := rowValues[leftColMap[statement.JoinClause.LeftTableColumn]]
+			joinRows, err := joined.matching(
+				state, statement.JoinClause.RightTableColumn, &leftValue,
+			)
 			if err != nil {
-				break
+				return nil, nil, err
 			}
-			joinRowValues, _, _ := utils.ParseValueList(joinRow)
-			joinTableRows = append(joinTableRows, joinRowValues)
-		}
 
-		// add joined columns to header
-		var builder strings.Builder
-		builder.WriteString(strings.TrimSpace(tableHeader))
-		builder.WriteString(", ")
-		builder.WriteString(joinTableHeader)
+			// join this row to the joining table's matching rows
+			candidates = applyJoin(
+				*statement.JoinClause,
+				leftColMap,
+				columnsToColMap(joined.schema.Columns),
+				len(joined.schema.Columns),
+				joinRows,
+				rowValues,
+			)
+		}
 
-		tableHeader = builder.String()
+		// filter out rows according to `where`
+		for _, candidate := range candidates {
+			applies, err := whereApplies(statement.WhereClause, colMap, candidate)
+			if err != nil {
+				return nil, nil, err
+			}
+			if applies {
+				matched = append(matched, candidate)
+			}
+		}
 	}
 
-	if statement.ColumnNames[0] == "*" {
-		outputBuilder.WriteString(tableHeader)
+	// evaluate selected columns, for each row or for each group of rows
+	var results []resultRow
+	if statement.grouped() {
+		groups, err := statement.groupRows(colMap, matched)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, group := range groups {
+			group := group
+			result, err := statement.resultRow(selectedColumns, nil, func(e db.Expression) (*db.Value, error) {
+				resolved, err := resolveSequenceCalls(state, e)
+				if err != nil {
+					return nil, err
+				}
+				return groupValue(resolved, statement.GroupBy, colMap, group)
+			})
+			if err != nil {
+				return nil, nil, err
+			}
+			results = append(results, result)
+		}
 	} else {
-		for statementColumnsIdx, statementColumnName := range statement.ColumnNames {
-			for _, tableColumn := range tableColumns {
-				if tableColumn.Name == statementColumnName {
+		for _, row := range matched {
+			row := row
+			result, err := statement.resultRow(selectedColumns, row, func(e db.Expression) (*db.Value, error) {
+				// `nextval` gives each row its own value
+				resolved, err := resolveSequenceCalls(state, e)
+				if err != nil {
+					return nil, err
+				}
+				return resolved.Evaluate(colMap, row)
+			})
+			if err != nil {
+				return nil, nil, err
+			}
+			results = append(results, result)
+		}
+	}
 
-					outputBuilder.WriteString(tableColumn.Name)
-					outputBuilder.WriteString(" ")
-					outputBuilder.WriteString(tableColumn.Type.ToString())
+	if err = statement.sortResults(results); err != nil {
+		return nil, nil, err
+	}
+	rows := make([][]db.Value, len(results))
+	for idx, result := range results {
+		rows[idx] = result.values
+	}
+	return selectedColumns, rows, nil
+}
+
+// Row of a query's result, along with the values of its `ORDER BY` terms.
+type resultRow struct {
+	values   []db.Value
+	sortKeys []db.Value
+}
+
+// Computes a row of the result, where `evaluate` evaluates an expression for
+// one row of the tables selected from, `row`, or for one group of their rows.
+// `ORDER BY` terms can also name a column of the result, by its alias if it
+// has one, or give its position counting from 1, as in `ORDER BY 2`.
+func (statement SelectStatement) resultRow(
+	columns []db.Column,
+	row []db.Value,
+	evaluate func(db.Expression) (*db.Value, error),
+) (resultRow, error) {
+	var result resultRow
+	if statement.AllColumns {
+		result.values = row
+	}
+	for _, selected := range statement.Columns {
+		value, err := evaluate(selected.Expression)
+		if err != nil {
+			return result, err
+		}
+		result.values = append(result.values, *value)
+	}
+
+	for _, term := range statement.OrderBy {
+		key, err := result.orderKey(term.Expression, columns, evaluate)
+		if err != nil {
+			return result, err
+		}
+		result.sortKeys = append(result.sortKeys, *key)
+	}
+	return result, nil
+}
+
+func (result resultRow) orderKey(
+	expression db.Expression,
+	columns []db.Column,
+	evaluate func(db.Expression) (*db.Value, error),
+) (*db.Value, error) {
+	if ref, ok := expression.(db.ColumnRef); ok {
+		for idx, column := range columns {
+			if column.Name == ref.Name {
+				return &result.values[idx], nil
+			}
+		}
+	}
+	if literal, ok := expression.(db.Literal); ok {
+		if position, isInt := literal.Value.Value.(int64); isInt {
+			if position < 1 || position > int64(len(result.values)) {
+				return nil, fmt.Errorf("!ORDER BY position %v is not in select list.", position)
+			}
+			return &result.values[position-1], nil
+		}
+	}
+	return evaluate(expression)
+}
 
-					if statementColumnsIdx < len(statement.ColumnNames)-1 {
-						outputBuilder.WriteString(", ")
-					}
+// Sorts the rows of a result by their `ORDER BY` terms. NULLs sort after
+// every other value, or before them for `DESC` terms.
+func (statement SelectStatement) sortResults(results []resultRow) error {
+	var err error
+	sort.SliceStable(results, func(i int, j int) bool {
+		for idx, term := range statement.OrderBy {
+			left, right := &results[i].sortKeys[idx], &results[j].sortKeys[idx]
+			var order int
+			if left.Value == nil || right.Value == nil {
+				order = compareNulls(left.Value == nil, right.Value == nil)
+			} else {
+				var compareErr error
+				order, compareErr = db.CompareValues(left, right)
+				if compareErr != nil {
+					err = compareErr
+					return false
 				}
 			}
+
+			if term.Descending {
+				order = -order
+			}
+			if order != 0 {
+				return order < 0
+			}
 		}
-		outputBuilder.WriteString("\n")
+		return false
+	})
+	return err
+}
+
+func compareNulls(leftNull bool, rightNull bool) int {
+	if leftNull == rightNull {
+		return 0
+	} else if leftNull {
+		return 1
 	}
+	return -1
+}
 
-	colMap := utils.TableHeaderToColMap(tableHeader)
-	var rowStringBuilder strings.Builder
+// Determines if the query gives a row per group of rows rather than per row,
+// because it has a `GROUP BY` or uses aggregate functions like `count(*)`.
+func (statement SelectStatement) grouped() bool {
+	if len(statement.GroupBy) > 0 {
+		return true
+	}
+	for _, selected := range statement.Columns {
+		if db.HasAggregate(selected.Expression) {
+			return true
+		}
+	}
+	for _, term := range statement.OrderBy {
+		if db.HasAggregate(term.Expression) {
+			return true
+		}
+	}
+	return false
+}
 
-	// iterate through all rows/lines of the table file and process as necessary
-	for {
-		row, err := tableReader.ReadString('\n')
-		if err != nil {
-			break
+// Splits rows into groups with equal values of the `GROUP BY` expressions, in
+// the order each group is first seen. NULLs are grouped together. Without a
+// `GROUP BY`, every row is in one group, even if there are none.
+func (statement SelectStatement) groupRows(
+	colMap map[string]int,
+	rows [][]db.Value,
+) ([][][]db.Value, error) {
+	if len(statement.GroupBy) == 0 {
+		return [][][]db.Value{rows}, nil
+	}
+
+	var groups [][][]db.Value
+	groupIndexes := map[string]int{}
+	for _, row := range rows {
+		keyValues := make([]db.Value, len(statement.GroupBy))
+		for idx, expression := range statement.GroupBy {
+			value, err := expression.Evaluate(colMap, row)
+			if err != nil {
+				return nil, err
+			}
+			keyValues[idx] = *value
 		}
 
-		rowValues, _, _ := utils.ParseValueList(row)
+		// values that compare equal have the same index key
+		key := string(db.EncodeIndexKey(keyValues))
+		groupIdx, seen := groupIndexes[key]
+		if !seen {
+			groupIdx = len(groups)
+			groupIndexes[key] = groupIdx
+			groups = append(groups, nil)
+		}
+		groups[groupIdx] = append(groups[groupIdx], row)
+	}
+	return groups, nil
+}
 
-		if statement.JoinClause != nil {
-			// this join row to the joining table's matching row
-			joined := applyJoin(*statement.JoinClause, colMap, joinTableColMap, joinTableRows, rowValues)
-			if joined == "" {
+// Evaluates an expression for a group of rows. Aggregates are computed over
+// the rows of the group, and `GROUP BY` expressions have the same value for
+// every row of the group, but any other column has no single value.
+func groupValue(
+	expression db.Expression,
+	groupBy []db.Expression,
+	colMap map[string]int,
+	rows [][]db.Value,
+) (*db.Value, error) {
+	resolved, err := db.MapExpression(expression, func(e db.Expression) (db.Expression, error) {
+		call, ok := e.(db.AggregateCall)
+		if !ok {
+			return e, nil
+		}
+		value, err := call.Aggregate(colMap, rows)
+		if err != nil {
+			return nil, err
+		}
+		return db.Literal{Value: *value}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	resolved, err = db.MapExpression(resolved, func(e db.Expression) (db.Expression, error) {
+		for _, grouped := range groupBy {
+			if e.ToString() != grouped.ToString() {
 				continue
-			} else {
-				row = joined
 			}
+			value, err := grouped.Evaluate(colMap, rows[0])
+			if err != nil {
+				return nil, err
+			}
+			return db.Literal{Value: *value}, nil
 		}
+		return e, nil
+	})
+	if err != nil {
+		return nil, err
+	}
 
-		// filter out rows according to `where`
-		if whereApplies(statement.WhereClause, colMap, rowValues) {
-			if statement.ColumnNames[0] == "*" {
-				outputBuilder.WriteString(row)
-			} else {
-				// filter out selected columns
-				for colNameIdx, colName := range statement.ColumnNames {
-					selectedValue := rowValues[colMap[colName]]
-					rowStringBuilder.WriteString(selectedValue.ToString())
-					if colNameIdx < len(statement.ColumnNames)-1 {
-						rowStringBuilder.WriteString(", ")
-					}
+	if colNames := db.ReferencedColumns(resolved); len(colNames) > 0 {
+		return nil, fmt.Errorf(
+			"!Column %v must appear in GROUP BY or be used in an aggregate function.",
+			colNames[0],
+		)
+	}
+	return resolved.Evaluate(colMap, nil)
+}
+
+// Computes just the columns selected by the statement, from the schemas of the
+// tables and views it selects from, without reading any rows.
+func (statement SelectStatement) columns(state *db.DBState, depth int) ([]db.Column, error) {
+	tableColumns, err := relationColumns(state, statement.TableName, depth)
+	if err != nil {
+		return nil, err
+	}
+	if statement.JoinClause != nil {
+		joinedColumns, err := relationColumns(state, statement.JoinClause.RightTable, depth)
+		if err != nil {
+			return nil, err
+		}
+		tableColumns = append(append([]db.Column{}, tableColumns...), joinedColumns...)
+	}
+
+	return statement.resultColumns(tableColumns)
+}
+
+// Finds the columns of the statement's result, given the columns of the tables
+// it selects from. Selecting `*` gives every column and a column name gives
+// that column, while any other expression gives a column of the type it
+// evaluates to, named by the expression as it would be written in a query.
+func (statement SelectStatement) resultColumns(tableColumns []db.Column) ([]db.Column, error) {
+	if statement.AllColumns && statement.grouped() {
+		return nil, fmt.Errorf("!SELECT * can't be used with GROUP BY or aggregate functions.")
+	}
+	if statement.AllColumns {
+		return tableColumns, nil
+	}
+
+	colMap := columnsToColMap(tableColumns)
+	var selectedColumns []db.Column
+	for _, selected := range statement.Columns {
+		for _, colName := range db.ReferencedColumns(selected.Expression) {
+			if _, ok := colMap[colName]; !ok {
+				return nil, fmt.Errorf("!Column %v does not exist.", colName)
+			}
+		}
+
+		column := db.Column{
+			Name: selected.Expression.ToString(),
+			Type: selected.Expression.TypeOf(tableColumns),
+		}
+		if ref, ok := selected.Expression.(db.ColumnRef); ok {
+			column = tableColumns[colMap[ref.Name]]
+		}
+		if selected.Alias != "" {
+			column.Name = selected.Alias
+		}
+		selectedColumns = append(selectedColumns, column)
+	}
+	return selectedColumns, nil
+}
+
+// Gets the columns of a table, view, or `information_schema` table. `depth` is
+// the number of views being looked through, as in `query`.
+func relationColumns(state *db.DBState, name string, depth int) ([]db.Column, error) {
+	if name == "" {
+		return nil, nil
+	}
+	if strings.HasPrefix(name, informationSchema) {
+		return informationSchemaTable(name)
+	}
+
+	if viewExists(state, name) {
+		if depth+1 > maxViewDepth {
+			return nil, fmt.Errorf("!View %v is nested too deeply.", name)
+		}
+		query, err := readView(state, name)
+		if err != nil {
+			return nil, err
+		}
+		return query.columns(state, depth+1)
+	}
+
+	schema, err := utils.ReadTableSchema(state, name)
+	if err != nil {
+		return nil, fmt.Errorf("!Failed to select from table %v because it does not exist.", name)
+	}
+	return schema.Columns, nil
+}
+
+// A table or view being selected from. Tables are read from their file a row
+// at a time, and can use their indexes to avoid reading every row, while the
+// rows of views and the `information_schema` tables are computed up front.
+type relation struct {
+	name   string
+	schema *db.TableSchema
+	file   *os.File
+	reader *bufio.Reader
+	rows   [][]db.Value
+	index  *db.BTree
+}
+
+func openRelation(state *db.DBState, name string, depth int) (*relation, error) {
+	// a SELECT without FROM has a single row with no columns
+	if name == "" {
+		rows := [][]db.Value{{}}
+		return &relation{schema: &db.TableSchema{}, rows: rows}, nil
+	}
+	if strings.HasPrefix(name, informationSchema) {
+		columns, rows, err := queryInformationSchema(state, name)
+		if err != nil {
+			return nil, err
+		}
+		schema := &db.TableSchema{Columns: columns}
+		return &relation{name: name, schema: schema, rows: rows}, nil
+	}
+
+	if viewExists(state, name) {
+		columns, rows, err := queryView(state, name, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		schema := &db.TableSchema{Columns: columns}
+		return &relation{name: name, schema: schema, rows: rows}, nil
+	}
+
+	schema, err := utils.ReadTableSchema(state, name)
+	if err != nil {
+		return nil, fmt.Errorf("!Failed to select from table %v because it does not exist.", name)
+	}
+
+	tableFile, err := utils.OpenTable(state, name, os.O_RDONLY)
+	if err != nil {
+		return nil, err
+	}
+	reader := bufio.NewReader(tableFile)
+
+	return &relation{name: name, schema: schema, file: tableFile, reader: reader}, nil
+}
+
+func (source *relation) close() {
+	if source.file != nil {
+		source.file.Close()
+	}
+	if source.index != nil {
+		source.index.Close()
+	}
+}
+
+// Returns a function giving each row of the relation in turn, and io.EOF after
+// the last row. If `where` is on an indexed column of a table, only the rows
+// found through the index are given, otherwise every row is.
+func (source *relation) scan(
+	state *db.DBState,
+	where *WhereClause,
+) (func() ([]db.Value, error), error) {
+	if source.file == nil {
+		rows := source.rows
+		return func() ([]db.Value, error) {
+			if len(rows) == 0 {
+				return nil, io.EOF
+			}
+			row := rows[0]
+			rows = rows[1:]
+			return row, nil
+		}, nil
+	}
+
+	offsets, indexed, err := whereIndexOffsets(state, source.name, source.schema, where)
+	if err != nil {
+		return nil, err
+	}
+
+	return func() ([]db.Value, error) {
+		var row string
+		var err error
+		if !indexed {
+			row, err = source.reader.ReadString('\n')
+		} else if len(offsets) == 0 {
+			err = io.EOF
+		} else {
+			row, err = utils.ReadRowAt(source.file, offsets[0])
+			offsets = offsets[1:]
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		rowValues, _ := utils.ParseRow(row, source.schema.Columns)
+		return rowValues, nil
+	}, nil
+}
+
+// Finds the rows of the relation that could have `value` in column `colName`,
+// using an index if the relation is a table with one on the column. Otherwise
+// every row is read, once, and kept for later calls.
+func (source *relation) matching(
+	state *db.DBState,
+	colName string,
+	value *db.Value,
+) ([][]db.Value, error) {
+	if source.file != nil {
+		if index := indexOnColumn(source.schema, colName); index != nil {
+			if source.index == nil {
+				tree, err := utils.OpenIndex(state, source.name, *index)
+				if err != nil {
+					return nil, err
 				}
-				rowStringBuilder.WriteString("\n")
+				source.index = tree
 			}
+			return indexedJoinRows(source.index, source.file, source.schema, colName, value)
+		}
 
-			outputBuilder.WriteString(rowStringBuilder.String())
+		nextRow, err := source.scan(state, nil)
+		if err != nil {
+			return nil, err
+		}
+		source.rows = [][]db.Value{}
+		for {
+			row, err := nextRow()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				return nil, err
+			}
+			source.rows = append(source.rows, row)
 		}
-		rowStringBuilder.Reset()
+		source.file.Close()
+		source.file = nil
 	}
 
-	fmt.Println(outputBuilder.String())
-	return nil
+	return source.rows, nil
 }
 
 type JoinType string
@@ -167,36 +665,33 @@ type JoinClause struct {
 
 // Determines if a row in the 'left' table should be joined to any rows from the
 // 'right' table. Assumes that tables are being joined on an equality
-// comparison between the joining columns.
+// comparison between the joining columns. A row of a left outer join with no
+// matches is padded with NULLs for the `joinWidth` columns of the right table.
 func applyJoin(
 	joinClause JoinClause,
 	colNames map[string]int,
 	joinColNames map[string]int,
+	joinWidth int,
 	joinRows [][]db.Value,
 	row []db.Value,
-) string {
-	var joinedRowsBuilder strings.Builder
+) [][]db.Value {
+	var joinedRows [][]db.Value
 	for _, joinRow := range joinRows {
 		leftColIdx := colNames[joinClause.LeftTableColumn]
 		rightColIdx := joinColNames[joinClause.RightTableColumn]
 
-		var matchingRowBuilder strings.Builder
-		if row[leftColIdx] == joinRow[rightColIdx] {
-			matchingRowBuilder.WriteString(
-				strings.TrimSpace(utils.ValueListToString(row)),
-			)
-			matchingRowBuilder.WriteString(", ")
-			matchingRowBuilder.WriteString(utils.ValueListToString(joinRow))
-
-			joinedRowsBuilder.WriteString(matchingRowBuilder.String())
-			matchingRowBuilder.Reset()
+		if valuesEqual(row[leftColIdx], joinRow[rightColIdx]) {
+			matchingRow := append([]db.Value{}, row...)
+			joinedRows = append(joinedRows, append(matchingRow, joinRow...))
 		}
 	}
 
-	joinedRows := joinedRowsBuilder.String()
-
-	if joinedRows == "" && joinClause.JoinType == LeftOuterJoin {
-		return utils.ValueListToString(row)
+	if len(joinedRows) == 0 && joinClause.JoinType == LeftOuterJoin {
+		paddedRow := append([]db.Value{}, row...)
+		for idx := 0; idx < joinWidth; idx++ {
+			paddedRow = append(paddedRow, db.Value{Value: nil, Type: db.Null{}})
+		}
+		return [][]db.Value{paddedRow}
 	}
 
 	return joinedRows
@@ -0,0 +1,235 @@
+// sdb/statements/sequence.go
+//
+// Contains logic for `CREATE SEQUENCE` and `DROP SEQUENCE` statements, and for
+// evaluating the `nextval` and `currval` sequence functions.
+
+package statements
+
+import (
+	"fmt"
+	"sdb/db"
+	"sdb/utils"
+)
+
+type CreateSequenceStatement struct {
+	SequenceName string
+	Start        int64
+	Increment    int64
+	IfNotExists  bool
+}
+
+type DropSequenceStatement struct {
+	SequenceName string
+	IfExists     bool
+}
+
+// Executes `CREATE SEQUENCE [IF NOT EXISTS] <name> [START [WITH] <n>]
+// [INCREMENT [BY] <n>];` queries.
+func (statement CreateSequenceStatement) Execute(state *db.DBState) error {
+	if statement.IfNotExists && state.SequenceExists(statement.SequenceName) {
+		printSkipped("Sequence", statement.SequenceName, true)
+		return nil
+	}
+
+	err := utils.UpdateCatalog(state, func(catalog *db.Catalog) error {
+		return addSequence(
+			state, catalog, statement.SequenceName, statement.Start, statement.Increment,
+		)
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Sequence %v created.\n", statement.SequenceName)
+	return nil
+}
+
+// Executes `DROP SEQUENCE [IF EXISTS] <name>;` queries. Sequences used by a
+// column's `DEFAULT`, including identity columns, can't be dropped.
+func (statement DropSequenceStatement) Execute(state *db.DBState) error {
+	if statement.IfExists && !state.SequenceExists(statement.SequenceName) {
+		printSkipped("Sequence", statement.SequenceName, false)
+		return nil
+	}
+
+	err := utils.UpdateCatalog(state, func(catalog *db.Catalog) error {
+		if _, exists := catalog.Sequences[statement.SequenceName]; !exists {
+			return fmt.Errorf(
+				"!Failed to delete sequence %v because it does not exist.",
+				statement.SequenceName,
+			)
+		}
+
+		for tableName, schema := range catalog.Tables {
+			for _, column := range schema.Columns {
+				if column.Default != nil && usesSequence(column.Default, statement.SequenceName) {
+					return fmt.Errorf(
+						"!Failed to delete sequence %v because it is used by "+
+							"column %v of table %v.",
+						statement.SequenceName,
+						column.Name,
+						tableName,
+					)
+				}
+			}
+		}
+
+		return removeSequence(state, catalog, statement.SequenceName)
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Deleted sequence %v.\n", statement.SequenceName)
+	return nil
+}
+
+// Creates a sequence whose first value is `start`, and adds it to the catalog.
+// Meant to be called from within `utils.UpdateCatalog`.
+func addSequence(
+	state *db.DBState,
+	catalog *db.Catalog,
+	name string,
+	start int64,
+	increment int64,
+) error {
+	if _, exists := catalog.Sequences[name]; exists {
+		return fmt.Errorf("!Sequence %v already exists.", name)
+	}
+
+	err := state.CreateSequence(name, start)
+	if err != nil {
+		return err
+	}
+
+	catalog.Sequences[name] = db.SequenceDefinition{Start: start, Increment: increment}
+	return nil
+}
+
+// Removes a sequence from the catalog along with its value. Meant to be called
+// from within `utils.UpdateCatalog`.
+func removeSequence(state *db.DBState, catalog *db.Catalog, name string) error {
+	if _, exists := catalog.Sequences[name]; !exists {
+		return fmt.Errorf("!Sequence %v does not exist.", name)
+	}
+
+	delete(catalog.Sequences, name)
+	// the sequence is gone once it's out of the catalog, even if its value
+	// can't be removed
+	state.DropSequence(name)
+	return nil
+}
+
+// Determines if an expression calls `nextval` or `currval` on a sequence.
+func usesSequence(expression db.Expression, sequenceName string) bool {
+	found := false
+	db.MapExpression(expression, func(e db.Expression) (db.Expression, error) {
+		if call, ok := e.(db.FunctionCall); ok && db.IsSequenceFunction(call.Name) {
+			name, _ := db.SequenceArgument(call)
+			found = found || name == sequenceName
+		}
+		return e, nil
+	})
+	return found
+}
+
+// Replaces every `nextval` and `currval` call in an expression with its result,
+// so the expression can be evaluated without the database state. Every
+// `nextval` call allocates a new value.
+func resolveSequenceCalls(state *db.DBState, expression db.Expression) (db.Expression, error) {
+	return db.MapExpression(expression, func(e db.Expression) (db.Expression, error) {
+		call, ok := e.(db.FunctionCall)
+		if !ok || !db.IsSequenceFunction(call.Name) {
+			return e, nil
+		}
+
+		name, err := db.SequenceArgument(call)
+		if err != nil {
+			return nil, err
+		}
+
+		var value int64
+		if call.Name == "nextval" {
+			value, err = nextSequenceValue(state, name)
+		} else {
+			value, err = state.CurrentSequenceValue(name)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		return db.Literal{Value: db.Value{Value: value, Type: db.Int{Size: 8}}}, nil
+	})
+}
+
+// Allocates the next value of a sequence, by the increment in its definition.
+func nextSequenceValue(state *db.DBState, name string) (int64, error) {
+	if !state.SequenceExists(name) {
+		return 0, fmt.Errorf("!Sequence %v does not exist.", name)
+	}
+	catalog, err := utils.LoadCatalog(state)
+	if err != nil {
+		return 0, err
+	}
+	sequence, exists := catalog.Sequences[name]
+	if !exists {
+		return 0, fmt.Errorf("!Sequence %v does not exist.", name)
+	}
+	return state.NextSequenceValue(name, sequence.Increment)
+}
+
+// Evaluates an expression that doesn't reference any columns, like an inserted
+// value or a `DEFAULT`.
+func evaluateConstant(state *db.DBState, expression db.Expression) (*db.Value, error) {
+	resolved, err := resolveSequenceCalls(state, expression)
+	if err != nil {
+		return nil, err
+	}
+	return resolved.Evaluate(map[string]int{}, []db.Value{})
+}
+
+// Checks that an identity column is of one of the int types.
+func validateIdentityColumn(tableName string, column db.Column) error {
+	if _, isInt := column.Type.(db.Int); !isInt {
+		return fmt.Errorf(
+			"!Identity column %v of table %v must be of type smallint, int or bigint.",
+			column.Name,
+			tableName,
+		)
+	}
+	return nil
+}
+
+// Creates the sequence backing an identity column, named
+// `<table>_<column>_seq` and starting at `start`, and points the column's
+// `DEFAULT` at it. Meant to be called from within `utils.UpdateCatalog`.
+func createIdentitySequence(
+	state *db.DBState,
+	catalog *db.Catalog,
+	tableName string,
+	column *db.Column,
+	start int64,
+) error {
+	sequenceName := tableName + "_" + column.Name + "_seq"
+	err := addSequence(state, catalog, sequenceName, start, 1)
+	if err != nil {
+		return err
+	}
+
+	column.Default = db.FunctionCall{
+		Name: "nextval",
+		Args: []db.Expression{db.Literal{Value: db.Value{
+			Value: sequenceName,
+			Type:  db.VarChar{Size: len(sequenceName)},
+		}}},
+	}
+	return nil
+}
+
+// Drops a sequence in its own change to the catalog, for cleaning up after an
+// identity column.
+func dropSequence(state *db.DBState, name string) error {
+	return utils.UpdateCatalog(state, func(catalog *db.Catalog) error {
+		return removeSequence(state, catalog, name)
+	})
+}
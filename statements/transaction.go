@@ -53,3 +53,73 @@ func (statement Commit) Execute(state *db.DBState) error {
 	fmt.Printf("Transaction committed.\n")
 	return nil
 }
+
+// Statements that modify a table call this before executing. If this process is
+// transacting, the table is locked and the statement is added to the
+// transaction to be executed on commit. Tables that the statement could
+// cascade to through foreign keys are locked as well. Returns true if the
+// caller should not execute the statement now, either because it was deferred
+// to the transaction or because another process' transaction has locked the
+// table.
+func deferToTransaction(
+	state *db.DBState,
+	tableName string,
+	statement db.Executable,
+	description string,
+) (bool, error) {
+	err := checkNotMaterializedView(state, tableName)
+	if err != nil {
+		return true, err
+	}
+
+	cascadeTables, err := referencingTables(state, tableName)
+	if err != nil {
+		return true, err
+	}
+	lockedTables := append([]string{tableName}, cascadeTables...)
+
+	if state.IsTransacting() {
+		// this process is transacting, add this statement to transaction
+		for _, lockedTable := range lockedTables {
+			lockFileName, err := state.AcquireTableLock(lockedTable)
+			if err != nil {
+				return true, err
+			}
+
+			if !containsString(state.Transaction.LockFiles, lockFileName) {
+				state.Transaction.LockFiles = append(
+					state.Transaction.LockFiles,
+					lockFileName,
+				)
+			}
+		}
+		state.Transaction.Statements = append(
+			state.Transaction.Statements,
+			statement,
+		)
+
+		fmt.Printf("Added %v to transaction.\n", description)
+
+		return true, nil
+	}
+
+	for _, lockedTable := range lockedTables {
+		if state.TableLockExists(lockedTable) {
+			// another process' transaction has locked the table, can't do
+			// anything
+			fmt.Printf("!Table %v is locked.\n", lockedTable)
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func containsString(list []string, target string) bool {
+	for _, item := range list {
+		if item == target {
+			return true
+		}
+	}
+	return false
+}
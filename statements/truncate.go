@@ -0,0 +1,54 @@
+// sdb/statements/truncate.go
+//
+// Contains logic for TRUNCATE statement.
+
+package statements
+
+import (
+	"fmt"
+	"sdb/db"
+	"sdb/utils"
+)
+
+type TruncateStatement struct {
+	TableName string
+}
+
+// Executes `TRUNCATE TABLE <table_name>;` queries. Removes every row from the
+// table, leaving its schema as it is.
+func (statement TruncateStatement) Execute(state *db.DBState) error {
+	deferred, err := deferToTransaction(
+		state, statement.TableName, statement, "truncate",
+	)
+	if deferred || err != nil {
+		return err
+	}
+
+	references, err := referencingForeignKeys(state, statement.TableName)
+	if err != nil {
+		return err
+	}
+	for _, reference := range references {
+		if reference.childTable != statement.TableName {
+			return fmt.Errorf(
+				"!Failed to truncate table %v because it is referenced by a "+
+					"foreign key of table %v.",
+				statement.TableName,
+				reference.childTable,
+			)
+		}
+	}
+
+	schema, err := utils.ReadTableSchema(state, statement.TableName)
+	if err != nil {
+		return fmt.Errorf("!Failed to truncate table %v because it does not exist.", statement.TableName)
+	}
+
+	err = utils.ReplaceTable(state, statement.TableName, schema, "")
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Table %v truncated.\n", statement.TableName)
+	return nil
+}
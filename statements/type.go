@@ -0,0 +1,124 @@
+// sdb/statements/type.go
+//
+// Contains logic for `CREATE TYPE` and `DROP TYPE` statements, and for looking
+// up the enum types used by the columns of new or altered tables.
+
+package statements
+
+import (
+	"fmt"
+	"sdb/db"
+	"sdb/utils"
+)
+
+type CreateTypeStatement struct {
+	TypeName string
+	Labels   []string
+}
+
+type DropTypeStatement struct {
+	TypeName string
+	IfExists bool
+}
+
+// Executes `CREATE TYPE <name> AS ENUM ('<label>', ...);` queries. The name
+// can't be that of a built-in type, and each label can only be given once.
+func (statement CreateTypeStatement) Execute(state *db.DBState) error {
+	if builtIn, _, err := utils.ParseType(statement.TypeName); err != nil || !isEnum(builtIn) {
+		return fmt.Errorf("!Type %v already exists.", statement.TypeName)
+	}
+
+	seen := make(map[string]bool)
+	for _, label := range statement.Labels {
+		if seen[label] {
+			return fmt.Errorf(
+				"!Label %v of enum type %v is given more than once.",
+				label,
+				statement.TypeName,
+			)
+		}
+		seen[label] = true
+	}
+
+	err := utils.UpdateCatalog(state, func(catalog *db.Catalog) error {
+		if _, exists := catalog.Types[statement.TypeName]; exists {
+			return fmt.Errorf("!Type %v already exists.", statement.TypeName)
+		}
+		catalog.Types[statement.TypeName] = db.Enum{
+			Name:   statement.TypeName,
+			Labels: statement.Labels,
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Type %v created.\n", statement.TypeName)
+	return nil
+}
+
+// Executes `DROP TYPE [IF EXISTS] <name>;` queries. Types used by a column of
+// any table, including this session's temporary tables, can't be dropped.
+func (statement DropTypeStatement) Execute(state *db.DBState) error {
+	catalog, err := utils.LoadCatalog(state)
+	if err != nil {
+		return err
+	}
+	if _, exists := catalog.Types[statement.TypeName]; statement.IfExists && !exists {
+		printSkipped("Type", statement.TypeName, false)
+		return nil
+	}
+
+	if temporary := state.TemporaryCatalog(); temporary != nil {
+		err := checkTypeUnused(temporary, statement.TypeName)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = utils.UpdateCatalog(state, func(catalog *db.Catalog) error {
+		if _, exists := catalog.Types[statement.TypeName]; !exists {
+			return fmt.Errorf(
+				"!Failed to delete type %v because it does not exist.",
+				statement.TypeName,
+			)
+		}
+
+		err := checkTypeUnused(catalog, statement.TypeName)
+		if err != nil {
+			return err
+		}
+
+		delete(catalog.Types, statement.TypeName)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Deleted type %v.\n", statement.TypeName)
+	return nil
+}
+
+// Checks that no column of the catalog's tables is of the named type.
+func checkTypeUnused(catalog *db.Catalog, typeName string) error {
+	for tableName, schema := range catalog.Tables {
+		for _, column := range schema.Columns {
+			if isEnum(column.Type) && column.Type.ToString() == typeName {
+				return fmt.Errorf(
+					"!Failed to delete type %v because it is used by column %v of table %v.",
+					typeName,
+					column.Name,
+					tableName,
+				)
+			}
+		}
+	}
+	return nil
+}
+
+func isEnum(t db.Type) bool {
+	_, ok := t.(db.Enum)
+	return ok
+}
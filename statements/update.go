@@ -11,40 +11,22 @@ import (
 	"os"
 	"sdb/db"
 	"sdb/utils"
-	"strings"
 )
 
 type UpdateStatement struct {
 	TableName    string
 	UpdatedCol   string
-	UpdatedValue *db.Value
+	UpdatedValue db.Expression
 	WhereClause  *WhereClause
+	Returning    *ReturningClause
 }
 
 func (statement UpdateStatement) Execute(state *db.DBState) error {
-	if state.IsTransacting() {
-		// this process is transacting, add this statement to transaction
-		lockFileName, err := state.AcquireTableLock(statement.TableName)
-		if err != nil {
-			return err
-		}
-
-		state.Transaction.LockFiles = append(
-			state.Transaction.LockFiles,
-			lockFileName,
-		)
-		state.Transaction.Statements = append(
-			state.Transaction.Statements,
-			statement,
-		)
-
-		fmt.Println("Added update to transaction.")
-
-		return nil
-	} else if state.TableLockExists(statement.TableName) {
-		// another process' transaction has locked the table, can't do anything
-		fmt.Printf("!Table %v is locked.\n", statement.TableName)
-		return nil
+	deferred, err := deferToTransaction(
+		state, statement.TableName, statement, "update",
+	)
+	if deferred || err != nil {
+		return err
 	}
 
 	tableFile, err := utils.OpenTable(state, statement.TableName, os.O_RDONLY)
@@ -54,18 +36,45 @@ func (statement UpdateStatement) Execute(state *db.DBState) error {
 	}
 	defer tableFile.Close()
 
-	reader := bufio.NewReader(tableFile)
-	tableHeader, err := reader.ReadString('\n')
+	schema, err := utils.ReadTableSchema(state, statement.TableName)
 	if err != nil {
-		return fmt.Errorf("!Failed to read from table file %v.", statement.TableName)
+		return err
 	}
+	tableColumns := schema.Columns
+	colNames := columnsToColMap(tableColumns)
 
-	colNames := utils.TableHeaderToColMap(tableHeader)
+	reader := bufio.NewReader(tableFile)
 
-	var replaceStringBuilder strings.Builder
-	replaceStringBuilder.WriteString(tableHeader)
+	colIdx, ok := colNames[statement.UpdatedCol]
+	if !ok {
+		return fmt.Errorf("!Column %v does not exist in table %v.", statement.UpdatedCol, statement.TableName)
+	}
+	if err = checkWhereColumns(statement.WhereClause, tableColumns); err != nil {
+		return err
+	}
+	statement.WhereClause, err = foldWhereCasts(statement.WhereClause)
+	if err != nil {
+		return err
+	}
+	if tableColumns[colIdx].Identity == db.GeneratedAlways {
+		return fmt.Errorf(
+			"!Cannot update column %v of table %v, it is GENERATED ALWAYS AS "+
+				"IDENTITY.",
+			statement.UpdatedCol,
+			statement.TableName,
+		)
+	}
+
+	for _, colName := range db.ReferencedColumns(statement.UpdatedValue) {
+		if _, ok := colNames[colName]; !ok {
+			return fmt.Errorf("!Column %v does not exist.", colName)
+		}
+	}
 
 	updated := 0
+	var updatedRows [][]db.Value
+	var allRows [][]db.Value
+	var changes []rowChange
 
 	for {
 		row, err := reader.ReadString('\n')
@@ -73,31 +82,69 @@ func (statement UpdateStatement) Execute(state *db.DBState) error {
 			break
 		}
 
-		rowValues, _, _ := utils.ParseValueList(row)
-		if whereApplies(statement.WhereClause, colNames, rowValues) {
-
-			rowValues[colNames[statement.UpdatedCol]] = *statement.UpdatedValue
-			updatedRowString := utils.ValueListToString(rowValues)
-			replaceStringBuilder.WriteString(updatedRowString)
+		rowValues, _ := utils.ParseRow(row, tableColumns)
+		allRows = append(allRows, rowValues)
+		applies, err := whereApplies(statement.WhereClause, colNames, rowValues)
+		if err != nil {
+			return err
+		}
+		if applies {
+			oldValues := append([]db.Value{}, rowValues...)
+
+			// the value is evaluated for each row, so every row gets its own
+			// `nextval`
+			expression, err := resolveSequenceCalls(state, statement.UpdatedValue)
+			if err != nil {
+				return err
+			}
+			value, err := expression.Evaluate(colNames, oldValues)
+			if err != nil {
+				return err
+			}
+			rowValues[colIdx], err = assignValue(*value, expression, tableColumns[colIdx])
+			if err != nil {
+				return err
+			}
+			err = checkConstraints(statement.TableName, tableColumns, rowValues)
+			if err != nil {
+				return err
+			}
+
+			updatedRows = append(updatedRows, rowValues)
+			changes = append(changes, rowChange{Old: oldValues, New: rowValues})
 
 			updated += 1
-		} else {
-			replaceStringBuilder.WriteString(row)
 		}
 	}
 
-	// need to close file before reopening to truncate
-	tableFile.Close()
-	tableFile, err = utils.OpenTable(state, statement.TableName, os.O_WRONLY|os.O_TRUNC)
-	if err != nil {
-		return err
-	}
-	defer tableFile.Close()
+	if updated > 0 {
+		err = checkKeys(statement.TableName, schema, allRows)
+		if err != nil {
+			return err
+		}
 
-	replacedTable := replaceStringBuilder.String()
-	tableFile.WriteString(replacedTable)
+		err = checkForeignKeys(
+			state, statement.TableName, schema, updatedRows, allRows,
+		)
+		if err != nil {
+			return err
+		}
+
+		// apply ON UPDATE actions of foreign keys referencing this table, then
+		// write this table along with any tables the update cascaded to
+		cascade := newCascade(state)
+		cascade.set(statement.TableName, schema, allRows)
+		err = cascade.propagate(statement.TableName, changes, 0)
+		if err != nil {
+			return err
+		}
+		err = cascade.write()
+		if err != nil {
+			return err
+		}
+	}
 
 	fmt.Printf("Updated %v rows.\n", updated)
 
-	return nil
+	return printReturning(statement.Returning, tableColumns, updatedRows)
 }
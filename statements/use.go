@@ -8,13 +8,15 @@ import (
 	"fmt"
 	"os"
 	"sdb/db"
+	"sdb/utils"
 )
 
 type UseDBStatement struct {
 	DBName string
 }
 
-// Executes `USE <db_name>;` queries. Changes the current DB in DBState.
+// Executes `USE <db_name>;` queries. Changes the current DB in DBState, and
+// loads its catalog, first building one for databases that don't have one.
 func (statement UseDBStatement) Execute(state *db.DBState) error {
 	_, err := os.Stat(statement.DBName)
 
@@ -22,7 +24,22 @@ func (statement UseDBStatement) Execute(state *db.DBState) error {
 		return fmt.Errorf("!Failed to delete %v because it does not exist.", statement.DBName)
 	}
 
+	_, err = os.Stat(utils.CatalogPath(statement.DBName))
+	if os.IsNotExist(err) {
+		err = utils.MigrateDatabase(statement.DBName)
+		if err != nil {
+			return err
+		}
+	}
+
+	previousDB := state.CurrentDB
 	state.CurrentDB = statement.DBName
+	_, err = utils.LoadCatalog(state)
+	if err != nil {
+		state.CurrentDB = previousDB
+		return err
+	}
+
 	fmt.Printf("Using database %v.\n", statement.DBName)
 	return nil
 }
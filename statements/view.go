@@ -0,0 +1,401 @@
+// sdb/statements/view.go
+//
+// Contains logic for `CREATE VIEW` and `DROP VIEW` statements. Each view is
+// stored in the catalog as the text of its `SELECT` query, which is parsed and
+// run again whenever the view is selected from, so views always reflect the
+// current contents of their tables.
+
+package statements
+
+import (
+	"fmt"
+	"sdb/db"
+	"sdb/utils"
+	"sort"
+	"strings"
+)
+
+// Views of views are cut off at this depth.
+const maxViewDepth = 32
+
+// Parses the stored query of a view. Set by the parser package, which depends
+// on this one.
+var ParseViewQuery func(query string) (SelectStatement, error)
+
+type CreateViewStatement struct {
+	ViewName    string
+	OrReplace   bool
+	IfNotExists bool
+	Query       string
+	Select      SelectStatement
+}
+
+type DropViewStatement struct {
+	ViewName string
+	IfExists bool
+}
+
+// Executes `CREATE [OR REPLACE] VIEW [IF NOT EXISTS] <view_name> AS SELECT ...;`
+// queries.
+func (statement CreateViewStatement) Execute(state *db.DBState) error {
+	if statement.IfNotExists && viewExists(state, statement.ViewName) {
+		printSkipped("View", statement.ViewName, true)
+		return nil
+	}
+
+	if _, exists := utils.TableExists(state, statement.ViewName); exists {
+		return fmt.Errorf(
+			"!Failed to create view %v because table %v already exists.",
+			statement.ViewName,
+			statement.ViewName,
+		)
+	}
+
+	replacing := viewExists(state, statement.ViewName)
+	if replacing && !statement.OrReplace {
+		return fmt.Errorf(
+			"!Failed to create view %v because it already exists.",
+			statement.ViewName,
+		)
+	}
+
+	selfReferencing, err := selectDependsOn(state, statement.Select, statement.ViewName, 0)
+	if err != nil {
+		return err
+	}
+	if selfReferencing {
+		return fmt.Errorf("!View %v can't select from itself.", statement.ViewName)
+	}
+	err = checkNoTemporaryTables(state, statement.ViewName, statement.Select)
+	if err != nil {
+		return err
+	}
+
+	// running the query checks that everything it selects from exists
+	columns, _, err := statement.Select.query(state, 1)
+	if err != nil {
+		return err
+	}
+
+	// views selecting from the view being replaced must still find their
+	// columns in it
+	if replacing {
+		dependents, err := viewDependents(state, statement.ViewName)
+		if err != nil {
+			return err
+		}
+		colMap := columnsToColMap(columns)
+		for _, dependent := range dependents {
+			for _, colName := range dependent.query.usedColumns(statement.ViewName) {
+				if _, ok := colMap[colName]; !ok && colName != "*" {
+					return fmt.Errorf(
+						"!Failed to replace view %v because view %v uses "+
+							"column %v.",
+						statement.ViewName,
+						dependent.name,
+						colName,
+					)
+				}
+			}
+		}
+	}
+
+	err = utils.UpdateCatalog(state, func(catalog *db.Catalog) error {
+		if _, exists := catalog.Tables[statement.ViewName]; exists {
+			return fmt.Errorf(
+				"!Failed to create view %v because table %v already exists.",
+				statement.ViewName,
+				statement.ViewName,
+			)
+		}
+		if _, exists := catalog.Views[statement.ViewName]; exists && !statement.OrReplace {
+			return fmt.Errorf(
+				"!Failed to create view %v because it already exists.",
+				statement.ViewName,
+			)
+		}
+
+		catalog.Views[statement.ViewName] = db.ViewDefinition{Query: statement.Query}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if replacing {
+		fmt.Printf("View %v replaced.\n", statement.ViewName)
+	} else {
+		fmt.Printf("View %v created.\n", statement.ViewName)
+	}
+	return nil
+}
+
+// Executes `DROP VIEW [IF EXISTS] <view_name>;` queries. Views that other views
+// select from can't be dropped.
+func (statement DropViewStatement) Execute(state *db.DBState) error {
+	if statement.IfExists && !viewExists(state, statement.ViewName) {
+		printSkipped("View", statement.ViewName, false)
+		return nil
+	}
+
+	if !viewExists(state, statement.ViewName) {
+		return fmt.Errorf(
+			"!Failed to delete view %v because it does not exist.",
+			statement.ViewName,
+		)
+	}
+
+	dependent, err := findDependentView(state, statement.ViewName, "")
+	if err != nil {
+		return err
+	}
+	if dependent != "" {
+		return fmt.Errorf(
+			"!Failed to delete view %v because view %v depends on it.",
+			statement.ViewName,
+			dependent,
+		)
+	}
+
+	err = utils.UpdateCatalog(state, func(catalog *db.Catalog) error {
+		delete(catalog.Views, statement.ViewName)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Deleted view %v.\n", statement.ViewName)
+	return nil
+}
+
+// Looks up a view in the catalog. Materialized views are only found if
+// `materialized` is set, and ordinary views only if it isn't.
+func lookupView(state *db.DBState, viewName string, materialized bool) (string, bool) {
+	catalog, err := utils.LoadCatalog(state)
+	if err != nil {
+		return "", false
+	}
+	view, ok := catalog.Views[viewName]
+	if !ok || view.Materialized != materialized {
+		return "", false
+	}
+	return view.Query, true
+}
+
+func viewExists(state *db.DBState, viewName string) bool {
+	_, exists := lookupView(state, viewName, false)
+	return exists
+}
+
+// Reads and parses the query of a view.
+func readView(state *db.DBState, viewName string) (*SelectStatement, error) {
+	query, exists := lookupView(state, viewName, false)
+	if !exists {
+		return nil, fmt.Errorf("!View %v does not exist.", viewName)
+	}
+	return parseView(viewName, query)
+}
+
+// Parses the stored query of a view or materialized view.
+func parseView(viewName string, query string) (*SelectStatement, error) {
+	parsed, err := ParseViewQuery(query)
+	if err != nil {
+		return nil, fmt.Errorf("!View %v is corrupt: %v", viewName, err)
+	}
+	return &parsed, nil
+}
+
+// Views are shared by every session, so they can't select from this session's
+// temporary tables.
+func checkNoTemporaryTables(state *db.DBState, viewName string, query SelectStatement) error {
+	for _, name := range query.relations() {
+		if state.IsTemporaryTable(name) {
+			return fmt.Errorf(
+				"!View %v can't select from temporary table %v.", viewName, name,
+			)
+		}
+	}
+	return nil
+}
+
+// Runs the query of a view. `depth` is the number of views being queried
+// through, which stops views that select from each other from looping.
+func queryView(
+	state *db.DBState,
+	viewName string,
+	depth int,
+) ([]db.Column, [][]db.Value, error) {
+	if depth > maxViewDepth {
+		return nil, nil, fmt.Errorf("!View %v is nested too deeply.", viewName)
+	}
+
+	query, err := readView(state, viewName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	columns, rows, err := query.query(state, depth)
+	if err != nil {
+		return nil, nil, fmt.Errorf(
+			"!Failed to select from view %v: %v",
+			viewName,
+			strings.TrimPrefix(err.Error(), "!"),
+		)
+	}
+	return columns, rows, nil
+}
+
+// Finds the names of every view in the current database, or of every
+// materialized view if `materialized` is set, ordered by name.
+func listViews(state *db.DBState, materialized bool) ([]string, error) {
+	catalog, err := utils.LoadCatalog(state)
+	if err != nil {
+		return nil, err
+	}
+
+	var viewNames []string
+	for viewName, view := range catalog.Views {
+		if view.Materialized == materialized {
+			viewNames = append(viewNames, viewName)
+		}
+	}
+	sort.Strings(viewNames)
+
+	return viewNames, nil
+}
+
+// A view or materialized view that selects from some table or view.
+type dependentView struct {
+	name  string
+	query *SelectStatement
+}
+
+// Finds every view and materialized view whose query selects directly from
+// `relationName`.
+func viewDependents(state *db.DBState, relationName string) ([]dependentView, error) {
+	var dependents []dependentView
+	for _, materialized := range []bool{false, true} {
+		viewNames, err := listViews(state, materialized)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, viewName := range viewNames {
+			text, _ := lookupView(state, viewName, materialized)
+			query, err := parseView(viewName, text)
+			if err != nil {
+				return nil, err
+			}
+			if containsString(query.relations(), relationName) {
+				dependents = append(dependents, dependentView{name: viewName, query: query})
+			}
+		}
+	}
+
+	return dependents, nil
+}
+
+// Finds a view that depends on `relationName`, or "" if there isn't one. If
+// `colName` is given, only views that use that column count.
+func findDependentView(state *db.DBState, relationName string, colName string) (string, error) {
+	// views can't select from temporary tables, so a view naming one means the
+	// permanent table it hides
+	if state.IsTemporaryTable(relationName) {
+		return "", nil
+	}
+
+	dependents, err := viewDependents(state, relationName)
+	if err != nil {
+		return "", err
+	}
+
+	for _, dependent := range dependents {
+		usedColumns := dependent.query.usedColumns(relationName)
+		if colName == "" || containsString(usedColumns, colName) ||
+			containsString(usedColumns, "*") {
+			return dependent.name, nil
+		}
+	}
+
+	return "", nil
+}
+
+// Determines if a query selects from `relationName`, directly or through other
+// views.
+func selectDependsOn(
+	state *db.DBState,
+	query SelectStatement,
+	relationName string,
+	depth int,
+) (bool, error) {
+	if depth > maxViewDepth {
+		return false, fmt.Errorf("!View %v is nested too deeply.", relationName)
+	}
+
+	for _, name := range query.relations() {
+		if name == relationName {
+			return true, nil
+		}
+		if !viewExists(state, name) {
+			continue
+		}
+
+		viewQuery, err := readView(state, name)
+		if err != nil {
+			return false, err
+		}
+		depends, err := selectDependsOn(state, *viewQuery, relationName, depth+1)
+		if err != nil || depends {
+			return depends, err
+		}
+	}
+
+	return false, nil
+}
+
+// Gets the names of the tables and views a query selects from.
+func (statement SelectStatement) relations() []string {
+	var names []string
+	if statement.TableName != "" {
+		names = append(names, statement.TableName)
+	}
+	if statement.JoinClause != nil {
+		names = append(names, statement.JoinClause.RightTable)
+	}
+	return names
+}
+
+// Gets the columns of `relationName` that a query refers to. Column names
+// aren't qualified by their table, so columns selected from a join count as
+// used in both tables. Selecting `*` uses every column.
+func (statement SelectStatement) usedColumns(relationName string) []string {
+	if !containsString(statement.relations(), relationName) {
+		return nil
+	}
+
+	var colNames []string
+	if statement.AllColumns {
+		colNames = append(colNames, "*")
+	}
+	for _, selected := range statement.Columns {
+		colNames = append(colNames, db.ReferencedColumns(selected.Expression)...)
+	}
+	if where := statement.WhereClause; where != nil && where.Condition != nil {
+		colNames = append(colNames, db.ReferencedColumns(where.Condition)...)
+	} else if where != nil {
+		colNames = append(colNames, where.ColName)
+	}
+
+	join := statement.JoinClause
+	if join != nil {
+		if statement.TableName == relationName {
+			colNames = append(colNames, join.LeftTableColumn)
+		}
+		if join.RightTable == relationName {
+			colNames = append(colNames, join.RightTableColumn)
+		}
+	}
+
+	return colNames
+}
@@ -6,37 +6,210 @@
 
 package statements
 
-import "sdb/db"
+import (
+	"fmt"
+	"sdb/db"
+)
 
+// A WHERE clause comparing a column with a value, like `WHERE id = 3`, which
+// can be answered with an index, or any other condition, like `WHERE payload
+// ->> 'status' = 'done'`, kept as `Condition` with the other fields unset.
 type WhereClause struct {
 	ColName         string
 	Comparison      string
 	ComparisonValue *db.Value
+	Condition       db.Expression
 }
 
-// Determines if `where` clause applies to row
-func whereApplies(where *WhereClause, colNames map[string]int, row []db.Value) bool {
+// Makes the WHERE clause for a condition. Comparisons of a column with a value,
+// like `id = 3`, are kept as column comparisons that can be answered with an
+// index, while any other condition is kept as an expression.
+func NewWhereClause(condition db.Expression) *WhereClause {
+	if comparison, ok := condition.(db.ComparisonExpression); ok {
+		ref, isColumn := comparison.Left.(db.ColumnRef)
+		literal, isLiteral := comparison.Right.(db.Literal)
+		if isColumn && isLiteral {
+			return &WhereClause{
+				ColName:         ref.Name,
+				Comparison:      comparison.Operator,
+				ComparisonValue: &literal.Value,
+			}
+		}
+	}
+
+	return &WhereClause{Condition: condition}
+}
+
+// Makes `WHERE <column>` and `WHERE NOT <column>` a comparison of the column
+// with TRUE or FALSE, which can be answered with an index. Returns nil for any
+// other condition. The column must already be known to be a boolean, see
+// `checkWhereColumns`.
+func booleanColumnWhere(condition db.Expression) *WhereClause {
+	negated := false
+	if not, ok := condition.(db.NotExpression); ok {
+		if _, isColumn := not.Operand.(db.ColumnRef); isColumn {
+			condition, negated = not.Operand, true
+		}
+	}
+	ref, ok := condition.(db.ColumnRef)
+	if !ok {
+		return nil
+	}
+	value := db.BoolValue(!negated)
+	return &WhereClause{
+		ColName:         ref.Name,
+		Comparison:      "=",
+		ComparisonValue: &value,
+	}
+}
+
+// Evaluates the casts of constants in a WHERE condition, like `'5'::int`, once
+// before any rows are read. An invalid cast then fails even if there are no
+// rows to filter, and a column compared with a cast constant can still be
+// looked up in an index, as can a boolean column tested on its own.
+func foldWhereCasts(where *WhereClause) (*WhereClause, error) {
+	if where == nil || where.Condition == nil {
+		return where, nil
+	}
+	if shorthand := booleanColumnWhere(where.Condition); shorthand != nil {
+		return shorthand, nil
+	}
+
+	condition, err := db.MapExpression(where.Condition, func(e db.Expression) (db.Expression, error) {
+		cast, ok := e.(db.CastExpression)
+		if !ok || !isConstant(cast.Operand) {
+			return e, nil
+		}
+		value, err := cast.Evaluate(map[string]int{}, []db.Value{})
+		if err != nil {
+			return nil, err
+		}
+		return db.Literal{Value: *value}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return NewWhereClause(condition), nil
+}
+
+// Determines if an expression has the same value for every row. Function calls
+// don't, since `nextval` and `now` change.
+func isConstant(expression db.Expression) bool {
+	constant := true
+	db.MapExpression(expression, func(e db.Expression) (db.Expression, error) {
+		switch e.(type) {
+		case db.ColumnRef, db.FunctionCall, db.AggregateCall:
+			constant = false
+		}
+		return e, nil
+	})
+	return constant
+}
+
+// Determines if `where` clause applies to row. Fails if the clause can't be
+// evaluated for the row, like a cast of a value that isn't valid for the type
+// or a comparison of values of different kinds.
+func whereApplies(where *WhereClause, colNames map[string]int, row []db.Value) (bool, error) {
 	if where == nil {
-		return true
+		return true, nil
+	}
+	if where.Condition != nil {
+		value, err := where.Condition.Evaluate(colNames, row)
+		if err != nil {
+			return false, err
+		}
+		if err = db.CheckBoolean(value, "WHERE"); err != nil {
+			return false, err
+		}
+		return db.IsTrue(value), nil
 	}
 	colIndex := colNames[where.ColName]
 
 	rowValue := row[colIndex]
 
-	// FIXME might want to check if types match before comparison
+	// comparisons against NULL are never true
+	if rowValue.GetValue() == nil || where.ComparisonValue.GetValue() == nil {
+		return false, nil
+	}
+
+	comparison, err := db.CompareValues(&rowValue, where.ComparisonValue)
+	if err != nil {
+		return false, err
+	}
+
 	if where.Comparison == "=" {
-		return rowValue.GetValue() == where.ComparisonValue.GetValue()
+		return comparison == 0, nil
 	} else if where.Comparison == "!=" {
-		return rowValue.GetValue() != where.ComparisonValue.GetValue()
-	} else if where.Comparison == "<" { // assuming numerical types for less/greater than
-		return rowValue.GetValue().(float64) < where.ComparisonValue.GetValue().(float64)
+		return comparison != 0, nil
+	} else if where.Comparison == "<" {
+		return comparison < 0, nil
 	} else if where.Comparison == "<=" {
-		return rowValue.GetValue().(float64) <= where.ComparisonValue.GetValue().(float64)
+		return comparison <= 0, nil
 	} else if where.Comparison == ">" {
-		return rowValue.GetValue().(float64) > where.ComparisonValue.GetValue().(float64)
+		return comparison > 0, nil
 	} else if where.Comparison == ">=" {
-		return rowValue.GetValue().(float64) >= where.ComparisonValue.GetValue().(float64)
+		return comparison >= 0, nil
+	}
+
+	return false, nil
+}
+
+// Checks that the columns a WHERE condition refers to exist and that the
+// condition is a boolean, so a misspelled column or a condition like `WHERE id`
+// on an int column is reported even if the table has no rows to evaluate it
+// for.
+func checkWhereColumns(where *WhereClause, columns []db.Column) error {
+	if where == nil {
+		return nil
+	}
+	colNames := columnsToColMap(columns)
+	referenced := []string{where.ColName}
+	if where.Condition != nil {
+		referenced = db.ReferencedColumns(where.Condition)
+	}
+	for _, colName := range referenced {
+		if _, ok := colNames[colName]; !ok {
+			return fmt.Errorf("!Column %v does not exist.", colName)
+		}
+	}
+	if where.Condition == nil {
+		return nil
+	}
+	return checkBooleanType(where.Condition, columns, "WHERE")
+}
+
+// Checks that a condition and the operands of its `and`, `or` and `not` are
+// booleans. A condition whose type is only known once it's evaluated, like a
+// function call, is checked for each row instead, see `db.CheckBoolean`.
+func checkBooleanType(condition db.Expression, columns []db.Column, usedBy string) error {
+	switch expression := condition.(type) {
+	case db.NotExpression:
+		return checkBooleanType(expression.Operand, columns, "not")
+	case db.LogicalExpression:
+		err := checkBooleanType(expression.Left, columns, expression.Operator)
+		if err != nil {
+			return err
+		}
+		return checkBooleanType(expression.Right, columns, expression.Operator)
 	}
 
-	return false
+	switch conditionType := condition.TypeOf(columns).(type) {
+	case db.Boolean, db.Null:
+		return nil
+	default:
+		return fmt.Errorf(
+			"!Argument of %v must be a boolean, not %v.", usedBy, conditionType.ToString(),
+		)
+	}
+}
+
+// Determines if two values are equal the way `=` compares them, so e.g.
+// decimals are equal by value and dates equal timestamps at midnight. NULL is
+// never equal to anything.
+func valuesEqual(left db.Value, right db.Value) bool {
+	if left.GetValue() == nil || right.GetValue() == nil {
+		return false
+	}
+	comparison, err := db.CompareValues(&left, &right)
+	return err == nil && comparison == 0
 }
@@ -0,0 +1,393 @@
+// sdb/utils/catalog.go
+//
+// Functions for reading and writing the catalog file of a database. The first
+// line of the file gives the version of its format, and the second the number
+// of changes made to the catalog. Every following line defines one type,
+// table, view or sequence:
+//
+// 		type <name> enum <labels, see `ValueListToString`>
+// 		table <name> <columns and constraints, see `TableDefinitionToString`>
+// 		view <name> <select query>
+// 		materialized view <name> <select query>
+// 		sequence <name> <start> <increment>
+//
+// Changes are made while holding a lock file, and written to a temporary file
+// that is renamed over the catalog, so the catalog is never seen half written.
+
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sdb/db"
+	"sort"
+	"strings"
+)
+
+func CatalogPath(dbName string) string {
+	return dbName + "/.catalog"
+}
+
+// Writes the catalog of a new, empty database.
+func CreateCatalog(dbName string) error {
+	return writeCatalog(db.NewCatalog(dbName))
+}
+
+// Gets the catalog of the current database, reading it again only if the
+// catalog file has changed since it was last read.
+func LoadCatalog(state *db.DBState) (*db.Catalog, error) {
+	if state.CurrentDB == "" {
+		return nil, errors.New("!No database selected.")
+	}
+
+	info, err := os.Stat(CatalogPath(state.CurrentDB))
+	if err != nil {
+		return nil, fmt.Errorf("!Failed to read catalog of database %v.", state.CurrentDB)
+	}
+	if catalog := state.CachedCatalog(); catalog != nil && catalog.Matches(info) {
+		return catalog, nil
+	}
+
+	catalog, err := readCatalog(state.CurrentDB)
+	if err != nil {
+		return nil, err
+	}
+	state.Catalog = catalog
+	return catalog, nil
+}
+
+// Changes the catalog of the current database. `update` is given the latest
+// catalog to change, and nothing is written if it returns an error. Other
+// processes can't change the catalog until `update` returns, so `update` must
+// not call `UpdateCatalog` itself.
+func UpdateCatalog(state *db.DBState, update func(*db.Catalog) error) error {
+	if state.CurrentDB == "" {
+		return errors.New("!No database selected.")
+	}
+
+	unlock, err := db.LockFile(CatalogPath(state.CurrentDB) + "_lock")
+	if err == db.ErrLocked {
+		return fmt.Errorf("!Catalog of database %v is locked.", state.CurrentDB)
+	} else if err != nil {
+		return fmt.Errorf("!Failed to lock catalog of database %v: %v", state.CurrentDB, err)
+	}
+	defer unlock()
+
+	catalog, err := readCatalog(state.CurrentDB)
+	if err != nil {
+		return err
+	}
+
+	err = update(catalog)
+	if err != nil {
+		return err
+	}
+
+	catalog.Version++
+	err = writeCatalog(catalog)
+	if err != nil {
+		return err
+	}
+	state.Catalog = catalog
+	return nil
+}
+
+func readCatalog(dbName string) (*db.Catalog, error) {
+	file, err := os.Open(CatalogPath(dbName))
+	if err != nil {
+		return nil, fmt.Errorf("!Failed to read catalog of database %v.", dbName)
+	}
+	defer file.Close()
+
+	// the catalog file is only ever replaced, never changed in place, so this
+	// matches the contents read
+	info, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("!Failed to read catalog of database %v.", dbName)
+	}
+	contents, err := ioutil.ReadAll(file)
+	if err != nil {
+		return nil, fmt.Errorf("!Failed to read catalog of database %v.", dbName)
+	}
+
+	catalog, err := parseCatalog(dbName, string(contents))
+	if err != nil {
+		return nil, err
+	}
+	catalog.Stamp(info)
+	return catalog, nil
+}
+
+func parseCatalog(dbName string, contents string) (*db.Catalog, error) {
+	corrupt := fmt.Errorf("!Catalog of database %v is corrupt.", dbName)
+	catalog := db.NewCatalog(dbName)
+
+	lines := strings.Split(contents, "\n")
+	var formatVersion int
+	_, err := fmt.Sscanf(lines[0], "sdb catalog %d", &formatVersion)
+	if err != nil {
+		return nil, corrupt
+	}
+	if formatVersion != db.CatalogFormatVersion {
+		return nil, fmt.Errorf(
+			"!Catalog of database %v has unsupported format version %v.",
+			dbName,
+			formatVersion,
+		)
+	}
+	if len(lines) < 2 {
+		return nil, corrupt
+	}
+	_, err = fmt.Sscanf(lines[1], "version %d", &catalog.Version)
+	if err != nil {
+		return nil, corrupt
+	}
+
+	for _, line := range lines[2:] {
+		if line == "" {
+			continue
+		}
+
+		trimmed, materialized := HasKeyword(line, "materialized")
+		kind := ParseIdentifier(trimmed)
+		trimmed, _ = HasPrefix(trimmed, kind)
+		name := ParseIdentifier(trimmed)
+		trimmed, _ = HasPrefix(trimmed, name)
+		if name == "" || materialized && kind != "view" {
+			return nil, corrupt
+		}
+
+		switch kind {
+		case "type":
+			trimmed, ok := HasKeyword(trimmed, "enum")
+			labels, rest, err := ParseValueList(trimmed)
+			if !ok || err != nil || rest != "" {
+				return nil, corrupt
+			}
+			enum := db.Enum{Name: name}
+			for _, label := range labels {
+				enum.Labels = append(enum.Labels, label.Value.(string))
+			}
+			catalog.Types[name] = enum
+		case "table":
+			schema, _, err := ParseTableDefinition(trimmed)
+			if err != nil {
+				return nil, corrupt
+			}
+			catalog.Tables[name] = schema
+		case "view":
+			catalog.Views[name] = db.ViewDefinition{
+				Query:        trimmed,
+				Materialized: materialized,
+			}
+		case "sequence":
+			var sequence db.SequenceDefinition
+			_, err := fmt.Sscanf(trimmed, "%d %d", &sequence.Start, &sequence.Increment)
+			if err != nil {
+				return nil, corrupt
+			}
+			catalog.Sequences[name] = sequence
+		default:
+			return nil, corrupt
+		}
+	}
+
+	for _, schema := range catalog.Tables {
+		if catalog.ResolveColumnTypes(schema.Columns) != nil {
+			return nil, corrupt
+		}
+	}
+
+	return catalog, nil
+}
+
+func formatCatalog(catalog *db.Catalog) string {
+	var catalogBuilder strings.Builder
+	fmt.Fprintf(&catalogBuilder, "sdb catalog %v\n", db.CatalogFormatVersion)
+	fmt.Fprintf(&catalogBuilder, "version %v\n", catalog.Version)
+
+	for _, name := range sortedNames(catalog.Types) {
+		var labels []db.Value
+		for _, label := range catalog.Types[name].Labels {
+			labels = append(labels, db.Value{Value: label, Type: db.Text{}})
+		}
+		// the list of labels ends the line
+		fmt.Fprintf(&catalogBuilder, "type %v enum %v", name, ValueListToString(labels))
+	}
+	for _, name := range sortedNames(catalog.Tables) {
+		fmt.Fprintf(
+			&catalogBuilder,
+			"table %v %v\n",
+			name,
+			TableDefinitionToString(catalog.Tables[name]),
+		)
+	}
+	for _, name := range sortedNames(catalog.Views) {
+		view := catalog.Views[name]
+		if view.Materialized {
+			catalogBuilder.WriteString("materialized ")
+		}
+		// queries can span several lines, but each entry must fit on one
+		query := strings.NewReplacer("\r\n", " ", "\n", " ", "\r", " ").Replace(view.Query)
+		fmt.Fprintf(&catalogBuilder, "view %v %v\n", name, query)
+	}
+	for _, name := range sortedNames(catalog.Sequences) {
+		sequence := catalog.Sequences[name]
+		fmt.Fprintf(
+			&catalogBuilder,
+			"sequence %v %v %v\n",
+			name,
+			sequence.Start,
+			sequence.Increment,
+		)
+	}
+
+	return catalogBuilder.String()
+}
+
+// Writes the catalog to a temporary file and renames it over the catalog file.
+func writeCatalog(catalog *db.Catalog) error {
+	failed := func(err error) error {
+		return fmt.Errorf("!Failed to write catalog of database %v: %v", catalog.Database, err)
+	}
+
+	tempFile, err := ioutil.TempFile(catalog.Database, ".catalog_tmp")
+	if err != nil {
+		return failed(err)
+	}
+	_, err = tempFile.WriteString(formatCatalog(catalog))
+	if err == nil {
+		err = tempFile.Sync()
+	}
+	closeErr := tempFile.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tempFile.Name(), CatalogPath(catalog.Database))
+	}
+	if err != nil {
+		os.Remove(tempFile.Name())
+		return failed(err)
+	}
+
+	info, err := os.Stat(CatalogPath(catalog.Database))
+	if err != nil {
+		return failed(err)
+	}
+	catalog.Stamp(info)
+	return nil
+}
+
+// Gets the keys of one of the catalog's maps in order.
+func sortedNames(entries interface{}) []string {
+	var names []string
+	switch entries := entries.(type) {
+	case map[string]*db.TableSchema:
+		for name := range entries {
+			names = append(names, name)
+		}
+	case map[string]db.ViewDefinition:
+		for name := range entries {
+			names = append(names, name)
+		}
+	case map[string]db.SequenceDefinition:
+		for name := range entries {
+			names = append(names, name)
+		}
+	case map[string]db.Enum:
+		for name := range entries {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Builds the catalog of a database created before databases had catalogs,
+// whose table files start with a header line holding the table's schema. The
+// headers are removed from the table files.
+func MigrateDatabase(dbName string) error {
+	unlock, err := db.LockFile(CatalogPath(dbName) + "_lock")
+	if err == db.ErrLocked {
+		return fmt.Errorf("!Catalog of database %v is locked.", dbName)
+	} else if err != nil {
+		return fmt.Errorf("!Failed to lock catalog of database %v: %v", dbName, err)
+	}
+	defer unlock()
+
+	// another process may have migrated the database first
+	if _, err := os.Stat(CatalogPath(dbName)); err == nil {
+		return nil
+	}
+
+	entries, err := ioutil.ReadDir(dbName)
+	if err != nil {
+		return fmt.Errorf("!Failed to read database %v.", dbName)
+	}
+
+	catalog := db.NewCatalog(dbName)
+	tempPaths := make(map[string]string)
+	cleanUp := func() {
+		for _, tempPath := range tempPaths {
+			os.Remove(tempPath)
+		}
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		path := dbName + "/" + name
+		// hidden files are the lock files of tables
+		if entry.IsDir() || strings.HasPrefix(name, ".") {
+			continue
+		}
+
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			cleanUp()
+			return fmt.Errorf("!Failed to read table %v: %v", name, err)
+		}
+		parts := strings.SplitN(string(contents), "\n", 2)
+		schema, _, err := ParseTableDefinition(parts[0])
+		if err != nil {
+			cleanUp()
+			return err
+		}
+		catalog.Tables[name] = schema
+
+		rows := ""
+		if len(parts) > 1 {
+			rows = parts[1]
+		}
+		tempFile, err := ioutil.TempFile(dbName, "."+name+"_tmp")
+		if err == nil {
+			tempPaths[name] = tempFile.Name()
+			// the table keeps its permissions, see `ReplaceTable`
+			err = tempFile.Chmod(entry.Mode())
+			if err == nil {
+				_, err = tempFile.WriteString(rows)
+			}
+			closeErr := tempFile.Close()
+			if err == nil {
+				err = closeErr
+			}
+		}
+		if err != nil {
+			cleanUp()
+			return fmt.Errorf("!Failed to rewrite table %v: %v", name, err)
+		}
+	}
+
+	err = writeCatalog(catalog)
+	if err != nil {
+		cleanUp()
+		return err
+	}
+
+	for tableName, tempPath := range tempPaths {
+		os.Rename(tempPath, dbName+"/"+tableName)
+	}
+	return nil
+}
@@ -0,0 +1,476 @@
+// sdb/utils/expression.go
+//
+// Parsing functions for expressions, e.g. `price * 1.1` in
+// `UPDATE ... RETURNING price * 1.1`. Like the statement parsers, each
+// function consumes a prefix of its input and returns the remaining input,
+// so callers can continue parsing after the expression. Precedence from
+// loosest to tightest is: `or`, `and`, `not`, comparisons, `is [not] null` and
+// `?`, `+ -`, `* /`, unary `-`, the JSON operators `->` and `->>`, `::` casts,
+// then literals, column names, function calls and parenthesized expressions.
+
+package utils
+
+import (
+	"fmt"
+	"sdb/db"
+	"strings"
+	"unicode"
+)
+
+// Checks if input begins with the keyword `keyword` as a whole word, so that
+// e.g. `and` does not match the start of the column name `android`. Returns
+// the input with the keyword trimmed, like `HasPrefix`.
+func HasKeyword(input string, keyword string) (string, bool) {
+	if !strings.HasPrefix(input, keyword) {
+		return input, false
+	}
+
+	rest := strings.TrimPrefix(input, keyword)
+	if len(rest) > 0 {
+		next := rune(rest[0])
+		if unicode.IsLetter(next) || unicode.IsNumber(next) || next == '_' {
+			return input, false
+		}
+	}
+
+	return strings.TrimSpace(rest), true
+}
+
+// Parses a single expression from the start of input. Returns the expression
+// and the remaining unparsed input.
+func ParseExpression(input string) (db.Expression, string, error) {
+	return parseOr(strings.TrimSpace(input))
+}
+
+// Parses a comma separated list of expressions, e.g. `id, price * 2`.
+func ParseExpressionList(input string) ([]db.Expression, string, error) {
+	var expressions []db.Expression
+
+	trimmed := input
+	var ok bool
+	for {
+		expression, rest, err := ParseExpression(trimmed)
+		if err != nil {
+			return nil, input, err
+		}
+		expressions = append(expressions, expression)
+
+		trimmed, ok = HasPrefix(rest, ",")
+		if !ok {
+			return expressions, rest, nil
+		}
+	}
+}
+
+func parseOr(input string) (db.Expression, string, error) {
+	left, trimmed, err := parseAnd(input)
+	if err != nil {
+		return nil, input, err
+	}
+
+	for {
+		var ok bool
+		trimmed, ok = HasKeyword(trimmed, "or")
+		if !ok {
+			return left, trimmed, nil
+		}
+
+		var right db.Expression
+		right, trimmed, err = parseAnd(trimmed)
+		if err != nil {
+			return nil, input, err
+		}
+
+		left = db.LogicalExpression{Operator: "or", Left: left, Right: right}
+	}
+}
+
+func parseAnd(input string) (db.Expression, string, error) {
+	left, trimmed, err := parseNot(input)
+	if err != nil {
+		return nil, input, err
+	}
+
+	for {
+		var ok bool
+		trimmed, ok = HasKeyword(trimmed, "and")
+		if !ok {
+			return left, trimmed, nil
+		}
+
+		var right db.Expression
+		right, trimmed, err = parseNot(trimmed)
+		if err != nil {
+			return nil, input, err
+		}
+
+		left = db.LogicalExpression{Operator: "and", Left: left, Right: right}
+	}
+}
+
+func parseNot(input string) (db.Expression, string, error) {
+	trimmed, ok := HasKeyword(input, "not")
+	if !ok {
+		return parseComparison(input)
+	}
+
+	operand, trimmed, err := parseNot(trimmed)
+	if err != nil {
+		return nil, input, err
+	}
+
+	return db.NotExpression{Operand: operand}, trimmed, nil
+}
+
+// Comparison operators, two character operators first so that `<=` isn't
+// parsed as `<`.
+var comparisonOperators = []string{"!=", "<>", "<=", ">=", "=", "<", ">"}
+
+func parseComparison(input string) (db.Expression, string, error) {
+	left, trimmed, err := parseAdditive(input)
+	if err != nil {
+		return nil, input, err
+	}
+
+	if rest, ok := HasKeyword(trimmed, "is"); ok {
+		rest, negated := HasKeyword(rest, "not")
+		rest, ok = HasKeyword(rest, "null")
+		if !ok {
+			return nil, input, fmt.Errorf("!Expected `NULL` after `IS`.")
+		}
+		return db.IsNullExpression{Operand: left, Negated: negated}, rest, nil
+	}
+
+	// `?` tests if a JSON document has a key
+	if rest, ok := HasPrefix(trimmed, "?"); ok {
+		right, rest, err := parseAdditive(rest)
+		if err != nil {
+			return nil, input, err
+		}
+		return db.JSONExpression{Operator: "?", Left: left, Right: right}, rest, nil
+	}
+
+	for _, operator := range comparisonOperators {
+		rest, ok := HasPrefix(trimmed, operator)
+		if !ok {
+			continue
+		}
+
+		right, rest, err := parseAdditive(rest)
+		if err != nil {
+			return nil, input, err
+		}
+
+		if operator == "<>" {
+			operator = "!="
+		}
+		comparison := db.ComparisonExpression{
+			Operator: operator,
+			Left:     left,
+			Right:    right,
+		}
+		return comparison, rest, nil
+	}
+
+	return left, trimmed, nil
+}
+
+func parseAdditive(input string) (db.Expression, string, error) {
+	left, trimmed, err := parseMultiplicative(input)
+	if err != nil {
+		return nil, input, err
+	}
+
+	for {
+		var operator string
+		if strings.HasPrefix(trimmed, "+") {
+			operator = "+"
+		} else if strings.HasPrefix(trimmed, "-") {
+			operator = "-"
+		} else {
+			return left, trimmed, nil
+		}
+		trimmed, _ = HasPrefix(trimmed, operator)
+
+		var right db.Expression
+		right, trimmed, err = parseMultiplicative(trimmed)
+		if err != nil {
+			return nil, input, err
+		}
+
+		left = db.BinaryExpression{Operator: operator, Left: left, Right: right}
+	}
+}
+
+func parseMultiplicative(input string) (db.Expression, string, error) {
+	left, trimmed, err := parseUnary(input)
+	if err != nil {
+		return nil, input, err
+	}
+
+	for {
+		var operator string
+		if strings.HasPrefix(trimmed, "*") {
+			operator = "*"
+		} else if strings.HasPrefix(trimmed, "/") {
+			operator = "/"
+		} else {
+			return left, trimmed, nil
+		}
+		trimmed, _ = HasPrefix(trimmed, operator)
+
+		var right db.Expression
+		right, trimmed, err = parseUnary(trimmed)
+		if err != nil {
+			return nil, input, err
+		}
+
+		left = db.BinaryExpression{Operator: operator, Left: left, Right: right}
+	}
+}
+
+func parseUnary(input string) (db.Expression, string, error) {
+	// a sign directly in front of a number is part of the literal
+	if ScanNumber(input) != "" {
+		return parseJSONOperators(input)
+	}
+
+	trimmed, ok := HasPrefix(input, "-")
+	if !ok {
+		return parseJSONOperators(input)
+	}
+
+	operand, trimmed, err := parseUnary(trimmed)
+	if err != nil {
+		return nil, input, err
+	}
+
+	return db.NegateExpression{Operand: operand}, trimmed, nil
+}
+
+// Parses the JSON operators `->` and `->>`, which are left associative, as in
+// `payload -> 'user' ->> 'name'`.
+func parseJSONOperators(input string) (db.Expression, string, error) {
+	left, trimmed, err := parseCasts(input)
+	if err != nil {
+		return nil, input, err
+	}
+
+	for {
+		var operator string
+		if strings.HasPrefix(trimmed, "->>") {
+			operator = "->>"
+		} else if strings.HasPrefix(trimmed, "->") {
+			operator = "->"
+		} else {
+			return left, trimmed, nil
+		}
+		trimmed, _ = HasPrefix(trimmed, operator)
+
+		var right db.Expression
+		right, trimmed, err = parseCasts(trimmed)
+		if err != nil {
+			return nil, input, err
+		}
+
+		left = db.JSONExpression{Operator: operator, Left: left, Right: right}
+	}
+}
+
+// Parses `::` casts, which are left associative, as in `price::int::text`.
+func parseCasts(input string) (db.Expression, string, error) {
+	operand, trimmed, err := parsePrimary(input)
+	if err != nil {
+		return nil, input, err
+	}
+
+	for {
+		rest, ok := HasPrefix(trimmed, "::")
+		if !ok {
+			return operand, trimmed, nil
+		}
+
+		var castType db.Type
+		castType, trimmed, err = ParseType(rest)
+		if err != nil {
+			return nil, input, err
+		}
+
+		operand = db.CastExpression{Operand: operand, Type: castType}
+	}
+}
+
+func parsePrimary(input string) (db.Expression, string, error) {
+	if input == "" {
+		return nil, input, fmt.Errorf("!Expected expression.")
+	}
+
+	if trimmed, ok := HasPrefix(input, "("); ok {
+		inner, trimmed, err := ParseExpression(trimmed)
+		if err != nil {
+			return nil, input, err
+		}
+		trimmed, ok = HasPrefix(trimmed, ")")
+		if !ok {
+			return nil, input, fmt.Errorf("!Expected ')' after expression.")
+		}
+		return inner, trimmed, nil
+	}
+
+	if trimmed, ok := HasKeyword(input, "null"); ok {
+		literal := db.Literal{Value: db.Value{Value: nil, Type: db.Null{}}}
+		return literal, trimmed, nil
+	}
+
+	for _, keyword := range []string{"true", "false"} {
+		if trimmed, ok := HasKeyword(input, keyword); ok {
+			return db.Literal{Value: db.BoolValue(keyword == "true")}, trimmed, nil
+		}
+	}
+
+	quoted := strings.HasPrefix(input, "'") || strings.HasPrefix(input, "e'") ||
+		strings.HasPrefix(input, "x'")
+	if number := ScanNumber(input); number != "" || quoted {
+		value, trimmed, err := ParseValue(input)
+		if err != nil {
+			return nil, input, err
+		}
+		return db.Literal{Value: *value, Text: number}, trimmed, nil
+	}
+
+	if value, trimmed, err := parseTemporalLiteral(input); value != nil || err != nil {
+		if err != nil {
+			return nil, input, err
+		}
+		return db.Literal{Value: *value}, trimmed, nil
+	}
+
+	if trimmed, ok := HasKeyword(input, "extract"); ok {
+		if extract, trimmed, ok, err := parseExtract(trimmed); ok {
+			return extract, trimmed, err
+		}
+	}
+
+	if trimmed, ok := HasKeyword(input, "cast"); ok {
+		if cast, trimmed, ok, err := parseCast(trimmed); ok {
+			return cast, trimmed, err
+		}
+	}
+
+	// `ParseIdentifier` accepts `*` for `SELECT *`, which here is multiplication
+	ident := ParseIdentifier(input)
+	if starIdx := strings.Index(ident, "*"); starIdx >= 0 {
+		ident = ident[:starIdx]
+	}
+	if ident == "" {
+		return nil, input, fmt.Errorf("!Unexpected input `%v` in expression.", input)
+	}
+	trimmed, _ := HasPrefix(input, ident)
+
+	// an identifier followed by parentheses is a function call
+	if argsInput, ok := HasPrefix(trimmed, "("); ok {
+		if db.IsAggregateFunction(ident) {
+			return parseAggregate(ident, argsInput)
+		}
+
+		call := db.FunctionCall{Name: ident}
+		if rest, ok := HasPrefix(argsInput, ")"); ok {
+			return call, rest, nil
+		}
+
+		args, rest, err := ParseExpressionList(argsInput)
+		if err != nil {
+			return nil, input, err
+		}
+		rest, ok = HasPrefix(rest, ")")
+		if !ok {
+			return nil, input, fmt.Errorf("!Expected ')' after arguments to %v.", ident)
+		}
+		call.Args = args
+		return call, rest, nil
+	}
+
+	return db.ColumnRef{Name: ident}, trimmed, nil
+}
+
+// Parses the argument of an aggregate function after its opening parenthesis,
+// which is a single expression, or `*` for `count(*)`.
+func parseAggregate(name string, input string) (db.Expression, string, error) {
+	call := db.AggregateCall{Name: name}
+	if rest, ok := HasPrefix(input, "*"); ok && name == "count" {
+		if rest, ok = HasPrefix(rest, ")"); ok {
+			return call, rest, nil
+		}
+	}
+
+	arg, rest, err := ParseExpression(input)
+	if err != nil {
+		return nil, input, err
+	}
+	rest, ok := HasPrefix(rest, ")")
+	if !ok {
+		return nil, input, fmt.Errorf("!Expected ')' after argument to %v.", name)
+	}
+	call.Arg = arg
+	return call, rest, nil
+}
+
+// Parses the arguments of `EXTRACT(<field> FROM <expression>)`, which aren't
+// separated by commas like those of other functions. Returns false if `extract`
+// isn't followed by parentheses, in which case it's a column name.
+func parseExtract(input string) (db.Expression, string, bool, error) {
+	trimmed, ok := HasPrefix(input, "(")
+	if !ok {
+		return nil, input, false, nil
+	}
+
+	field := ParseIdentifier(trimmed)
+	trimmed, ok = HasKeyword(trimmed, field)
+	if field == "" || !ok {
+		return nil, input, true, fmt.Errorf("!Expected field to extract.")
+	}
+	trimmed, ok = HasKeyword(trimmed, "from")
+	if !ok {
+		return nil, input, true, fmt.Errorf("!Expected FROM after field to extract.")
+	}
+
+	operand, trimmed, err := ParseExpression(trimmed)
+	if err != nil {
+		return nil, input, true, err
+	}
+	trimmed, ok = HasPrefix(trimmed, ")")
+	if !ok {
+		return nil, input, true, fmt.Errorf("!Expected ')' after arguments to extract.")
+	}
+
+	return db.ExtractExpression{Field: field, Operand: operand}, trimmed, true, nil
+}
+
+// Parses the arguments of `CAST(<expression> AS <type>)`. Returns false if
+// `cast` isn't followed by parentheses, in which case it's a column name.
+func parseCast(input string) (db.Expression, string, bool, error) {
+	trimmed, ok := HasPrefix(input, "(")
+	if !ok {
+		return nil, input, false, nil
+	}
+
+	operand, trimmed, err := ParseExpression(trimmed)
+	if err != nil {
+		return nil, input, true, err
+	}
+	trimmed, ok = HasKeyword(trimmed, "as")
+	if !ok {
+		return nil, input, true, fmt.Errorf("!Expected AS after expression to cast.")
+	}
+
+	castType, trimmed, err := ParseType(trimmed)
+	if err != nil {
+		return nil, input, true, err
+	}
+	trimmed, ok = HasPrefix(trimmed, ")")
+	if !ok {
+		return nil, input, true, fmt.Errorf("!Expected ')' after type to cast to.")
+	}
+
+	return db.CastExpression{Operand: operand, Type: castType}, trimmed, true, nil
+}
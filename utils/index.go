@@ -0,0 +1,254 @@
+// sdb/utils/index.go
+//
+// Functions for building and reading the B+tree files backing secondary
+// indexes. Each entry's key is the encoded values of the index's columns
+// followed by the byte offset of the row in the table file, which keeps keys
+// unique, and its value is that same offset. Indexes are rebuilt whenever their
+// table is rewritten, and updated in place when rows are appended.
+
+package utils
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sdb/db"
+	"sort"
+	"strings"
+)
+
+// Path of the file storing an index, next to its table's file. Index names are
+// unique per database, and the file is hidden so it isn't listed as a table.
+func IndexPath(state *db.DBState, tableName string, indexName string) string {
+	return state.TableDir(tableName) + "/." + indexName + "_index"
+}
+
+// Encodes the values of an index's columns from a row. Returns false if any of
+// them is NULL, in which case the row can't conflict with a unique index.
+func IndexKey(
+	index db.IndexDefinition,
+	colMap map[string]int,
+	row []db.Value,
+) ([]byte, bool) {
+	values := make([]db.Value, len(index.Columns))
+	hasNull := false
+	for idx, colName := range index.Columns {
+		values[idx] = row[colMap[colName]]
+		if values[idx].GetValue() == nil {
+			hasNull = true
+		}
+	}
+	return db.EncodeIndexKey(values), !hasNull
+}
+
+func DuplicateIndexKeyError(
+	tableName string,
+	index db.IndexDefinition,
+	colMap map[string]int,
+	row []db.Value,
+) error {
+	values := make([]string, len(index.Columns))
+	for idx, colName := range index.Columns {
+		value := row[colMap[colName]]
+		values[idx] = value.ToString()
+	}
+	return fmt.Errorf(
+		"!Constraint violation: duplicate key (%v)=(%v) violates UNIQUE INDEX "+
+			"%v of table %v.",
+		strings.Join(index.Columns, ", "),
+		strings.Join(values, ", "),
+		index.Name,
+		tableName,
+	)
+}
+
+// Checks if an index has any entry for the encoded values `key`.
+func IndexContainsKey(tree *db.BTree, key []byte) (bool, error) {
+	found := false
+	err := tree.Scan(key, db.PrefixEnd(key), func([]byte, uint64) bool {
+		found = true
+		return false
+	})
+	return found, err
+}
+
+// Adds a row stored at `offset` of its table file to an index. Adding the same
+// row twice has no effect.
+func InsertIndexEntry(
+	tree *db.BTree,
+	index db.IndexDefinition,
+	colMap map[string]int,
+	row []db.Value,
+	offset int64,
+) error {
+	key, _ := IndexKey(index, colMap, row)
+	entryKey := make([]byte, len(key)+8)
+	copy(entryKey, key)
+	binary.BigEndian.PutUint64(entryKey[len(key):], uint64(offset))
+	return tree.Insert(entryKey, uint64(offset))
+}
+
+func checkUniqueIndexEntry(
+	tree *db.BTree,
+	tableName string,
+	index db.IndexDefinition,
+	colMap map[string]int,
+	row []db.Value,
+) error {
+	key, noNulls := IndexKey(index, colMap, row)
+	if !noNulls {
+		return nil
+	}
+	duplicate, err := IndexContainsKey(tree, key)
+	if err == nil && duplicate {
+		err = DuplicateIndexKeyError(tableName, index, colMap, row)
+	}
+	return err
+}
+
+// Builds a new index from the full contents of its table file, written to a
+// temporary file in the database directory. Returns the temporary file's path.
+func buildIndex(
+	state *db.DBState,
+	tableName string,
+	schema *db.TableSchema,
+	index db.IndexDefinition,
+	contents string,
+) (string, error) {
+	tempFile, err := ioutil.TempFile(state.TableDir(tableName), "."+index.Name+"_tmp")
+	if err != nil {
+		return "", fmt.Errorf("!Failed to build index %v: %v", index.Name, err)
+	}
+	tempPath := tempFile.Name()
+	tempFile.Close()
+
+	tree, err := db.CreateBTree(tempPath)
+	if err != nil {
+		os.Remove(tempPath)
+		return "", fmt.Errorf("!Failed to build index %v: %v", index.Name, err)
+	}
+
+	colMap := make(map[string]int)
+	for idx, column := range schema.Columns {
+		colMap[column.Name] = idx
+	}
+
+	// every complete line is a row
+	offset := 0
+	for offset < len(contents) {
+		length := strings.Index(contents[offset:], "\n")
+		if length < 0 {
+			break
+		}
+
+		row, err := ParseRow(contents[offset:offset+length], schema.Columns)
+		if err == nil && index.Unique {
+			err = checkUniqueIndexEntry(tree, tableName, index, colMap, row)
+		}
+		if err == nil {
+			err = InsertIndexEntry(tree, index, colMap, row, int64(offset))
+		}
+		if err != nil {
+			tree.Close()
+			os.Remove(tempPath)
+			return "", err
+		}
+		offset += length + 1
+	}
+
+	err = tree.Sync()
+	closeErr := tree.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tempPath)
+		return "", fmt.Errorf("!Failed to build index %v: %v", index.Name, err)
+	}
+
+	return tempPath, nil
+}
+
+// Builds every index of a table from the table file's contents. Returns the
+// temporary path of each index, in the same order as the schema's indexes.
+// Nothing is left behind if any index fails to build.
+func buildIndexes(
+	state *db.DBState,
+	tableName string,
+	schema *db.TableSchema,
+	contents string,
+) ([]string, error) {
+	var tempPaths []string
+	for _, index := range schema.Indexes {
+		tempPath, err := buildIndex(state, tableName, schema, index, contents)
+		if err != nil {
+			for _, built := range tempPaths {
+				os.Remove(built)
+			}
+			return nil, err
+		}
+		tempPaths = append(tempPaths, tempPath)
+	}
+
+	return tempPaths, nil
+}
+
+// Opens the B+tree of one of a table's indexes, rebuilding it from the table
+// file first if the index file is missing.
+func OpenIndex(state *db.DBState, tableName string, index db.IndexDefinition) (*db.BTree, error) {
+	indexPath := IndexPath(state, tableName, index.Name)
+	if _, err := os.Stat(indexPath); os.IsNotExist(err) {
+		schema, err := ReadTableSchema(state, tableName)
+		if err != nil {
+			return nil, err
+		}
+		tablePath, _ := TableExists(state, tableName)
+		contents, err := ioutil.ReadFile(tablePath)
+		if err != nil {
+			return nil, fmt.Errorf("!Table %v does not exist.", tableName)
+		}
+
+		tempPath, err := buildIndex(state, tableName, schema, index, string(contents))
+		if err != nil {
+			return nil, err
+		}
+		err = os.Rename(tempPath, indexPath)
+		if err != nil {
+			os.Remove(tempPath)
+			return nil, fmt.Errorf("!Failed to build index %v: %v", index.Name, err)
+		}
+	}
+
+	return db.OpenBTree(indexPath)
+}
+
+// Finds the offsets of rows whose indexed values fall in `[lo, hi)`, in the
+// order the rows appear in the table file.
+func IndexRowOffsets(tree *db.BTree, lo []byte, hi []byte) ([]int64, error) {
+	var offsets []int64
+	err := tree.Scan(lo, hi, func(key []byte, value uint64) bool {
+		offsets = append(offsets, int64(value))
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(offsets, func(i, j int) bool {
+		return offsets[i] < offsets[j]
+	})
+	return offsets, nil
+}
+
+// Reads the row stored at `offset` of a table file, as the raw line.
+func ReadRowAt(tableFile *os.File, offset int64) (string, error) {
+	reader := bufio.NewReader(io.NewSectionReader(tableFile, offset, 1<<62))
+	row, err := reader.ReadString('\n')
+	if err != nil {
+		return "", fmt.Errorf("!Index points past the end of table file %v.", tableFile.Name())
+	}
+	return row, nil
+}
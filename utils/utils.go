@@ -8,9 +8,12 @@
 package utils
 
 import (
+	"bufio"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"sdb/db"
+	"sort"
 	"strconv"
 	"strings"
 	"unicode"
@@ -49,19 +52,39 @@ func ParseIdentifier(input string) string {
 }
 
 // Parses the various types the database supports, like `float`, `int`,
-// `char(X)`, and `varchar(X)`.
-func ParseType(input string) (db.Type, error) {
+// `bigint`, `boolean`, `date`, `timestamp [with time zone]`, `decimal(P, S)`,
+// `char(X)`, and `varchar(X)`. Any other name is taken to be the name of an
+// enum type, whose labels are looked up in the catalog, see
+// `db.Catalog.ResolveType`. Returns the type and the remaining input.
+func ParseType(input string) (db.Type, string, error) {
 	baseType := ParseIdentifier(input)
 
+	if baseType == "timestamp" {
+		trimmed, _ := HasPrefix(input, baseType)
+		if rest, ok := HasPrefix(trimmed, "with time zone"); ok {
+			return db.NewType("timestamptz", 0), rest, nil
+		}
+		trimmed, _ = HasPrefix(trimmed, "without time zone")
+		return db.NewType(baseType, 0), trimmed, nil
+	}
+
 	for _, typeName := range db.ConstWidthTypes {
 		if typeName == baseType {
-			return db.NewType(typeName, 0), nil
+			trimmed, _ := HasPrefix(input, baseType)
+			return db.NewType(typeName, 0), trimmed, nil
 		}
 	}
 
 	trimmed := strings.TrimPrefix(input, baseType)
+	if baseType == "decimal" || baseType == "numeric" {
+		return parseDecimalType(strings.TrimSpace(trimmed))
+	}
+
 	if len(trimmed) < 1 || trimmed[0] != '(' {
-		return nil, fmt.Errorf("Expected '(' after typename %v.", baseType)
+		if baseType != "" && baseType != "char" && baseType != "varchar" {
+			return db.Enum{Name: baseType}, strings.TrimSpace(trimmed), nil
+		}
+		return nil, input, fmt.Errorf("Expected '(' after typename %v.", baseType)
 	}
 	trimmed = strings.TrimPrefix(trimmed, "(")
 
@@ -77,141 +100,282 @@ func ParseType(input string) (db.Type, error) {
 
 	trimmed = strings.TrimPrefix(trimmed, numberString)
 	if len(trimmed) < 1 || trimmed[0] != ')' {
-		return nil,
+		return nil, input,
 			fmt.Errorf("Expected ')' after parameters of type %v.", baseType)
 	}
-	trimmed = strings.TrimPrefix(trimmed, ")")
+	trimmed, _ = HasPrefix(trimmed, ")")
 
 	size, err := strconv.Atoi(numberString)
 	if err != nil {
-		return nil, err
+		return nil, input, err
 	}
 
-	return db.NewType(baseType, size), nil
+	return db.NewType(baseType, size), trimmed, nil
 }
 
-// Parses type in tuple e.g. 123, 3.14, "hello"
-func ParseValue(input string) (*db.Value, error) {
-
-	float, err := ParseFloat(input)
-	if float != nil {
-		return float, nil
-	} else if err != nil {
-		return nil, err
+// Parses the optional `(P)` or `(P, S)` after `decimal` or `numeric`. Without
+// them the decimal is unconstrained, and `S` is 0 if only `P` is given.
+func parseDecimalType(input string) (db.Type, string, error) {
+	trimmed, ok := HasPrefix(input, "(")
+	if !ok {
+		return db.Decimal{}, input, nil
 	}
 
-	int, err := ParseInt(input)
-	if int != nil {
-		return int, nil
-	} else if err != nil {
-		return nil, err
-	}
+	var params []int
+	for {
+		number := ScanNumber(trimmed)
+		param, err := strconv.Atoi(number)
+		if err != nil {
+			return nil, input, fmt.Errorf("!Expected precision and scale of type decimal.")
+		}
+		params = append(params, param)
+		trimmed, _ = HasPrefix(trimmed, number)
 
-	string, err := ParseString(input)
-	if string != nil {
-		return string, nil
-	} else if err != nil {
-		return nil, err
+		if trimmed, ok = HasPrefix(trimmed, ")"); ok {
+			break
+		}
+		trimmed, ok = HasPrefix(trimmed, ",")
+		if !ok || len(params) == 2 {
+			return nil, input, fmt.Errorf("Expected ')' after parameters of type decimal.")
+		}
 	}
 
-	return &db.Value{Value: nil, Type: db.Null{}}, nil
+	decimal := db.Decimal{Precision: params[0]}
+	if len(params) == 2 {
+		decimal.Scale = params[1]
+	}
+	if decimal.Precision < 1 || decimal.Precision > db.MaxDecimalPrecision {
+		return nil, input, fmt.Errorf(
+			"!Precision of type decimal must be between 1 and %v.",
+			db.MaxDecimalPrecision,
+		)
+	}
+	if decimal.Scale < 0 || decimal.Scale > decimal.Precision {
+		return nil, input, fmt.Errorf(
+			"!Scale of type decimal must be between 0 and its precision %v.",
+			decimal.Precision,
+		)
+	}
+	return decimal, trimmed, nil
 }
 
-// Parse floating point numeric of arbitrary precision
-func ParseInt(input string) (*db.Value, error) {
-
-	var integerBuilder strings.Builder
-	for _, digit := range input {
-		if !unicode.IsNumber(digit) {
-			break
+// Parses a literal value, e.g. 123, -3.14, 1e6, true, 'hello' or
+// date '2021-05-01'. Returns the value and the remaining input.
+func ParseValue(input string) (*db.Value, string, error) {
+	// the keyword is sliced off input itself, since HasKeyword trims the rest
+	if _, ok := HasKeyword(strings.ToLower(input), "null"); ok {
+		return &db.Value{Value: nil, Type: db.Null{}}, strings.TrimSpace(input[len("null"):]), nil
+	}
+	for _, keyword := range []string{"true", "false"} {
+		if _, ok := HasKeyword(strings.ToLower(input), keyword); ok {
+			value := db.BoolValue(keyword == "true")
+			return &value, strings.TrimSpace(input[len(keyword):]), nil
 		}
-		integerBuilder.WriteRune(digit)
 	}
-	integerString := integerBuilder.String()
 
-	if integerString == "" {
-		return nil, nil
+	number, rest, err := ParseNumber(input)
+	if number != nil || err != nil {
+		return number, rest, err
 	}
 
-	integer, err := strconv.ParseFloat(integerString, 32)
+	temporal, rest, err := parseTemporalLiteral(input)
+	if temporal != nil || err != nil {
+		return temporal, rest, err
+	}
+
+	blob, rest, err := parseBlobLiteral(input)
+	if blob != nil || err != nil {
+		return blob, rest, err
+	}
+
+	return ParseString(input)
+}
+
+// Parses a date, time, timestamp or interval literal, a type followed by an
+// ISO 8601 string like `timestamp '2021-05-01 10:30'` or `interval '1 day'`.
+// Returns nil if input doesn't start with one.
+func parseTemporalLiteral(input string) (*db.Value, string, error) {
+	switch ParseIdentifier(input) {
+	case "date", "time", "timestamp", "timestamptz", "interval":
+	default:
+		return nil, input, nil
+	}
 
+	literalType, rest, err := ParseType(input)
+	if err != nil || !strings.HasPrefix(rest, "'") {
+		return nil, input, nil
+	}
+	text, rest, err := ParseString(rest)
 	if err != nil {
-		return nil, err
+		return nil, input, err
 	}
 
-	val := db.Value{
-		Value: integer,
-		Type:  db.Int{},
+	value, err := db.ParseTemporal(text.Value.(string), literalType)
+	if err != nil {
+		return nil, input, err
 	}
-	return &val, nil
+	return &value, rest, nil
 }
 
-// Parse integer
-func ParseFloat(input string) (*db.Value, error) {
-	var integerBuilder strings.Builder
-	for _, digit := range input {
-		if !unicode.IsNumber(digit) {
-			break
+// Scans a numeric literal from the start of input: an optional sign, digits
+// with an optional decimal point, as in `5`, `5.`, `.5` and `5.25`, and an
+// optional exponent, as in `1e6` and `2.5e-3`. Returns "" if input doesn't
+// start with a number.
+func ScanNumber(input string) string {
+	scanDigits := func(from int) int {
+		end := from
+		for end < len(input) && input[end] >= '0' && input[end] <= '9' {
+			end++
 		}
-		integerBuilder.WriteRune(digit)
+		return end
 	}
-	integerString := integerBuilder.String()
-	integer, _ := strconv.Atoi(integerString)
 
-	trimmed, _ := HasPrefix(input, integerString)
-	trimmed, ok := HasPrefix(trimmed, ".")
-	if !ok {
-		return nil, nil
+	end := 0
+	if end < len(input) && (input[end] == '+' || input[end] == '-') {
+		end++
+	}
+	mantissaStart := end
+	end = scanDigits(end)
+	hasDigits := end > mantissaStart
+	if end < len(input) && input[end] == '.' {
+		fractionEnd := scanDigits(end + 1)
+		hasDigits = hasDigits || fractionEnd > end+1
+		end = fractionEnd
+	}
+	if !hasDigits {
+		return ""
 	}
 
-	var decimalBuilder strings.Builder
-	decimalBuilder.WriteString("0.")
-	for _, digit := range trimmed {
-		if !unicode.IsNumber(digit) {
-			break
+	// the exponent is only part of the number if it has digits
+	if end < len(input) && (input[end] == 'e' || input[end] == 'E') {
+		exponentStart := end + 1
+		if exponentStart < len(input) &&
+			(input[exponentStart] == '+' || input[exponentStart] == '-') {
+			exponentStart++
+		}
+		if exponentEnd := scanDigits(exponentStart); exponentEnd > exponentStart {
+			end = exponentEnd
+		}
+	}
+
+	return input[:end]
+}
+
+// Parses a numeric literal, see `ScanNumber`. Numbers without a decimal point
+// or exponent are ints, or bigints if they don't fit in an int, and every
+// other number is an exact decimal. Returns nil if input doesn't start with a
+// number.
+func ParseNumber(input string) (*db.Value, string, error) {
+	literal := ScanNumber(input)
+	if literal == "" {
+		return nil, input, nil
+	}
+	rest := strings.TrimSpace(input[len(literal):])
+
+	if !strings.ContainsAny(literal, ".eE") {
+		integer, err := strconv.ParseInt(literal, 10, 64)
+		if err != nil {
+			return nil, input, fmt.Errorf("!Integer %v is out of range for type bigint.", literal)
 		}
-		decimalBuilder.WriteRune(digit)
+		return &db.Value{Value: integer, Type: db.IntTypeOf(integer)}, rest, nil
 	}
-	decimalString := decimalBuilder.String()
-	decimal, _ := strconv.ParseFloat(decimalString, 64)
 
-	val := &db.Value{
-		Value: float64(integer) + decimal,
-		Type:  db.Float{},
+	number, err := db.ParseDecimal(literal)
+	if err != nil {
+		return nil, input, err
 	}
-	return val, nil
+	return &db.Value{Value: number, Type: db.Decimal{}}, rest, nil
 }
 
 // Parse string.
 // Always returns a value of varchar(length of string)
 // This is checked against the column var/varchar(length) later
-func ParseString(input string) (*db.Value, error) {
-	trimmed, ok := HasPrefix(input, "'")
-	if !ok {
-		return nil, fmt.Errorf("Expected string to start with `'`")
+// A quote inside the string is written as two quotes. Strings starting with
+// `e'` are escape strings, where a backslash starts an escape, see
+// `writeEscape`.
+func ParseString(input string) (*db.Value, string, error) {
+	escapes := strings.HasPrefix(input, "e'") || strings.HasPrefix(input, "E'")
+	if escapes {
+		input = input[1:]
+	}
+	if !strings.HasPrefix(input, "'") {
+		return nil, input, fmt.Errorf("Expected string to start with `'`")
 	}
 
-	var stringBuilder strings.Builder
-	for _, letter := range trimmed {
-		if letter == rune('\'') {
-			break
+	var builder strings.Builder
+	for idx := 1; idx < len(input); idx++ {
+		char := input[idx]
+		if char == '\'' && strings.HasPrefix(input[idx+1:], "'") {
+			builder.WriteByte('\'')
+			idx++
+		} else if char == '\'' {
+			string := builder.String()
+			val := &db.Value{
+				Value: string,
+				Type:  db.VarChar{Size: len(string)},
+			}
+			return val, strings.TrimSpace(input[idx+1:]), nil
+		} else if char == '\\' && escapes {
+			length, err := writeEscape(&builder, input[idx+1:])
+			if err != nil {
+				return nil, input, err
+			}
+			idx += length
+		} else {
+			builder.WriteByte(char)
 		}
-		stringBuilder.WriteRune(letter)
 	}
-	string := stringBuilder.String()
+	return nil, input, fmt.Errorf("Expected string to end with `'`")
+}
 
-	trimmed, _ = HasPrefix(trimmed, string)
-	trimmed, ok = HasPrefix(trimmed, "'")
-	if !ok {
-		return nil, fmt.Errorf("Expected string to end with `'`")
+// Writes the character a backslash escape stands for in an escape string like
+// `e'line\nline'`, returning the length of the escape after the backslash.
+// `\n`, `\r`, `\t`, `\b` and `\f` are control characters, `\xHH` and `\ooo`
+// are bytes in hex and octal, and a backslash followed by anything else is
+// that character, like `\'` or `\\`.
+func writeEscape(builder *strings.Builder, escape string) (int, error) {
+	controls := map[byte]byte{'n': '\n', 'r': '\r', 't': '\t', 'b': '\b', 'f': '\f'}
+	if escape == "" {
+		return 0, fmt.Errorf("Expected string to end with `'`")
 	}
 
-	val := &db.Value{
-		Value: string,
-		Type:  db.VarChar{Size: len(string)},
+	if control, ok := controls[escape[0]]; ok {
+		builder.WriteByte(control)
+		return 1, nil
+	} else if escape[0] == 'x' && len(escape) >= 3 {
+		hex, err := strconv.ParseUint(escape[1:3], 16, 8)
+		if err != nil {
+			return 0, fmt.Errorf("!Invalid escape \\%v.", escape[:3])
+		}
+		builder.WriteByte(byte(hex))
+		return 3, nil
+	} else if escape[0] >= '0' && escape[0] <= '7' && len(escape) >= 3 {
+		octal, err := strconv.ParseUint(escape[:3], 8, 8)
+		if err != nil {
+			return 0, fmt.Errorf("!Invalid escape \\%v.", escape[:3])
+		}
+		builder.WriteByte(byte(octal))
+		return 3, nil
 	}
+	builder.WriteByte(escape[0])
+	return 1, nil
+}
 
-	return val, nil
+// Parses a blob literal of hex digits like `x'deadbeef'`. Returns nil if input
+// doesn't start with one.
+func parseBlobLiteral(input string) (*db.Value, string, error) {
+	if !strings.HasPrefix(input, "x'") && !strings.HasPrefix(input, "X'") {
+		return nil, input, nil
+	}
+	length := strings.Index(input[2:], "'")
+	if length < 0 {
+		return nil, input, fmt.Errorf("Expected blob to end with `'`")
+	}
+	blob, err := db.ParseHexBlob(input[2 : length+2])
+	if err != nil {
+		return nil, input, err
+	}
+	return &db.Value{Value: blob, Type: db.Blob{}}, strings.TrimSpace(input[length+3:]), nil
 }
 
 func ParseValueList(input string) ([]db.Value, string, error) {
@@ -220,11 +384,11 @@ func ParseValueList(input string) ([]db.Value, string, error) {
 	trimmed := input
 	var ok bool
 	for {
-		value, err := ParseValue(trimmed)
+		value, rest, err := ParseValue(trimmed)
 		if err != nil {
 			return nil, input, err
 		}
-		trimmed, _ = HasPrefix(trimmed, value.ToString())
+		trimmed = rest
 		valueList = append(valueList, *value)
 		trimmed, ok = HasPrefix(trimmed, ",")
 		if !ok {
@@ -233,6 +397,80 @@ func ParseValueList(input string) ([]db.Value, string, error) {
 	}
 }
 
+// Parses a row of a table file with the given columns. The text of a value
+// doesn't always tell its type, so values are read as the type of their
+// column: floats would otherwise be read as decimals or as ints if they are
+// whole numbers, bigints as ints, and dates, times, timestamps, intervals,
+// text, JSON, enums and UUIDs as strings.
+func ParseRow(row string, columns []db.Column) ([]db.Value, error) {
+	var valueList []db.Value
+
+	trimmed := row
+	var ok bool
+	for idx := 0; ; idx++ {
+		value, rest, err := ParseValue(trimmed)
+		if err != nil {
+			return nil, err
+		}
+		if idx < len(columns) && value.Value != nil {
+			value = columnValue(value, columns[idx].Type)
+		}
+		valueList = append(valueList, *value)
+
+		trimmed, ok = HasPrefix(rest, ",")
+		if !ok {
+			return valueList, nil
+		}
+	}
+}
+
+// Converts a value read from a table file to the type of its column.
+func columnValue(value *db.Value, colType db.Type) *db.Value {
+	switch colType := colType.(type) {
+	case db.Decimal:
+		if number, isDecimal := value.Value.(db.DecimalValue); isDecimal {
+			return &db.Value{Value: number, Type: colType}
+		} else if integer, isInt := value.Value.(int64); isInt {
+			return &db.Value{Value: db.DecimalFromInt(integer), Type: colType}
+		}
+	case db.Float:
+		switch number := value.Value.(type) {
+		case int64:
+			return &db.Value{Value: float64(number), Type: colType}
+		case db.DecimalValue:
+			float, _ := number.Float64()
+			return &db.Value{Value: float, Type: colType}
+		}
+	case db.Int:
+		// arithmetic on the value is checked against the column's range
+		if _, isInt := value.Value.(int64); isInt {
+			return &db.Value{Value: value.Value, Type: colType}
+		}
+	case db.Date, db.Time, db.Timestamp, db.Interval:
+		// written as strings, see `db.Value.ToString`
+		if temporal, err := db.ToTemporal(*value, colType); err == nil {
+			return &temporal
+		}
+	case db.Text:
+		if _, isString := value.Value.(string); isString {
+			return &db.Value{Value: value.Value, Type: colType}
+		}
+	case db.UUID:
+		if text, isString := value.Value.(string); isString {
+			if uuid, err := db.ParseStoredUUID(text); err == nil {
+				return &db.Value{Value: uuid, Type: colType}
+			}
+		}
+	case db.JSON, db.Enum:
+		if text, isString := value.Value.(string); isString {
+			if parsed, _, err := db.ParseAs(text, colType); err == nil {
+				return &parsed
+			}
+		}
+	}
+	return value
+}
+
 func ValueListToString(list []db.Value) string {
 	var stringBuilder strings.Builder
 	for idx, val := range list {
@@ -246,25 +484,87 @@ func ValueListToString(list []db.Value) string {
 	return stringBuilder.String()
 }
 
+// Like `ValueListToString`, but writes a row the way it's stored in a table
+// file, where UUIDs are written compactly, see `db.UUIDValue.StorageString`.
+func RowToString(row []db.Value) string {
+	stored := make([]db.Value, len(row))
+	for idx, value := range row {
+		if uuid, isUUID := value.Value.(db.UUIDValue); isUUID {
+			value = db.Value{Value: uuid.StorageString(), Type: db.Text{}}
+		}
+		stored[idx] = value
+	}
+	return ValueListToString(stored)
+}
+
 // Determines if table exists given current DBState and given table name. Return
-// table path and boolean representing existence of table.
+// table path and boolean representing existence of table. Temporary tables
+// shadow permanent tables of the same name.
 func TableExists(state *db.DBState, tableName string) (string, bool) {
 	var tablePathBuilder strings.Builder
-	tablePathBuilder.WriteString(state.CurrentDB)
+	tablePathBuilder.WriteString(state.TableDir(tableName))
 	tablePathBuilder.WriteString("/")
 	tablePathBuilder.WriteString(tableName)
 
 	tablePath := tablePathBuilder.String()
 
-	_, err := os.Stat(tablePath)
+	if state.IsTemporaryTable(tableName) {
+		return tablePath, true
+	}
+	catalog, err := LoadCatalog(state)
+	if err != nil {
+		return tablePath, false
+	}
+	_, exists := catalog.Tables[tableName]
 
-	return tablePath, err == nil
+	return tablePath, exists
+}
+
+// Lists the names of every table in the current database's catalog, along with
+// this session's temporary tables, ordered by name.
+func ListTables(state *db.DBState) ([]string, error) {
+	catalog, err := LoadCatalog(state)
+	if err != nil {
+		return nil, err
+	}
+
+	tableNames := sortedNames(catalog.Tables)
+	if temporary := state.TemporaryCatalog(); temporary != nil {
+		for tableName := range temporary.Tables {
+			if _, shadowed := catalog.Tables[tableName]; !shadowed {
+				tableNames = append(tableNames, tableName)
+			}
+		}
+		sort.Strings(tableNames)
+	}
+
+	return tableNames, nil
+}
+
+// Gets the schema of a table from the catalog. The schema is a copy, so it can
+// be changed freely before being written back with `WriteTable`.
+func ReadTableSchema(state *db.DBState, tableName string) (*db.TableSchema, error) {
+	if state.IsTemporaryTable(tableName) {
+		return state.TemporaryCatalog().Tables[tableName].Copy(), nil
+	}
+
+	catalog, err := LoadCatalog(state)
+	if err != nil {
+		return nil, err
+	}
+
+	schema, ok := catalog.Tables[tableName]
+	if !ok {
+		return nil, fmt.Errorf("!Table %v does not exist.", tableName)
+	}
+
+	return schema.Copy(), nil
 }
 
 // Opens table file based on current DBState and given table name.
 func OpenTable(state *db.DBState, tableName string, flags int) (*os.File, error) {
 	var tablePathBuilder strings.Builder
-	tablePathBuilder.WriteString(state.CurrentDB)
+	tablePathBuilder.WriteString(state.TableDir(tableName))
 	tablePathBuilder.WriteString("/")
 	tablePathBuilder.WriteString(tableName)
 
@@ -280,6 +580,190 @@ func OpenTable(state *db.DBState, tableName string, flags int) (*os.File, error)
 	return tableFile, nil
 }
 
+// Adds a new, empty table to a catalog and creates its table file in the
+// catalog's directory. Meant to be called from within `UpdateCatalog`, or on
+// the catalog of this session's temporary tables.
+func AddTable(
+	state *db.DBState,
+	catalog *db.Catalog,
+	tableName string,
+	schema *db.TableSchema,
+) error {
+	tablePath := catalog.Database + "/" + tableName
+	tableFile, err := os.OpenFile(tablePath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0777)
+	if err != nil {
+		return fmt.Errorf("!Failed to create table %v: %v", tableName, err)
+	}
+	tableFile.Close()
+
+	catalog.Tables[tableName] = schema.Copy()
+	state.InvalidateKeyIndex(tableName)
+	return nil
+}
+
+// Removes a table from a catalog, and deletes its table file and the files of
+// its indexes, see `AddTable`.
+func RemoveTable(state *db.DBState, catalog *db.Catalog, tableName string) error {
+	schema, ok := catalog.Tables[tableName]
+	if !ok {
+		return fmt.Errorf("!Table %v does not exist.", tableName)
+	}
+
+	err := os.Remove(catalog.Database + "/" + tableName)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("!Failed to delete table %v: %v", tableName, err)
+	}
+
+	state.InvalidateKeyIndex(tableName)
+	for _, index := range schema.Indexes {
+		os.Remove(IndexPath(state, tableName, index.Name))
+	}
+	delete(catalog.Tables, tableName)
+	return nil
+}
+
+// Atomically replaces the rows of a table, and its schema if it has changed.
+// The new rows are written to a temporary file in the database directory which
+// is then renamed over the table file, so a failure partway through leaves the
+// table untouched.
+func ReplaceTable(
+	state *db.DBState,
+	tableName string,
+	schema *db.TableSchema,
+	contents string,
+) error {
+	tablePath, exists := TableExists(state, tableName)
+	if !exists {
+		return fmt.Errorf("!Table %v does not exist.", tableName)
+	}
+	oldSchema, err := ReadTableSchema(state, tableName)
+	if err != nil {
+		return err
+	}
+
+	tempFile, err := ioutil.TempFile(state.TableDir(tableName), "."+tableName+"_tmp")
+	if err != nil {
+		return fmt.Errorf("!Failed to rewrite table %v: %v", tableName, err)
+	}
+	tempPath := tempFile.Name()
+
+	// temporary files are only readable by their owner, while the table keeps
+	// the permissions it was created with
+	info, err := os.Stat(tablePath)
+	if err == nil {
+		err = tempFile.Chmod(info.Mode())
+	}
+	if err == nil {
+		_, err = tempFile.WriteString(contents)
+	}
+	if err == nil {
+		err = tempFile.Sync()
+	}
+	closeErr := tempFile.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("!Failed to rewrite table %v: %v", tableName, err)
+	}
+
+	// row offsets change whenever the table is rewritten, so its indexes are
+	// rebuilt before the table is replaced
+	indexTempPaths, err := buildIndexes(state, tableName, schema, contents)
+	if err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+	removeTemps := func() {
+		os.Remove(tempPath)
+		for _, indexTempPath := range indexTempPaths {
+			os.Remove(indexTempPath)
+		}
+	}
+
+	if state.IsTemporaryTable(tableName) {
+		state.TemporaryCatalog().Tables[tableName] = schema.Copy()
+	} else if TableDefinitionToString(schema) != TableDefinitionToString(oldSchema) {
+		err = UpdateCatalog(state, func(catalog *db.Catalog) error {
+			if _, ok := catalog.Tables[tableName]; !ok {
+				return fmt.Errorf("!Table %v does not exist.", tableName)
+			}
+			catalog.Tables[tableName] = schema.Copy()
+			return nil
+		})
+		if err != nil {
+			removeTemps()
+			return err
+		}
+	}
+
+	err = os.Rename(tempPath, tablePath)
+	if err != nil {
+		removeTemps()
+		return fmt.Errorf("!Failed to rewrite table %v: %v", tableName, err)
+	}
+
+	for idx, indexTempPath := range indexTempPaths {
+		indexPath := IndexPath(state, tableName, schema.Indexes[idx].Name)
+		if os.Rename(indexTempPath, indexPath) != nil {
+			// a missing index is rebuilt the next time it's opened
+			os.Remove(indexTempPath)
+			os.Remove(indexPath)
+		}
+	}
+
+	state.InvalidateKeyIndex(tableName)
+	return nil
+}
+
+// Reads the schema and every row of a table.
+func ReadTable(state *db.DBState, tableName string) (*db.TableSchema, [][]db.Value, error) {
+	schema, err := ReadTableSchema(state, tableName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tableFile, err := OpenTable(state, tableName, os.O_RDONLY)
+	if err != nil {
+		return nil, nil, fmt.Errorf("!Table %v does not exist.", tableName)
+	}
+	defer tableFile.Close()
+
+	reader := bufio.NewReader(tableFile)
+	var rows [][]db.Value
+	for {
+		row, err := reader.ReadString('\n')
+		if err != nil {
+			break
+		}
+
+		rowValues, err := ParseRow(row, schema.Columns)
+		if err != nil {
+			return nil, nil, err
+		}
+		rows = append(rows, rowValues)
+	}
+
+	return schema, rows, nil
+}
+
+// Atomically rewrites a table with the given schema and rows, see
+// `ReplaceTable`.
+func WriteTable(
+	state *db.DBState,
+	tableName string,
+	schema *db.TableSchema,
+	rows [][]db.Value,
+) error {
+	var tableBuilder strings.Builder
+	for _, row := range rows {
+		tableBuilder.WriteString(RowToString(row))
+	}
+
+	return ReplaceTable(state, tableName, schema, tableBuilder.String())
+}
+
 // Convert mapping of column names -> column types to a formatted string.
 func ColumnsToString(columns []db.Column) string {
 	var tableTypesStringBuilder strings.Builder
@@ -297,51 +781,199 @@ func ColumnsToString(columns []db.Column) string {
 	return tableTypesStringBuilder.String()
 }
 
-func TableHeaderToColMap(header string) map[string]int {
-	colMap := make(map[string]int)
-	idx := 0
-	var ok bool
-	for {
-		if header == "" {
-			break
-		}
+// Like `ColumnsToString`, but also includes each column's constraints.
+func ColumnDefinitionsToString(columns []db.Column) string {
+	var definitionsBuilder strings.Builder
 
-		colName := ParseIdentifier(header)
-		header, _ = HasPrefix(header, colName)
+	for idx, column := range columns {
+		definitionsBuilder.WriteString(column.Name)
+		definitionsBuilder.WriteString(" ")
+		definitionsBuilder.WriteString(column.Type.ToString())
 
-		typeName, _ := ParseType(header)
-		colMap[colName] = idx
+		if column.NotNull {
+			definitionsBuilder.WriteString(" not null")
+		}
+		if column.Default != nil {
+			definitionsBuilder.WriteString(" default ")
+			definitionsBuilder.WriteString(column.Default.ToString())
+		}
+		if column.Identity != "" {
+			definitionsBuilder.WriteString(" generated ")
+			definitionsBuilder.WriteString(string(column.Identity))
+			definitionsBuilder.WriteString(" as identity")
+		}
+		if column.Check != nil {
+			definitionsBuilder.WriteString(" check (")
+			definitionsBuilder.WriteString(column.Check.ToString())
+			definitionsBuilder.WriteString(")")
+		}
 
-		header, _ = HasPrefix(header, typeName.ToString())
-		header, ok = HasPrefix(header, ",")
-		if !ok {
-			break
+		if idx < len(columns)-1 {
+			definitionsBuilder.WriteString(", ")
 		}
-		idx += 1
 	}
 
-	return colMap
+	return definitionsBuilder.String()
+}
+
+// Like `ColumnDefinitionsToString`, but also includes the table's key
+// constraints. This is how tables are defined in the catalog, and can be parsed
+// back with `ParseTableDefinition`.
+func TableDefinitionToString(schema *db.TableSchema) string {
+	var definitionBuilder strings.Builder
+	definitionBuilder.WriteString(ColumnDefinitionsToString(schema.Columns))
+
+	for _, key := range schema.Keys {
+		definitionBuilder.WriteString(", ")
+		definitionBuilder.WriteString(key.ToString())
+	}
+	for _, foreignKey := range schema.ForeignKeys {
+		definitionBuilder.WriteString(", ")
+		definitionBuilder.WriteString(foreignKey.ToString())
+	}
+	for _, index := range schema.Indexes {
+		definitionBuilder.WriteString(", ")
+		definitionBuilder.WriteString(index.ToString())
+	}
+
+	return definitionBuilder.String()
 }
 
 // Function to parse <table_columns> into map of column name -> column type.
 func ParseColumnList(input string) ([]db.Column, error) {
+	schema, _, err := ParseTableDefinition(input)
+	if err != nil {
+		return nil, err
+	}
+	return schema.Columns, nil
+}
+
+// Parses a comma separated list of column definitions and key constraints.
+// Column definitions are of the form `<name> <type> [<constraints>]`, see
+// `ParseColumnDefinition`, and key constraints are of the form
+// `PRIMARY KEY (<columns>)`, `UNIQUE (<columns>)`, or
+// `FOREIGN KEY (<columns>) REFERENCES ...`, see `ParseReferences`. Table
+// definitions in the catalog also list indexes as `[UNIQUE] INDEX <name> (<columns>)`. Returns the
+// schema along with the remaining unparsed input.
+func ParseTableDefinition(input string) (*db.TableSchema, string, error) {
+	schema := db.TableSchema{}
+
 	trimmed := input
-	var cols []db.Column
 	var ok bool
 	for {
 		trimmed = strings.TrimSpace(trimmed)
-		ident := ParseIdentifier(trimmed)
-		trimmed, ok = HasPrefix(trimmed, ident)
-		colType, err := ParseType(trimmed)
-		if err != nil {
-			return nil, err
+		// constraint names are accepted, but not stored
+		if rest, ok := HasKeyword(trimmed, "constraint"); ok {
+			name := ParseIdentifier(rest)
+			trimmed, _ = HasPrefix(rest, name)
 		}
-		trimmed, _ = HasPrefix(trimmed, colType.ToString())
 
-		cols = append(cols, db.Column{
-			Name: ident,
-			Type: colType,
-		})
+		// indexes are only ever added to table definitions by `CREATE INDEX`
+		uniqueIndex := false
+		indexRest, isIndex := HasKeyword(trimmed, "index")
+		if rest, ok := HasKeyword(trimmed, "unique"); ok && !isIndex {
+			indexRest, isIndex = HasKeyword(rest, "index")
+			uniqueIndex = isIndex
+		}
+		// a column named `index` is followed by its type, not a name and a
+		// list of columns
+		if isIndex {
+			afterName, _ := HasPrefix(indexRest, ParseIdentifier(indexRest))
+			_, isIndex = HasPrefix(afterName, "(")
+		}
+
+		primary := false
+		rest, isKey := HasPrefix(trimmed, "primary key")
+		if isKey {
+			primary = true
+		} else {
+			rest, isKey = HasKeyword(trimmed, "unique")
+		}
+
+		if isIndex {
+			indexName := ParseIdentifier(indexRest)
+			indexRest, _ = HasPrefix(indexRest, indexName)
+			colNames, indexRest, err := ParseIdentifierList(indexRest)
+			if err != nil {
+				return nil, input, err
+			}
+			schema.Indexes = append(schema.Indexes, db.IndexDefinition{
+				Name:    indexName,
+				Unique:  uniqueIndex,
+				Columns: colNames,
+			})
+			trimmed = indexRest
+		} else if fkRest, isForeignKey := HasPrefix(trimmed, "foreign key"); isForeignKey {
+			colNames, fkRest, err := ParseIdentifierList(fkRest)
+			if err != nil {
+				return nil, input, err
+			}
+			foreignKey, fkRest, err := ParseReferences(fkRest, colNames)
+			if err != nil {
+				return nil, input, err
+			}
+			schema.ForeignKeys = append(schema.ForeignKeys, *foreignKey)
+			trimmed = fkRest
+		} else if isKey {
+			colNames, rest, err := ParseIdentifierList(rest)
+			if err != nil {
+				return nil, input, err
+			}
+			schema.Keys = append(schema.Keys, db.KeyConstraint{
+				Primary: primary,
+				Columns: colNames,
+			})
+			trimmed = rest
+		} else {
+			column, keys, foreignKeys, rest, err := ParseColumnDefinition(trimmed)
+			if err != nil {
+				return nil, input, err
+			}
+			schema.Columns = append(schema.Columns, *column)
+			schema.Keys = append(schema.Keys, keys...)
+			schema.ForeignKeys = append(schema.ForeignKeys, foreignKeys...)
+			trimmed = rest
+		}
+
+		trimmed, ok = HasPrefix(trimmed, ",")
+		if !ok {
+			break
+		}
+	}
+
+	// every column of a table's primary key is implicitly NOT NULL
+	for _, key := range schema.Keys {
+		if !key.Primary {
+			continue
+		}
+		for _, colName := range key.Columns {
+			for idx := range schema.Columns {
+				if schema.Columns[idx].Name == colName {
+					schema.Columns[idx].NotNull = true
+				}
+			}
+		}
+	}
+
+	return &schema, trimmed, nil
+}
+
+// Parses a parenthesized, comma separated list of identifiers like
+// `(id, name)`. Returns the identifiers and the remaining unparsed input.
+func ParseIdentifierList(input string) ([]string, string, error) {
+	trimmed, ok := HasPrefix(input, "(")
+	if !ok {
+		return nil, input, fmt.Errorf("!Expected '(' before list of columns.")
+	}
+
+	var idents []string
+	for {
+		ident := ParseIdentifier(trimmed)
+		if ident == "" {
+			return nil, input, fmt.Errorf("!Expected column name in list of columns.")
+		}
+		trimmed, _ = HasPrefix(trimmed, ident)
+		idents = append(idents, ident)
 
 		trimmed, ok = HasPrefix(trimmed, ",")
 		if !ok {
@@ -349,5 +981,180 @@ func ParseColumnList(input string) ([]db.Column, error) {
 		}
 	}
 
-	return cols, nil
+	trimmed, ok = HasPrefix(trimmed, ")")
+	if !ok {
+		return nil, input, fmt.Errorf("!Expected ')' after list of columns.")
+	}
+
+	return idents, trimmed, nil
+}
+
+// Parses a single column definition of the form
+// `<name> <type> [NOT NULL] [DEFAULT <expression>] [CHECK (<expression>)]
+// [PRIMARY KEY] [UNIQUE] [REFERENCES ...]
+// [GENERATED {ALWAYS | BY DEFAULT} AS IDENTITY | AUTO_INCREMENT]`. A
+// column-level `PRIMARY KEY`, `UNIQUE`, or `REFERENCES` is returned as a key
+// constraint or foreign key over just that column. `AUTO_INCREMENT` is the same
+// as `GENERATED BY DEFAULT AS IDENTITY`. Returns the remaining unparsed input.
+func ParseColumnDefinition(input string) (
+	*db.Column,
+	[]db.KeyConstraint,
+	[]db.ForeignKey,
+	string,
+	error,
+) {
+	trimmed := strings.TrimSpace(input)
+	ident := ParseIdentifier(trimmed)
+	if ident == "" {
+		return nil, nil, nil, input, fmt.Errorf("!Expected column name.")
+	}
+	trimmed, _ = HasPrefix(trimmed, ident)
+
+	colType, trimmed, err := ParseType(trimmed)
+	if err != nil {
+		return nil, nil, nil, input, err
+	}
+
+	column := db.Column{
+		Name: ident,
+		Type: colType,
+	}
+	var keys []db.KeyConstraint
+	var foreignKeys []db.ForeignKey
+
+	var ok bool
+	for {
+		if _, ok = HasKeyword(trimmed, "references"); ok {
+			var foreignKey *db.ForeignKey
+			foreignKey, trimmed, err = ParseReferences(trimmed, []string{ident})
+			if err != nil {
+				return nil, nil, nil, input, err
+			}
+			foreignKeys = append(foreignKeys, *foreignKey)
+		} else if trimmed, ok = HasPrefix(trimmed, "primary key"); ok {
+			keys = append(keys, db.KeyConstraint{
+				Primary: true,
+				Columns: []string{ident},
+			})
+			column.NotNull = true
+		} else if trimmed, ok = HasKeyword(trimmed, "unique"); ok {
+			keys = append(keys, db.KeyConstraint{Columns: []string{ident}})
+		} else if trimmed, ok = HasPrefix(trimmed, "not null"); ok {
+			column.NotNull = true
+		} else if trimmed, ok = HasKeyword(trimmed, "null"); ok {
+			column.NotNull = false
+		} else if trimmed, ok = HasKeyword(trimmed, "default"); ok {
+			column.Default, trimmed, err = ParseExpression(trimmed)
+			if err != nil {
+				return nil, nil, nil, input, err
+			}
+		} else if rest, ok := HasKeyword(trimmed, "generated"); ok {
+			generation := db.GeneratedAlways
+			rest, ok = HasKeyword(rest, "always")
+			if !ok {
+				rest, ok = HasPrefix(rest, "by default")
+				generation = db.GeneratedByDefault
+			}
+			if ok {
+				rest, ok = HasPrefix(rest, "as identity")
+			}
+			if !ok {
+				return nil, nil, nil, input, fmt.Errorf(
+					"!Expected ALWAYS AS IDENTITY or BY DEFAULT AS IDENTITY "+
+						"after GENERATED for column %v.",
+					ident,
+				)
+			}
+			column.Identity = generation
+			column.NotNull = true
+			trimmed = rest
+		} else if trimmed, ok = HasKeyword(trimmed, "auto_increment"); ok {
+			column.Identity = db.GeneratedByDefault
+			column.NotNull = true
+		} else if trimmed, ok = HasKeyword(trimmed, "check"); ok {
+			trimmed, ok = HasPrefix(trimmed, "(")
+			if !ok {
+				return nil, nil, nil, input, fmt.Errorf(
+					"!Expected '(' after CHECK for column %v.", ident,
+				)
+			}
+			column.Check, trimmed, err = ParseExpression(trimmed)
+			if err != nil {
+				return nil, nil, nil, input, err
+			}
+			trimmed, ok = HasPrefix(trimmed, ")")
+			if !ok {
+				return nil, nil, nil, input, fmt.Errorf(
+					"!Expected ')' after CHECK expression for column %v.", ident,
+				)
+			}
+		} else {
+			return &column, keys, foreignKeys, trimmed, nil
+		}
+	}
+}
+
+// Parses `REFERENCES <table> (<columns>) [ON DELETE <action>]
+// [ON UPDATE <action>]` for a foreign key over `colNames`, where action is one
+// of `RESTRICT`, `NO ACTION`, `CASCADE`, `SET NULL`, or `SET DEFAULT`. Actions
+// default to `RESTRICT`. Returns the remaining unparsed input.
+func ParseReferences(input string, colNames []string) (*db.ForeignKey, string, error) {
+	trimmed, ok := HasKeyword(input, "references")
+	if !ok {
+		return nil, input, fmt.Errorf("!Expected REFERENCES after foreign key columns.")
+	}
+
+	refTable := ParseIdentifier(trimmed)
+	if refTable == "" {
+		return nil, input, fmt.Errorf("!Expected table name after REFERENCES.")
+	}
+	trimmed, _ = HasPrefix(trimmed, refTable)
+
+	refColumns, trimmed, err := ParseIdentifierList(trimmed)
+	if err != nil {
+		return nil, input, err
+	}
+	if len(refColumns) != len(colNames) {
+		return nil, input, fmt.Errorf(
+			"!Foreign key (%v) does not match number of referenced columns.",
+			strings.Join(colNames, ", "),
+		)
+	}
+
+	foreignKey := db.ForeignKey{
+		Columns:    colNames,
+		RefTable:   refTable,
+		RefColumns: refColumns,
+		OnDelete:   db.Restrict,
+		OnUpdate:   db.Restrict,
+	}
+
+	for {
+		var action *db.ReferentialAction
+		if rest, ok := HasPrefix(trimmed, "on delete"); ok {
+			action = &foreignKey.OnDelete
+			trimmed = rest
+		} else if rest, ok := HasPrefix(trimmed, "on update"); ok {
+			action = &foreignKey.OnUpdate
+			trimmed = rest
+		} else {
+			return &foreignKey, trimmed, nil
+		}
+
+		if trimmed, ok = HasKeyword(trimmed, "restrict"); ok {
+			*action = db.Restrict
+		} else if trimmed, ok = HasPrefix(trimmed, "no action"); ok {
+			*action = db.Restrict
+		} else if trimmed, ok = HasKeyword(trimmed, "cascade"); ok {
+			*action = db.Cascade
+		} else if trimmed, ok = HasPrefix(trimmed, "set null"); ok {
+			*action = db.SetNull
+		} else if trimmed, ok = HasPrefix(trimmed, "set default"); ok {
+			*action = db.SetDefault
+		} else {
+			return nil, input, fmt.Errorf(
+				"!Expected RESTRICT, NO ACTION, CASCADE, SET NULL, or SET DEFAULT.",
+			)
+		}
+	}
 }